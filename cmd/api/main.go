@@ -15,12 +15,17 @@ import (
 
 	"go-echo-starter/internal/config"
 	"go-echo-starter/internal/database"
+	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/handler"
 	"go-echo-starter/internal/middleware"
 	"go-echo-starter/internal/repository"
 	"go-echo-starter/internal/service"
+	"go-echo-starter/pkg/hasher"
 	"go-echo-starter/pkg/jwt"
 	"go-echo-starter/pkg/logger"
+	"go-echo-starter/pkg/mailer"
+	"go-echo-starter/pkg/oidc"
+	"go-echo-starter/pkg/passwordpolicy"
 	"go-echo-starter/pkg/response"
 	"go-echo-starter/pkg/validator"
 
@@ -44,6 +49,10 @@ import (
 // @in header
 // @name Authorization
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+
 // @schemes http https
 func main() {
 	// Load .env file
@@ -57,6 +66,9 @@ func main() {
 	// Initialize logger
 	log := logger.New(cfg.Log.Level, cfg.IsDevelopment())
 	log.Info().Msg("Starting Go Echo Starter application")
+	for _, warning := range cfg.Warnings {
+		log.Warn().Msg(warning)
+	}
 
 	// Initialize database
 	db, err := database.NewPostgreSQL(&cfg.Database, log)
@@ -75,20 +87,83 @@ func main() {
 	}
 
 	// Initialize JWT
-	jwtService := jwt.New(&cfg.JWT)
+	jwtService, err := jwt.New(&cfg.JWT)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load JWT signing keys")
+	}
+
+	// Initialize password hasher
+	passwordHasher, err := hasher.New(&cfg.Password)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create password hasher")
+	}
+
+	// Initialize password policy
+	passwordPolicy := passwordpolicy.New(&cfg.Password)
+
+	// Initialize mailer
+	mailSender, err := mailer.New(&cfg.Mail, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create mailer")
+	}
 
 	// Initialize validator
 	v := validator.New()
 
-	// Initialize repository
-	userRepo := repository.NewUserRepository(db.DB)
+	// Initialize repositories
+	cursorCodec := repository.NewCursorCodec([]byte(cfg.Cursor.Secret))
+	userRepo := repository.NewUserRepository(db.DB, cursorCodec)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db.DB)
+	tokenRevocationRepo := repository.NewTokenRevocationRepository(db.DB)
+	userTokenRepo := repository.NewUserTokenRepository(db.DB)
+	twoFactorRepo := repository.NewTwoFactorRepository(db.DB)
+	loginFailureRepo := repository.NewLoginFailureRepository(db.DB)
+	apiKeyRepo := repository.NewAPIKeyRepository(db.DB)
+	identityRepo := repository.NewUserIdentityRepository(db.DB)
+	oidcStateRepo := repository.NewOIDCStateRepository(db.DB)
+	oauthClientRepo := repository.NewOAuthClientRepository(db.DB)
+	oauthCodeRepo := repository.NewOAuthCodeRepository(db.DB)
+	oauthConsentRepo := repository.NewOAuthConsentRepository(db.DB)
 
-	// Initialize service
-	userService := service.NewUserService(userRepo, log)
-	authService := service.NewAuthService(userRepo, jwtService, log)
+	// Initialize services
+	tokenRevocationService := service.NewTokenRevocationService(tokenRevocationRepo, &cfg.Auth, cfg.JWT.ExpireTime, log)
+	loginThrottleService := service.NewLoginThrottleService(loginFailureRepo, &cfg.Auth, log)
+	userService := service.NewUserService(userRepo, refreshTokenRepo, loginThrottleService, log)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, userRepo, log)
+	sessionTracker := service.NewSessionTracker(refreshTokenRepo, log)
+	authService := service.NewAuthService(
+		userRepo,
+		refreshTokenRepo,
+		userTokenRepo,
+		twoFactorRepo,
+		apiKeyRepo,
+		identityRepo,
+		oidcStateRepo,
+		tokenRevocationService,
+		loginThrottleService,
+		passwordHasher,
+		passwordPolicy,
+		jwtService,
+		oidc.NewProviders(&cfg.OIDC),
+		mailSender,
+		&cfg.Auth,
+		log,
+	)
+	oauthService := service.NewOAuthService(
+		oauthClientRepo,
+		oauthCodeRepo,
+		oauthConsentRepo,
+		userRepo,
+		refreshTokenRepo,
+		tokenRevocationService,
+		jwtService,
+		jwtService,
+		&cfg.Auth,
+		log,
+	)
 
 	// Initialize handler
-	hdlr := handler.NewHandler(userService, authService, v, log)
+	hdlr := handler.NewHandler(userService, authService, apiKeyService, oauthService, v, log)
 
 	// Initialize Echo
 	e := echo.New()
@@ -106,9 +181,17 @@ func main() {
 		})
 	})
 
+	// Public keys for verifying access tokens
+	e.GET("/.well-known/jwks.json", hdlr.Auth.JWKS)
+
 	// Swagger documentation
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
+	// Authentication middleware; account management only accepts first-party tokens
+	jwtAuth := middleware.FirstPartyJWTAuth(jwtService, tokenRevocationService, sessionTracker, log)
+	// Also accepts personal API keys and tokens issued to OAuth clients
+	apiAuth := middleware.Authenticate(jwtService, tokenRevocationService, sessionTracker, apiKeyService, log)
+
 	// API routes
 	api := e.Group("/api/v1")
 	{
@@ -117,20 +200,68 @@ func main() {
 		{
 			auth.POST("/register", hdlr.Auth.Register)
 			auth.POST("/login", hdlr.Auth.Login)
-			auth.GET("/me", hdlr.Auth.GetMe, middleware.JWTAuth(jwtService))
+			auth.POST("/refresh", hdlr.Auth.Refresh)
+			auth.POST("/password/forgot", hdlr.Auth.ForgotPassword)
+			auth.POST("/password/reset", hdlr.Auth.ResetPassword)
+			auth.PUT("/password", hdlr.Auth.ChangePassword, jwtAuth)
+			auth.GET("/verify", hdlr.Auth.VerifyEmail)
+			auth.POST("/verify/resend", hdlr.Auth.ResendVerification)
+			auth.POST("/2fa/setup", hdlr.Auth.SetupTwoFactor, jwtAuth)
+			auth.POST("/2fa/enable", hdlr.Auth.EnableTwoFactor, jwtAuth)
+			auth.POST("/2fa/disable", hdlr.Auth.DisableTwoFactor, jwtAuth)
+			auth.POST("/2fa/verify", hdlr.Auth.VerifyTwoFactor)
+			auth.GET("/oidc/:provider/authorize", hdlr.Auth.OIDCAuthorize)
+			auth.GET("/oidc/:provider/callback", hdlr.Auth.OIDCCallback)
+			auth.POST("/magic-link", hdlr.Auth.RequestMagicLink)
+			auth.GET("/magic-link/consume", hdlr.Auth.ConsumeMagicLink)
+			auth.POST("/logout", hdlr.Auth.Logout, jwtAuth)
+			auth.POST("/logout-all", hdlr.Auth.LogoutAll, jwtAuth)
+			auth.GET("/sessions", hdlr.Auth.ListSessions, jwtAuth)
+			auth.DELETE("/sessions/:id", hdlr.Auth.RevokeSession, jwtAuth)
+			auth.GET("/me", hdlr.Auth.GetMe, apiAuth)
+			auth.POST("/api-keys", hdlr.APIKey.Create, jwtAuth)
+			auth.GET("/api-keys", hdlr.APIKey.List, jwtAuth)
+			auth.DELETE("/api-keys/:id", hdlr.APIKey.Revoke, jwtAuth)
 		}
 
-		// User routes (protected)
-		users := api.Group("/users", middleware.JWTAuth(jwtService))
+		// OAuth2 authorization server; the token, introspection and revocation
+		// endpoints authenticate the client instead of a user
+		oauth := api.Group("/oauth")
 		{
-			users.POST("", hdlr.User.Create)
-			users.GET("", hdlr.User.GetAll)
-			users.GET("/:id", hdlr.User.GetByID)
-			users.PUT("/:id", hdlr.User.Update)
-			users.DELETE("/:id", hdlr.User.Delete)
+			oauth.POST("/clients", hdlr.OAuth.RegisterClient, jwtAuth, middleware.RequireUser(), middleware.RequireScope(domain.PermOAuthManage))
+			oauth.GET("/clients", hdlr.OAuth.ListClients, jwtAuth, middleware.RequireUser(), middleware.RequireScope(domain.PermOAuthManage))
+			oauth.DELETE("/clients/:id", hdlr.OAuth.DeleteClient, jwtAuth, middleware.RequireUser(), middleware.RequireScope(domain.PermOAuthManage))
+			oauth.GET("/authorize", hdlr.OAuth.Authorize, jwtAuth)
+			oauth.POST("/authorize", hdlr.OAuth.Consent, jwtAuth)
+			oauth.POST("/token", hdlr.OAuth.Token)
+			oauth.POST("/introspect", hdlr.OAuth.Introspect)
+			oauth.POST("/revoke", hdlr.OAuth.Revoke)
+			oauth.GET("/consents", hdlr.OAuth.ListConsents, jwtAuth)
+			oauth.DELETE("/consents/:client_id", hdlr.OAuth.RevokeConsent, jwtAuth)
+		}
+
+		// User routes (protected); clients acting for themselves have no user to manage them as
+		adminOnly := middleware.RequireRole(domain.RoleAdmin)
+		users := api.Group("/users", apiAuth, middleware.RequireUser())
+		{
+			users.POST("", hdlr.User.Create, middleware.RequireScope(domain.PermUsersManage))
+			users.GET("", hdlr.User.GetAll, middleware.RequireScope(domain.PermUsersManage))
+			users.GET("/search", hdlr.User.Search, middleware.RequireScope(domain.PermUsersManage))
+			users.GET("/:id", hdlr.User.GetByID, middleware.RequireScope(domain.PermUsersRead))
+			users.PUT("/:id", hdlr.User.Update, middleware.RequireScope(domain.PermUsersWrite))
+			users.PATCH("/:id", hdlr.User.Patch, middleware.RequireScope(domain.PermUsersWrite))
+			users.PUT("/:id/role", hdlr.User.UpdateRole, adminOnly, middleware.RequireScope(domain.PermUsersManage))
+			users.POST("/:id/unlock", hdlr.User.Unlock, adminOnly, middleware.RequireScope(domain.PermUsersManage))
+			users.DELETE("/:id", hdlr.User.Delete, middleware.RequireScope(domain.PermUsersManage))
+			users.POST("/:id/restore", hdlr.User.Restore, adminOnly, middleware.RequireScope(domain.PermUsersManage))
 		}
 	}
 
+	// Start purging deleted users in the background
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go service.NewUserPurger(userRepo, &cfg.User, log).Run(purgeCtx)
+
 	// Start server
 	go func() {
 		addr := fmt.Sprintf(":%s", cfg.App.Port)
@@ -146,6 +277,7 @@ func main() {
 	<-quit
 
 	log.Info().Msg("Shutting down server...")
+	stopPurge()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +13,15 @@ type Config struct {
 	Database DatabaseConfig
 	Log      LogConfig
 	JWT      JWTConfig
+	Auth     AuthConfig
+	Password PasswordConfig
+	Mail     MailConfig
+	OIDC     OIDCConfig
+	Cursor   CursorConfig
+	User     UserConfig
+
+	// Warnings lists problems with the configuration worth logging at startup
+	Warnings []string
 }
 
 // AppConfig holds application configuration
@@ -35,10 +45,105 @@ type LogConfig struct {
 	Level string
 }
 
-// JWTConfig holds JWT configuration
+// JWTConfig holds JWT configuration.
+// Secret is only used by HS256; the asymmetric algorithms sign with the private key in
+// SigningKeyFile and also accept tokens signed by the keys in VerificationKeyFiles.
 type JWTConfig struct {
-	Secret     string
-	ExpireTime time.Duration
+	Algorithm            string
+	Secret               string
+	SigningKeyFile       string
+	SigningKeyID         string
+	VerificationKeyFiles []string
+	Issuer               string
+	Audience             []string
+	Leeway               time.Duration
+	ExpireTime           time.Duration
+}
+
+// AuthConfig holds authentication flow configuration
+type AuthConfig struct {
+	RefreshTokenTTL      time.Duration
+	RevocationSyncPeriod time.Duration
+	PasswordResetTTL     time.Duration
+	PasswordResetURL     string
+
+	RequireEmailVerification    bool
+	EmailVerificationTTL        time.Duration
+	EmailVerificationURL        string
+	EnumerationSafeRegistration bool
+
+	MFATokenTTL time.Duration
+	TOTPIssuer  string
+
+	OIDCStateTTL time.Duration
+	OAuthCodeTTL time.Duration
+	// OAuthRedirectSchemes are the custom URI schemes, such as those of native
+	// apps, that OAuth clients may redirect to besides https
+	OAuthRedirectSchemes []string
+
+	MagicLinkTTL    time.Duration
+	MagicLinkURL    string
+	MagicLinkLimit  int
+	MagicLinkWindow time.Duration
+
+	LockoutThreshold    int
+	LockoutIPThreshold  int
+	LockoutBaseDuration time.Duration
+	LockoutMaxDuration  time.Duration
+	LockoutWindow       time.Duration
+}
+
+// PasswordConfig holds password hashing and policy configuration
+type PasswordConfig struct {
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+
+	MinLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	ForbidUserInfo   bool
+	MinStrength      int
+	BreachedListDir  string
+}
+
+// MailConfig holds mail delivery configuration
+type MailConfig struct {
+	Driver  string
+	From    string
+	FileDir string
+}
+
+// CursorConfig holds the configuration of the pagination cursors handed to clients.
+// Every instance must share the secret for cursors to work across them.
+type CursorConfig struct {
+	Secret string
+}
+
+// UserConfig holds user account lifecycle configuration.
+// Deleted users are purged for good once DeletedRetention has passed; zero keeps them forever.
+type UserConfig struct {
+	DeletedRetention time.Duration
+	PurgeInterval    time.Duration
+}
+
+// OIDCConfig holds the OpenID Connect providers users can sign in with
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+}
+
+// OIDCProviderConfig holds the client registration with an OpenID Connect provider
+type OIDCProviderConfig struct {
+	Name         string
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
 }
 
 // Load loads configuration from environment variables
@@ -60,20 +165,122 @@ func Load() *Config {
 			Level: getEnv("LOG_LEVEL", "debug"),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
-			ExpireTime: time.Duration(getEnvAsInt("JWT_EXPIRE_HOURS", 24)) * time.Hour,
+			Algorithm:            getEnv("JWT_ALGORITHM", "HS256"),
+			Secret:               getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
+			SigningKeyFile:       getEnv("JWT_SIGNING_KEY_FILE", ""),
+			SigningKeyID:         getEnv("JWT_SIGNING_KEY_ID", ""),
+			VerificationKeyFiles: getEnvAsSlice("JWT_VERIFICATION_KEY_FILES", nil),
+			Issuer:               getEnv("JWT_ISSUER", "go-echo-starter"),
+			Audience:             getEnvAsSlice("JWT_AUDIENCE", []string{"go-echo-starter"}),
+			Leeway:               time.Duration(getEnvAsInt("JWT_LEEWAY_SECONDS", 30)) * time.Second,
+			ExpireTime:           loadJWTExpireTime(),
+		},
+		Auth: AuthConfig{
+			RefreshTokenTTL:      time.Duration(getEnvAsInt("AUTH_REFRESH_TOKEN_TTL_HOURS", 720)) * time.Hour,
+			RevocationSyncPeriod: time.Duration(getEnvAsInt("AUTH_REVOCATION_SYNC_SECONDS", 30)) * time.Second,
+			PasswordResetTTL:     time.Duration(getEnvAsInt("AUTH_PASSWORD_RESET_TTL_MINUTES", 30)) * time.Minute,
+			PasswordResetURL:     getEnv("AUTH_PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+
+			RequireEmailVerification:    getEnvAsBool("AUTH_REQUIRE_EMAIL_VERIFICATION", false),
+			EmailVerificationTTL:        time.Duration(getEnvAsInt("AUTH_EMAIL_VERIFICATION_TTL_HOURS", 24)) * time.Hour,
+			EmailVerificationURL:        getEnv("AUTH_EMAIL_VERIFICATION_URL", "http://localhost:8080/api/v1/auth/verify"),
+			EnumerationSafeRegistration: getEnvAsBool("AUTH_ENUMERATION_SAFE_REGISTRATION", false),
+			MFATokenTTL:                 time.Duration(getEnvAsInt("AUTH_MFA_TOKEN_TTL_MINUTES", 5)) * time.Minute,
+			TOTPIssuer:                  getEnv("AUTH_TOTP_ISSUER", "go-echo-starter"),
+			OIDCStateTTL:                time.Duration(getEnvAsInt("AUTH_OIDC_STATE_TTL_MINUTES", 10)) * time.Minute,
+			OAuthCodeTTL:                time.Duration(getEnvAsInt("AUTH_OAUTH_CODE_TTL_SECONDS", 60)) * time.Second,
+			OAuthRedirectSchemes:        getEnvAsSlice("AUTH_OAUTH_REDIRECT_SCHEMES", nil),
+			MagicLinkTTL:                time.Duration(getEnvAsInt("AUTH_MAGIC_LINK_TTL_MINUTES", 15)) * time.Minute,
+			MagicLinkURL:                getEnv("AUTH_MAGIC_LINK_URL", "http://localhost:8080/api/v1/auth/magic-link/consume"),
+			MagicLinkLimit:              getEnvAsInt("AUTH_MAGIC_LINK_LIMIT", 3),
+			MagicLinkWindow:             time.Duration(getEnvAsInt("AUTH_MAGIC_LINK_WINDOW_MINUTES", 15)) * time.Minute,
+
+			LockoutThreshold:    getEnvAsInt("AUTH_LOCKOUT_THRESHOLD", 5),
+			LockoutIPThreshold:  getEnvAsInt("AUTH_LOCKOUT_IP_THRESHOLD", 20),
+			LockoutBaseDuration: time.Duration(getEnvAsInt("AUTH_LOCKOUT_BASE_SECONDS", 30)) * time.Second,
+			LockoutMaxDuration:  time.Duration(getEnvAsInt("AUTH_LOCKOUT_MAX_MINUTES", 60)) * time.Minute,
+			LockoutWindow:       time.Duration(getEnvAsInt("AUTH_LOCKOUT_WINDOW_MINUTES", 15)) * time.Minute,
+		},
+		Password: PasswordConfig{
+			Algorithm:         getEnv("PASSWORD_HASH_ALGORITHM", "bcrypt"),
+			BcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 10),
+			Argon2Memory:      uint32(getEnvAsInt("PASSWORD_ARGON2_MEMORY_KB", 64*1024)),
+			Argon2Iterations:  uint32(getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 3)),
+			Argon2Parallelism: uint8(getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 2)),
+
+			MinLength:        getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+			RequireUppercase: getEnvAsBool("PASSWORD_REQUIRE_UPPERCASE", false),
+			RequireLowercase: getEnvAsBool("PASSWORD_REQUIRE_LOWERCASE", false),
+			RequireDigit:     getEnvAsBool("PASSWORD_REQUIRE_DIGIT", false),
+			RequireSymbol:    getEnvAsBool("PASSWORD_REQUIRE_SYMBOL", false),
+			ForbidUserInfo:   getEnvAsBool("PASSWORD_FORBID_USER_INFO", true),
+			MinStrength:      getEnvAsInt("PASSWORD_MIN_STRENGTH", 2),
+			BreachedListDir:  getEnv("PASSWORD_BREACHED_LIST_DIR", ""),
+		},
+		Mail: MailConfig{
+			Driver:  getEnv("MAIL_DRIVER", "log"),
+			From:    getEnv("MAIL_FROM", "no-reply@example.com"),
+			FileDir: getEnv("MAIL_FILE_DIR", "tmp/mail"),
+		},
+		OIDC: loadOIDCConfig(),
+		Cursor: CursorConfig{
+			Secret: getEnv("CURSOR_SECRET", "your-cursor-secret-change-in-production"),
+		},
+		User: UserConfig{
+			DeletedRetention: time.Duration(getEnvAsInt("USER_DELETED_RETENTION_DAYS", 30)) * 24 * time.Hour,
+			PurgeInterval:    time.Duration(getEnvAsInt("USER_PURGE_INTERVAL_MINUTES", 60)) * time.Minute,
 		},
 	}
 
+	if _, exists := os.LookupEnv("JWT_EXPIRE_HOURS"); exists {
+		if _, minutes := os.LookupEnv("JWT_EXPIRE_MINUTES"); minutes {
+			cfg.Warnings = append(cfg.Warnings, "JWT_EXPIRE_HOURS is deprecated and ignored because JWT_EXPIRE_MINUTES is set")
+		} else {
+			cfg.Warnings = append(cfg.Warnings, "JWT_EXPIRE_HOURS is deprecated, use JWT_EXPIRE_MINUTES instead")
+		}
+	}
+
 	// Basic validation for production
 	if cfg.App.Env == "production" && cfg.JWT.Secret == "your-super-secret-key-change-in-production" {
-		// We'll let the application decide whether to fatal or just warn, 
+		// We'll let the application decide whether to fatal or just warn,
 		// but here we mark it as a risk.
 	}
 
 	return cfg
 }
 
+// loadJWTExpireTime reads the access token lifetime from JWT_EXPIRE_MINUTES,
+// falling back to the deprecated JWT_EXPIRE_HOURS
+func loadJWTExpireTime() time.Duration {
+	if _, exists := os.LookupEnv("JWT_EXPIRE_MINUTES"); !exists {
+		if hours := getEnvAsInt("JWT_EXPIRE_HOURS", 0); hours > 0 {
+			return time.Duration(hours) * time.Hour
+		}
+	}
+	return time.Duration(getEnvAsInt("JWT_EXPIRE_MINUTES", 15)) * time.Minute
+}
+
+// loadOIDCConfig loads the providers named in OIDC_PROVIDERS, each configured by OIDC_<NAME>_* variables
+func loadOIDCConfig() OIDCConfig {
+	redirectBase := strings.TrimRight(getEnv("OIDC_REDIRECT_BASE_URL", "http://localhost:8080/api/v1/auth/oidc"), "/")
+
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvAsSlice("OIDC_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			DiscoveryURL: getEnv(prefix+"DISCOVERY_URL", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", redirectBase+"/"+name+"/callback"),
+			Scopes:       getEnvAsSlice(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		})
+	}
+
+	return OIDCConfig{Providers: providers}
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -92,6 +299,30 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsBool gets an environment variable as boolean or returns a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice gets a comma-separated environment variable as a slice or returns a default value
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	if value, exists := os.LookupEnv(key); exists {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	return defaultValue
+}
+
 // IsDevelopment returns true if the environment is development
 func (c *Config) IsDevelopment() bool {
 	return c.App.Env == "development"
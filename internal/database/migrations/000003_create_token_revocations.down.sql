@@ -0,0 +1,8 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_revoked_tokens_expires_at;
+
+-- Drop table
+DROP TABLE IF EXISTS revoked_tokens;
+
+-- Drop token version column
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
@@ -0,0 +1,2 @@
+-- Drop role column
+ALTER TABLE users DROP COLUMN IF EXISTS role;
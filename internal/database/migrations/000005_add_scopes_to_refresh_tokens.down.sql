@@ -0,0 +1,2 @@
+-- Drop scopes column
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS scopes;
@@ -0,0 +1,2 @@
+-- Add granted scopes to refresh tokens so rotation keeps them
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
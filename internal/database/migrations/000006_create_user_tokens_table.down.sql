@@ -0,0 +1,5 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_user_tokens_user_id_purpose;
+
+-- Drop table
+DROP TABLE IF EXISTS user_tokens;
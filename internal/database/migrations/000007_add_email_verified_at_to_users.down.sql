@@ -0,0 +1,2 @@
+-- Drop email verification timestamp
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
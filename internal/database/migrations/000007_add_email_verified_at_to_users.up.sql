@@ -0,0 +1,2 @@
+-- Add email verification timestamp to users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,12 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_recovery_codes_user_id;
+
+-- Drop table
+DROP TABLE IF EXISTS recovery_codes;
+
+-- Drop TOTP columns
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,5 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_login_failures_last_failed_at;
+
+-- Drop table
+DROP TABLE IF EXISTS login_failures;
@@ -0,0 +1,5 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_api_keys_user_id;
+
+-- Drop table
+DROP TABLE IF EXISTS api_keys;
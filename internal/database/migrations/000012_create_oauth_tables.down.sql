@@ -0,0 +1,19 @@
+-- Restore user-only token revocations
+DELETE FROM revoked_tokens WHERE user_id IS NULL;
+ALTER TABLE revoked_tokens ALTER COLUMN user_id SET NOT NULL;
+
+-- Drop client binding of refresh tokens
+DELETE FROM refresh_tokens WHERE client_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_refresh_tokens_client_id;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS client_id;
+
+-- Drop trigger
+DROP TRIGGER IF EXISTS update_oauth_consents_updated_at ON oauth_consents;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_expires_at;
+
+-- Drop tables
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,6 @@
+-- Drop index
+DROP INDEX IF EXISTS idx_refresh_tokens_revoked_at;
+
+-- Drop client info columns
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS user_agent;
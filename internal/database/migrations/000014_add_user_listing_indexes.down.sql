@@ -0,0 +1,3 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_users_name_id;
+DROP INDEX IF EXISTS idx_users_created_at_id;
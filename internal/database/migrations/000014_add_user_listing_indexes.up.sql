@@ -0,0 +1,4 @@
+-- Create indexes for sorted user listings, with the ID breaking ties
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_users_name_id ON users (name, id);
@@ -0,0 +1,10 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_users_email_trgm;
+DROP INDEX IF EXISTS idx_users_name_trgm;
+DROP INDEX IF EXISTS idx_users_search_vector;
+
+-- Drop search document
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
+
+-- Drop extension
+DROP EXTENSION IF EXISTS pg_trgm;
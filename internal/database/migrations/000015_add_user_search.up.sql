@@ -0,0 +1,16 @@
+-- Enable trigram matching for fuzzy search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Add full-text search document, weighting the name above the email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', name), 'A') ||
+        setweight(to_tsvector('simple', email), 'B')
+    ) STORED;
+
+-- Create indexes for full-text and fuzzy search
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (name gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (email gin_trgm_ops);
@@ -0,0 +1,12 @@
+-- Drop deleted users, whose email addresses may clash with active ones
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_users_deleted_at;
+DROP INDEX IF EXISTS idx_users_email_active;
+
+-- Restore unique email constraint
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+-- Drop soft delete column
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
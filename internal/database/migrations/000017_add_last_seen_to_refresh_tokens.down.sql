@@ -0,0 +1,2 @@
+-- Drop last seen column
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS last_seen_at;
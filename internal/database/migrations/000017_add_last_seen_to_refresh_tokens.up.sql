@@ -0,0 +1,2 @@
+-- Record when the access tokens of a session were last used, so sessions show when they were last seen
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITH TIME ZONE;
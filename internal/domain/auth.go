@@ -6,38 +6,158 @@ import (
 	"github.com/google/uuid"
 )
 
-// Auth represents authentication credentials
-type Auth struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+// RefreshToken represents a persisted refresh token.
+// Only the SHA-256 hash of the opaque token is stored. Tokens rotated from the
+// same login share a FamilyID so the whole chain can be revoked on reuse.
+// Tokens issued to an OAuth client carry its ClientID and can only be used by it.
+// The user agent and IP of the client a token was issued to are kept to describe the session.
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	FamilyID  uuid.UUID  `json:"family_id" db:"family_id"`
+	ClientID  *uuid.UUID `json:"client_id,omitempty" db:"client_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	Scopes    []string   `json:"scopes" db:"scopes"`
+	UserAgent string     `json:"user_agent" db:"user_agent"`
+	IPAddress string     `json:"ip_address" db:"ip_address"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 }
 
-// LoginRequest represents login credentials
+// TokenPurpose identifies what a single-use user token may be used for
+type TokenPurpose string
+
+// Available token purposes
+const (
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposeMFAPending        TokenPurpose = "mfa_pending"
+	TokenPurposeMagicLink         TokenPurpose = "magic_link"
+)
+
+// UserToken represents a single-use, expiring token sent to a user.
+// Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID         uuid.UUID    `json:"id" db:"id"`
+	UserID     uuid.UUID    `json:"user_id" db:"user_id"`
+	Purpose    TokenPurpose `json:"purpose" db:"purpose"`
+	TokenHash  string       `json:"-" db:"token_hash"`
+	ExpiresAt  time.Time    `json:"expires_at" db:"expires_at"`
+	ConsumedAt *time.Time   `json:"consumed_at,omitempty" db:"consumed_at"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+}
+
+// LoginRequest represents login credentials.
+// Scopes optionally narrows the token down to a subset of the permissions of the user's role.
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Email    string   `json:"email" validate:"required,email"`
+	Password string   `json:"password" validate:"required,min=6"`
+	Scopes   []string `json:"scopes" validate:"omitempty,dive,required"`
 }
 
 // RegisterRequest represents registration data
 type RegisterRequest struct {
 	Name     string `json:"name" validate:"required,min=2,max=255"`
 	Email    string `json:"email" validate:"required,email,max=255"`
-	Password string `json:"password" validate:"required,min=6,max=72"`
+	Password string `json:"password" validate:"required,max=128"`
+}
+
+// RefreshTokenRequest represents a token refresh request
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest represents a logout request.
+// The refresh token is optional; when given, its token family is revoked too.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ForgotPasswordRequest represents a password reset request
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest represents a password reset confirmation
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,max=128"`
+}
+
+// ChangePasswordRequest represents a password change by an authenticated user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,max=128,nefield=CurrentPassword"`
 }
 
-// TokenResponse represents the token response
+// MagicLinkRequest represents a request to email a passwordless login link
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResendVerificationRequest represents a request to resend the verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// RevokedToken represents a revoked access token
+type RevokedToken struct {
+	JTI       string    `json:"jti" db:"jti"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+// TokenResponse represents the token response.
+// When MFARequired is set, no access token is issued; MFAToken must be exchanged
+// together with a second-factor code at the two-factor verify endpoint.
 type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int64  `json:"expires_in"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
-// AuthUser represents authenticated user data in JWT claims
+// AuthUser represents authenticated user data in JWT claims.
+// ClientID is set when the token was issued to an OAuth client.
 type AuthUser struct {
-	ID    uuid.UUID `json:"id"`
-	Name  string    `json:"name"`
-	Email string    `json:"email"`
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     Role      `json:"role"`
+	Scopes   []string  `json:"scopes"`
+	ClientID string    `json:"client_id,omitempty"`
+}
+
+// IsAdmin returns true if the user has the admin role
+func (u *AuthUser) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// HasScope returns true if the user's token was granted the permission
+func (u *AuthUser) HasScope(p Permission) bool {
+	for _, scope := range u.Scopes {
+		if scope == string(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginFailure tracks failed login attempts against an account or from a client address
+type LoginFailure struct {
+	Subject      string     `db:"subject"`
+	Failures     int        `db:"failures"`
+	LastFailedAt time.Time  `db:"last_failed_at"`
+	LockedUntil  *time.Time `db:"locked_until"`
+}
+
+// IsLockedAt returns true if the subject is locked out at the given time
+func (f *LoginFailure) IsLockedAt(t time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(t)
 }
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuth2 grant types supported by the token endpoint
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuthClient represents a third-party application registered to act on behalf of users.
+// Confidential clients authenticate with a secret, of which only the SHA-256 hash is stored;
+// public clients, such as mobile apps, have none and rely on PKCE alone.
+// Scopes is the most a client can ever be granted.
+type OAuthClient struct {
+	ID           uuid.UUID  `json:"client_id" db:"id"`
+	Name         string     `json:"name" db:"name"`
+	SecretHash   *string    `json:"-" db:"secret_hash"`
+	RedirectURIs []string   `json:"redirect_uris" db:"redirect_uris"`
+	Scopes       []string   `json:"scopes" db:"scopes"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// IsConfidential returns true if the client authenticates with a secret
+func (c *OAuthClient) IsConfidential() bool {
+	return c.SecretHash != nil
+}
+
+// CreateOAuthClientRequest represents a request to register an OAuth client.
+// Scopes default to, and may not exceed, the scopes of the registering token.
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,min=2,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"omitempty,max=10,dive,url"`
+	Scopes       []string `json:"scopes" validate:"omitempty,dive,required"`
+	Public       bool     `json:"public"`
+}
+
+// CreateOAuthClientResponse represents a newly registered client.
+// The secret of a confidential client is only ever shown in this response.
+type CreateOAuthClientResponse struct {
+	ClientSecret string `json:"client_secret,omitempty"`
+	*OAuthClient
+}
+
+// OAuthAuthorizationCode represents an issued, not yet exchanged authorization code.
+// Only the SHA-256 hash of the code is stored.
+type OAuthAuthorizationCode struct {
+	CodeHash      string    `db:"code_hash"`
+	ClientID      uuid.UUID `db:"client_id"`
+	UserID        uuid.UUID `db:"user_id"`
+	RedirectURI   string    `db:"redirect_uri"`
+	Scopes        []string  `db:"scopes"`
+	CodeChallenge string    `db:"code_challenge"`
+	ExpiresAt     time.Time `db:"expires_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// OAuthConsent records the scopes a user has allowed a client to use on their behalf
+type OAuthConsent struct {
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	ClientID   uuid.UUID `json:"client_id" db:"client_id"`
+	ClientName string    `json:"client_name" db:"client_name"`
+	Scopes     []string  `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OAuthAuthorizeRequest represents an authorization request (RFC 6749 section 4.1.1)
+// with a PKCE code challenge (RFC 7636)
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `query:"response_type" json:"response_type" validate:"required"`
+	ClientID            string `query:"client_id" json:"client_id" validate:"required"`
+	RedirectURI         string `query:"redirect_uri" json:"redirect_uri"`
+	Scope               string `query:"scope" json:"scope"`
+	State               string `query:"state" json:"state"`
+	CodeChallenge       string `query:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// OAuthConsentRequest represents the user's decision on an authorization request
+type OAuthConsentRequest struct {
+	OAuthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// OAuthAuthorizeResponse tells the frontend either where to send the user back to,
+// or that it has to ask the user to consent to the listed scopes first
+type OAuthAuthorizeResponse struct {
+	RedirectTo      string       `json:"redirect_to,omitempty"`
+	ConsentRequired bool         `json:"consent_required,omitempty"`
+	Client          *OAuthClient `json:"client,omitempty"`
+	Scopes          []string     `json:"scopes,omitempty"`
+}
+
+// OAuthClientCredentials are the credentials a client authenticated with,
+// from the Authorization header or the request body
+type OAuthClientCredentials struct {
+	ID     string
+	Secret string
+}
+
+// OAuthTokenRequest represents a token request (RFC 6749 sections 4.1.3, 4.4.2 and 6)
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// OAuthTokenActionRequest represents an introspection (RFC 7662) or revocation (RFC 7009) request
+type OAuthTokenActionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// OAuthIntrospectionResponse represents the state of a token (RFC 7662 section 2.2).
+// Inactive tokens only have Active set.
+type OAuthIntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	JTI       string   `json:"jti,omitempty"`
+}
+
+// OAuthErrorResponse represents an OAuth2 error response (RFC 6749 section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
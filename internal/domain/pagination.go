@@ -0,0 +1,61 @@
+package domain
+
+// Page sizes of paginated listings
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+// PageRequest represents the page query parameters of a paginated listing
+type PageRequest struct {
+	Page    int `query:"page" validate:"omitempty,min=1"`
+	PerPage int `query:"per_page" validate:"omitempty,min=1,max=100"`
+}
+
+// PageNumber returns the requested page, counting from 1
+func (p PageRequest) PageNumber() int {
+	if p.Page < 1 {
+		return 1
+	}
+	return p.Page
+}
+
+// PageSize returns the page size, DefaultPerPage if none was requested
+func (p PageRequest) PageSize() int {
+	if p.PerPage < 1 {
+		return DefaultPerPage
+	}
+	return min(p.PerPage, MaxPerPage)
+}
+
+// Offset returns the number of rows before the requested page
+func (p PageRequest) Offset() int {
+	return (p.PageNumber() - 1) * p.PageSize()
+}
+
+// CursorRequest represents the query parameters of a cursor-paginated listing.
+// Cursor is empty on the first page and otherwise one returned with a previous page.
+type CursorRequest struct {
+	Cursor string `query:"cursor" validate:"omitempty,max=512"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// Keyset reports whether the cursor-paginated listing was requested
+func (r CursorRequest) Keyset() bool {
+	return r.Cursor != "" || r.Limit != 0
+}
+
+// PageLimit returns the page size, DefaultPerPage if none was requested
+func (r CursorRequest) PageLimit() int {
+	if r.Limit < 1 {
+		return DefaultPerPage
+	}
+	return min(r.Limit, MaxPerPage)
+}
+
+// CursorPage holds the cursors to the pages after and before a page of a
+// cursor-paginated listing, empty when there is no such page
+type CursorPage struct {
+	Next string
+	Prev string
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+)
+
+// Permission represents a scope that can be granted to a token
+type Permission string
+
+// Available permissions
+const (
+	PermUsersRead   Permission = "users:read"
+	PermUsersWrite  Permission = "users:write"
+	PermUsersManage Permission = "users:manage"
+	PermOAuthManage Permission = "oauth:manage"
+)
+
+// permissionRegistry holds every known permission and its description
+var permissionRegistry = map[Permission]string{}
+
+// rolePermissions maps each role to the permissions it grants
+var rolePermissions = map[Role][]Permission{}
+
+func init() {
+	RegisterPermission(PermUsersRead, "Read user records", RoleAdmin, RoleUser)
+	RegisterPermission(PermUsersWrite, "Update user records", RoleAdmin, RoleUser)
+	RegisterPermission(PermUsersManage, "List, create and delete users and manage roles", RoleAdmin)
+	RegisterPermission(PermOAuthManage, "Register and delete OAuth clients", RoleAdmin)
+}
+
+// RegisterPermission adds a permission to the registry and grants it to the given roles.
+// It is meant to be called from init functions.
+func RegisterPermission(p Permission, description string, roles ...Role) {
+	permissionRegistry[p] = description
+	for _, role := range roles {
+		rolePermissions[role] = append(rolePermissions[role], p)
+	}
+}
+
+// IsValidPermission returns true if the permission is registered
+func IsValidPermission(p Permission) bool {
+	_, ok := permissionRegistry[p]
+	return ok
+}
+
+// PermissionsForRole returns the permissions granted to a role
+func PermissionsForRole(role Role) []Permission {
+	perms := make([]Permission, len(rolePermissions[role]))
+	copy(perms, rolePermissions[role])
+	return perms
+}
+
+// Grants returns true if the role grants the permission
+func (r Role) Grants(p Permission) bool {
+	for _, perm := range rolePermissions[r] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeStrings converts permissions to their string form, sorted
+func ScopeStrings(perms []Permission) []string {
+	scopes := make([]string, len(perms))
+	for i, p := range perms {
+		scopes[i] = string(p)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// JoinScopes formats scopes as a space-delimited string, as used by OAuth2
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// SplitScopes parses a space-delimited OAuth2 scope string
+func SplitScopes(scope string) []string {
+	return strings.Fields(scope)
+}
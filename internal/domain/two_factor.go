@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"time"
+)
+
+// TOTPConfig represents a user's TOTP enrollment
+type TOTPConfig struct {
+	Secret    *string    `db:"totp_secret"`
+	EnabledAt *time.Time `db:"totp_enabled_at"`
+	LastStep  int64      `db:"totp_last_step"`
+}
+
+// IsEnabled returns true if TOTP enrollment has been confirmed
+func (c *TOTPConfig) IsEnabled() bool {
+	return c.Secret != nil && c.EnabledAt != nil
+}
+
+// TwoFactorSetupResponse represents a pending TOTP enrollment
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorCodeRequest represents a request confirmed with a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// TwoFactorEnableResponse represents the single-use recovery codes handed out on enrollment
+type TwoFactorEnableResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorVerifyRequest represents the second step of a two-factor login
+type TwoFactorVerifyRequest struct {
+	MFAToken string   `json:"mfa_token" validate:"required"`
+	Code     string   `json:"code" validate:"required"`
+	Scopes   []string `json:"scopes" validate:"omitempty,dive,required"`
+}
@@ -6,44 +6,145 @@ import (
 	"github.com/google/uuid"
 )
 
+// Role represents a user role
+type Role string
+
+// Available roles
+const (
+	RoleAdmin Role = "admin"
+	RoleUser  Role = "user"
+)
+
 // User represents a user entity
 type User struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Email     string    `json:"email" db:"email"`
-	Password  string    `json:"-" db:"password"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	Password        string     `json:"-" db:"password"`
+	Role            Role       `json:"role" db:"role"`
+	TokenVersion    int        `json:"-" db:"token_version"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	TOTPEnabledAt   *time.Time `json:"-" db:"totp_enabled_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
 // CreateUserRequest represents request body for creating a user
 type CreateUserRequest struct {
 	Name  string `json:"name" validate:"required,min=2,max=255"`
 	Email string `json:"email" validate:"required,email,max=255"`
+	Role  Role   `json:"role" validate:"omitempty,oneof=admin user"`
 }
 
-// UpdateUserRequest represents request body for updating a user
+// ListUsersRequest represents the query of a user listing.
+// Name and Email match substrings case-insensitively, CreatedAfter is inclusive
+// and CreatedBefore exclusive. Sort names a field, prefixed with "-" for
+// descending order; users are listed by creation time by default.
+// The listing is paged either by page number or, sorted by creation time only, by cursor.
+// Deleted users are only listed with IncludeDeleted.
+type ListUsersRequest struct {
+	PageRequest
+	CursorRequest
+	Name           string     `query:"name" validate:"omitempty,max=255"`
+	Email          string     `query:"email" validate:"omitempty,max=255"`
+	CreatedAfter   *time.Time `query:"created_after"`
+	CreatedBefore  *time.Time `query:"created_before"`
+	Sort           string     `query:"sort" validate:"omitempty,oneof=name -name email -email created_at -created_at"`
+	IncludeDeleted bool       `query:"include_deleted"`
+}
+
+// UpdateUserRequest represents request body for updating a user.
+// Empty fields are left unchanged.
 type UpdateUserRequest struct {
 	Name  string `json:"name" validate:"omitempty,min=2,max=255"`
 	Email string `json:"email" validate:"omitempty,email,max=255"`
 }
 
+// Patch returns the changes the request makes
+func (r *UpdateUserRequest) Patch() *UserPatch {
+	patch := &UserPatch{}
+	if r.Name != "" {
+		patch.Name = &r.Name
+	}
+	if r.Email != "" {
+		patch.Email = &r.Email
+	}
+	return patch
+}
+
+// UserDocument is the patchable representation of a user, the document PATCH
+// requests apply to. A patched document must be valid as a whole.
+type UserDocument struct {
+	Name  string `json:"name" validate:"required,min=2,max=255"`
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// UserPatch holds the changes to a user. Nil fields are left unchanged.
+type UserPatch struct {
+	Name  *string
+	Email *string
+}
+
+// UserPatchFunc computes the changes to make to a user from its current document
+type UserPatchFunc func(current *UserDocument) (*UserPatch, error)
+
+// Diff returns the changes turning from into d
+func (d *UserDocument) Diff(from *UserDocument) *UserPatch {
+	patch := &UserPatch{}
+	if d.Name != from.Name {
+		patch.Name = &d.Name
+	}
+	if d.Email != from.Email {
+		patch.Email = &d.Email
+	}
+	return patch
+}
+
+// UpdateRoleRequest represents request body for changing a user's role
+type UpdateRoleRequest struct {
+	Role Role `json:"role" validate:"required,oneof=admin user"`
+}
+
 // UserResponse represents user response
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID               uuid.UUID  `json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `json:"email"`
+	Role             Role       `json:"role"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
 }
 
 // ToResponse converts User to UserResponse
 func (u *User) ToResponse() *UserResponse {
 	return &UserResponse{
-		ID:        u.ID,
-		Name:      u.Name,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:               u.ID,
+		Name:             u.Name,
+		Email:            u.Email,
+		Role:             u.Role,
+		EmailVerifiedAt:  u.EmailVerifiedAt,
+		TwoFactorEnabled: u.IsTwoFactorEnabled(),
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
+		DeletedAt:        u.DeletedAt,
 	}
 }
+
+// Document returns the patchable representation of a user
+func (u *User) Document() *UserDocument {
+	return &UserDocument{Name: u.Name, Email: u.Email}
+}
+
+// IsEmailVerified returns true if the user has verified their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsTwoFactorEnabled returns true if the user has confirmed a TOTP enrollment
+func (u *User) IsTwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
@@ -0,0 +1,49 @@
+package domain
+
+// SearchUsersRequest represents the query of a user search.
+// Q is matched against whole words of the name and email, and fuzzily against
+// their spelling, so typos and partial words still find users.
+type SearchUsersRequest struct {
+	Q     string `query:"q" validate:"required,min=2,max=255"`
+	Limit int    `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// PageLimit returns the number of results, DefaultPerPage if none was requested
+func (r SearchUsersRequest) PageLimit() int {
+	if r.Limit < 1 {
+		return DefaultPerPage
+	}
+	return min(r.Limit, MaxPerPage)
+}
+
+// UserSearchResult is a user matching a search along with how well it matches.
+// The highlights are the HTML-escaped name and email with the matching words
+// wrapped in <mark> tags.
+type UserSearchResult struct {
+	User
+	Rank           float64 `db:"rank"`
+	NameHighlight  string  `db:"name_highlight"`
+	EmailHighlight string  `db:"email_highlight"`
+}
+
+// UserHighlights represents the name and email of a user with the words matching a search marked
+type UserHighlights struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// UserSearchResponse represents a user matching a search in API responses
+type UserSearchResponse struct {
+	User       *UserResponse  `json:"user"`
+	Rank       float64        `json:"rank"`
+	Highlights UserHighlights `json:"highlights"`
+}
+
+// ToResponse converts a UserSearchResult to a UserSearchResponse
+func (r *UserSearchResult) ToResponse() *UserSearchResponse {
+	return &UserSearchResponse{
+		User:       r.User.ToResponse(),
+		Rank:       r.Rank,
+		Highlights: UserHighlights{Name: r.NameHighlight, Email: r.EmailHighlight},
+	}
+}
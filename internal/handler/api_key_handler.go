@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/service"
+	"go-echo-starter/pkg/logger"
+	"go-echo-starter/pkg/response"
+	"go-echo-starter/pkg/validator"
+)
+
+// APIKeyHandler handles personal API key HTTP requests
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+	validator     *validator.Validator
+	log           *logger.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService service.APIKeyService, v *validator.Validator, log *logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		validator:     v,
+		log:           log,
+	}
+}
+
+// Create godoc
+// @Summary Create an API key
+// @Description Create a personal API key for machine-to-machine access, sent in the X-API-Key header. The key is only shown in this response. Scopes default to, and may not exceed, the scopes of the caller's token.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body domain.CreateAPIKeyRequest true "Key name, scopes and expiry"
+// @Success 201 {object} response.Response{data=domain.CreateAPIKeyResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/api-keys [post]
+func (h *APIKeyHandler) Create(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind create API key request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	key, err := h.apiKeyService.Create(c.Request().Context(), user, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			return response.Error(c, http.StatusBadRequest, "Requested scope is invalid or not permitted")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to create API key")
+	}
+
+	return response.Success(c, http.StatusCreated, "API key created successfully", key)
+}
+
+// List godoc
+// @Summary List API keys
+// @Description List the current user's API keys, including revoked and expired ones. Keys themselves are never returned, only their prefixes.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=[]domain.APIKey}
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/api-keys [get]
+func (h *APIKeyHandler) List(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	keys, err := h.apiKeyService.List(c.Request().Context(), user.ID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to list API keys")
+	}
+
+	return response.Success(c, http.StatusOK, "API keys retrieved successfully", keys)
+}
+
+// Revoke godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the current user's API keys. It stops working immediately.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid API key ID")
+	}
+
+	if err := h.apiKeyService.Revoke(c.Request().Context(), user.ID, id); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			return response.Error(c, http.StatusNotFound, "API key not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to revoke API key")
+	}
+
+	return response.Success(c, http.StatusOK, "API key revoked successfully", nil)
+}
@@ -2,12 +2,16 @@ package handler
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 
 	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/service"
+	"go-echo-starter/pkg/jwt"
 	"go-echo-starter/pkg/logger"
 	"go-echo-starter/pkg/response"
 	"go-echo-starter/pkg/validator"
@@ -31,13 +35,13 @@ func NewAuthHandler(authService service.AuthService, v *validator.Validator, log
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with email and password
+// @Description Register a new user with email and password. A verification email is sent; when verification is required or enumeration-safe registration is enabled, no token is returned. In enumeration-safe mode an existing email gets the same response and its owner is notified by email.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body domain.RegisterRequest true "Registration details"
 // @Success 201 {object} response.Response{data=domain.TokenResponse}
-// @Failure 400 {object} response.Response
+// @Failure 400 {object} response.Response{errors=[]response.FieldError}
 // @Failure 409 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /api/v1/auth/register [post]
@@ -57,15 +61,25 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		if errors.Is(err, service.ErrEmailAlreadyExists) {
 			return response.Error(c, http.StatusConflict, "Email already exists")
 		}
+		if errors.Is(err, service.ErrPasswordTooLong) {
+			return response.Error(c, http.StatusBadRequest, "Password is too long")
+		}
+		if violated := new(service.PasswordPolicyError); errors.As(err, &violated) {
+			return passwordPolicyViolated(c, "password", violated)
+		}
 		return response.Error(c, http.StatusInternalServerError, "Failed to register user")
 	}
 
+	if token == nil {
+		return response.Success(c, http.StatusCreated, "User registered successfully, please verify your email address", nil)
+	}
+
 	return response.Success(c, http.StatusCreated, "User registered successfully", token)
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user with email and password
+// @Description Authenticate user with email and password. Users with two-factor authentication enabled receive an mfa_token to exchange at /auth/2fa/verify instead.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -73,6 +87,9 @@ func (h *AuthHandler) Register(c echo.Context) error {
 // @Success 200 {object} response.Response{data=domain.TokenResponse}
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 423 {object} response.Response
+// @Failure 429 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /api/v1/auth/login [post]
 func (h *AuthHandler) Login(c echo.Context) error {
@@ -91,12 +108,346 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			return response.Error(c, http.StatusUnauthorized, "Invalid email or password")
 		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			return response.Error(c, http.StatusForbidden, "Email address has not been verified")
+		}
+		if errors.Is(err, service.ErrInvalidScope) {
+			return response.Error(c, http.StatusBadRequest, "Requested scope is invalid or not permitted")
+		}
+		if throttled := new(service.LoginThrottledError); errors.As(err, &throttled) {
+			return loginThrottled(c, throttled)
+		}
 		return response.Error(c, http.StatusInternalServerError, "Failed to login")
 	}
 
+	if token.MFARequired {
+		return response.Success(c, http.StatusOK, "Two-factor authentication required", token)
+	}
+
 	return response.Success(c, http.StatusOK, "Login successful", token)
 }
 
+// Refresh godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a rotated refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body domain.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} response.Response{data=domain.TokenResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/refresh [post]
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var req domain.RefreshTokenRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind refresh request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	token, err := h.authService.Refresh(c.Request().Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			return response.Error(c, http.StatusUnauthorized, "Invalid or expired refresh token")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to refresh token")
+	}
+
+	return response.Success(c, http.StatusOK, "Token refreshed successfully", token)
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the current access token and, optionally, its refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param token body domain.LogoutRequest false "Refresh token to revoke"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/logout [post]
+func (h *AuthHandler) Logout(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.LogoutRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind logout request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.authService.Logout(c.Request().Context(), claims, &req); err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to logout")
+	}
+
+	return response.Success(c, http.StatusOK, "Logged out successfully", nil)
+}
+
+// ListSessions godoc
+// @Summary List sessions
+// @Description List the devices the current user is logged in on, most recently seen first. A session starts at login and is last seen when one of its access tokens was last used or its refresh token was last rotated (recorded at most once a minute); the one the request is made from is flagged as current.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=[]domain.Session}
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/sessions [get]
+func (h *AuthHandler) ListSessions(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	sessions, err := h.authService.ListSessions(c.Request().Context(), claims)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to list sessions")
+	}
+
+	return response.Success(c, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log the current user out of one device. Its refresh token and access tokens stop working immediately.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid session ID")
+	}
+
+	if err := h.authService.RevokeSession(c.Request().Context(), user.ID, id); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return response.Error(c, http.StatusNotFound, "Session not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to revoke session")
+	}
+
+	return response.Success(c, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// LogoutAll godoc
+// @Summary Logout everywhere
+// @Description Revoke every access token, refresh token and API key of the current user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	if err := h.authService.LogoutAll(c.Request().Context(), claims.UserID); err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to logout")
+	}
+
+	return response.Success(c, http.StatusOK, "Logged out of all sessions successfully", nil)
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a password reset link. Always responds with 202 so registered emails cannot be discovered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body domain.ForgotPasswordRequest true "Account email"
+// @Success 202 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(c echo.Context) error {
+	var req domain.ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind forgot password request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.authService.ForgotPassword(c.Request().Context(), &req); err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to request password reset")
+	}
+
+	return response.Success(c, http.StatusAccepted, "If the email is registered, a password reset link has been sent", nil)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a password reset token. All existing sessions and API keys are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body domain.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response{errors=[]response.FieldError}
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(c echo.Context) error {
+	var req domain.ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind reset password request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.authService.ResetPassword(c.Request().Context(), &req); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			return response.Error(c, http.StatusBadRequest, "Invalid or expired password reset token")
+		}
+		if errors.Is(err, service.ErrPasswordTooLong) {
+			return response.Error(c, http.StatusBadRequest, "Password is too long")
+		}
+		if violated := new(service.PasswordPolicyError); errors.As(err, &violated) {
+			return passwordPolicyViolated(c, "password", violated)
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to reset password")
+	}
+
+	return response.Success(c, http.StatusOK, "Password reset successfully", nil)
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the current user's password. Every other session and every API key is revoked and a new token pair is returned.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body domain.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} response.Response{data=domain.TokenResponse}
+// @Failure 400 {object} response.Response{errors=[]response.FieldError}
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/password [put]
+func (h *AuthHandler) ChangePassword(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind change password request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	token, err := h.authService.ChangePassword(c.Request().Context(), claims, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrIncorrectPassword) {
+			return response.Error(c, http.StatusBadRequest, "Current password is incorrect")
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusUnauthorized, "User not found")
+		}
+		if errors.Is(err, service.ErrPasswordTooLong) {
+			return response.Error(c, http.StatusBadRequest, "Password is too long")
+		}
+		if violated := new(service.PasswordPolicyError); errors.As(err, &violated) {
+			return passwordPolicyViolated(c, "new_password", violated)
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to change password")
+	}
+
+	return response.Success(c, http.StatusOK, "Password changed successfully", token)
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm an email address using the token from the verification email
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/verify [get]
+func (h *AuthHandler) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return response.Error(c, http.StatusBadRequest, "Missing verification token")
+	}
+
+	if err := h.authService.VerifyEmail(c.Request().Context(), token); err != nil {
+		if errors.Is(err, service.ErrInvalidVerifyToken) {
+			return response.Error(c, http.StatusBadRequest, "Invalid or expired verification token")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to verify email")
+	}
+
+	return response.Success(c, http.StatusOK, "Email verified successfully", nil)
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification email. Always responds with 202 so registered emails cannot be discovered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body domain.ResendVerificationRequest true "Account email"
+// @Success 202 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/verify/resend [post]
+func (h *AuthHandler) ResendVerification(c echo.Context) error {
+	var req domain.ResendVerificationRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind resend verification request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.authService.ResendVerification(c.Request().Context(), &req); err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to resend verification email")
+	}
+
+	return response.Success(c, http.StatusAccepted, "If the email is registered and unverified, a verification link has been sent", nil)
+}
+
 // GetMe godoc
 // @Summary Get current user
 // @Description Get the currently authenticated user's information
@@ -104,6 +455,7 @@ func (h *AuthHandler) Login(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Success 200 {object} response.Response{data=domain.AuthUser}
 // @Failure 401 {object} response.Response
 // @Router /api/v1/auth/me [get]
@@ -120,3 +472,346 @@ func (h *AuthHandler) GetMe(c echo.Context) error {
 
 	return response.Success(c, http.StatusOK, "User retrieved successfully", user)
 }
+
+// JWKS godoc
+// @Summary Get the JSON Web Key Set
+// @Description Publish the public keys access tokens are signed with, so other services can verify them. Tokens name their key in the kid header. Empty when tokens are signed with an HS256 shared secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwt.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// SetupTwoFactor godoc
+// @Summary Set up two-factor authentication
+// @Description Generate a new TOTP secret for the current user. It takes effect once confirmed via /auth/2fa/enable.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=domain.TwoFactorSetupResponse}
+// @Failure 401 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/2fa/setup [post]
+func (h *AuthHandler) SetupTwoFactor(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	setup, err := h.authService.SetupTwoFactor(c.Request().Context(), claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrTwoFactorAlreadyEnabled) {
+			return response.Error(c, http.StatusConflict, "Two-factor authentication is already enabled")
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusUnauthorized, "User not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+	}
+
+	return response.Success(c, http.StatusOK, "Scan the secret with an authenticator app and confirm it with a code", setup)
+}
+
+// EnableTwoFactor godoc
+// @Summary Enable two-factor authentication
+// @Description Confirm the pending TOTP secret with a code. Returns single-use recovery codes, which are shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body domain.TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} response.Response{data=domain.TwoFactorEnableResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/2fa/enable [post]
+func (h *AuthHandler) EnableTwoFactor(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind enable two-factor request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	codes, err := h.authService.EnableTwoFactor(c.Request().Context(), claims.UserID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			return response.Error(c, http.StatusBadRequest, "Invalid two-factor code")
+		}
+		if errors.Is(err, service.ErrTwoFactorNotSetUp) {
+			return response.Error(c, http.StatusBadRequest, "Two-factor authentication has not been set up")
+		}
+		if errors.Is(err, service.ErrTwoFactorAlreadyEnabled) {
+			return response.Error(c, http.StatusConflict, "Two-factor authentication is already enabled")
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusUnauthorized, "User not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+	}
+
+	return response.Success(c, http.StatusOK, "Two-factor authentication enabled", codes)
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Remove the TOTP enrollment of the current user, confirmed with a TOTP or recovery code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body domain.TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/2fa/disable [post]
+func (h *AuthHandler) DisableTwoFactor(c echo.Context) error {
+	claims, ok := c.Get("claims").(*jwt.Claims)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind disable two-factor request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.authService.DisableTwoFactor(c.Request().Context(), claims.UserID, &req); err != nil {
+		if errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			return response.Error(c, http.StatusBadRequest, "Invalid two-factor code")
+		}
+		if errors.Is(err, service.ErrTwoFactorNotEnabled) {
+			return response.Error(c, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusUnauthorized, "User not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+	}
+
+	return response.Success(c, http.StatusOK, "Two-factor authentication disabled", nil)
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete two-factor login
+// @Description Exchange the mfa_token from /auth/login and a TOTP or recovery code for a token pair. The mfa_token is single-use.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body domain.TwoFactorVerifyRequest true "MFA token and code"
+// @Success 200 {object} response.Response{data=domain.TokenResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 423 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c echo.Context) error {
+	var req domain.TwoFactorVerifyRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind verify two-factor request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	token, err := h.authService.VerifyTwoFactor(c.Request().Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMFAToken) {
+			return response.Error(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+		}
+		if errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			return response.Error(c, http.StatusUnauthorized, "Invalid two-factor code")
+		}
+		if errors.Is(err, service.ErrInvalidScope) {
+			return response.Error(c, http.StatusBadRequest, "Requested scope is invalid or not permitted")
+		}
+		if throttled := new(service.LoginThrottledError); errors.As(err, &throttled) {
+			return loginThrottled(c, throttled)
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to verify two-factor code")
+	}
+
+	return response.Success(c, http.StatusOK, "Login successful", token)
+}
+
+// OIDCAuthorize godoc
+// @Summary Start social login
+// @Description Redirect the user to the OpenID Connect provider to sign in. The provider redirects back to the callback endpoint.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/oidc/{provider}/authorize [get]
+func (h *AuthHandler) OIDCAuthorize(c echo.Context) error {
+	authURL, err := h.authService.OIDCAuthorize(c.Request().Context(), c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownOIDCProvider) {
+			return response.Error(c, http.StatusNotFound, "Unknown identity provider")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to start login with identity provider")
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback godoc
+// @Summary Complete social login
+// @Description Called by the OpenID Connect provider after the user signed in. The provider account is linked to the user with the same verified email, or to a new user, on first login. Users with two-factor authentication enabled get an mfa_token to complete via /auth/2fa/verify instead.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string true "Login state"
+// @Param error query string false "Error reported by the provider"
+// @Success 200 {object} response.Response{data=domain.TokenResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/oidc/{provider}/callback [get]
+func (h *AuthHandler) OIDCCallback(c echo.Context) error {
+	var req domain.OIDCCallbackRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind oidc callback request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	token, err := h.authService.OIDCCallback(c.Request().Context(), c.Param("provider"), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownOIDCProvider) {
+			return response.Error(c, http.StatusNotFound, "Unknown identity provider")
+		}
+		if errors.Is(err, service.ErrInvalidOIDCState) {
+			return response.Error(c, http.StatusBadRequest, "Invalid or expired login state, please start again")
+		}
+		if errors.Is(err, service.ErrOIDCLoginFailed) {
+			return response.Error(c, http.StatusUnauthorized, "Login with identity provider failed")
+		}
+		if errors.Is(err, service.ErrOIDCEmailNotVerified) {
+			return response.Error(c, http.StatusForbidden, "Identity provider did not confirm a verified email address")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to log in with identity provider")
+	}
+
+	if token.MFARequired {
+		return response.Success(c, http.StatusOK, "Two-factor authentication required", token)
+	}
+
+	return response.Success(c, http.StatusOK, "Login successful", token)
+}
+
+// RequestMagicLink godoc
+// @Summary Request a login link
+// @Description Email a single-use passwordless login link. Always responds with 202 so registered emails cannot be discovered; requests over the per-email rate limit are dropped silently.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body domain.MagicLinkRequest true "Account email"
+// @Success 202 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/magic-link [post]
+func (h *AuthHandler) RequestMagicLink(c echo.Context) error {
+	var req domain.MagicLinkRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind magic link request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.authService.RequestMagicLink(c.Request().Context(), &req); err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to request login link")
+	}
+
+	return response.Success(c, http.StatusAccepted, "If the email is registered, a login link has been sent", nil)
+}
+
+// ConsumeMagicLink godoc
+// @Summary Log in with a login link
+// @Description Exchange the token from a login link for a token pair. Users with two-factor authentication enabled get an mfa_token to complete via /auth/2fa/verify instead. Locked out accounts and clients are refused with 429 and keep their link.
+// @Tags auth
+// @Produce json
+// @Param token query string true "Login link token"
+// @Success 200 {object} response.Response{data=domain.TokenResponse}
+// @Failure 400 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/auth/magic-link/consume [get]
+func (h *AuthHandler) ConsumeMagicLink(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return response.Error(c, http.StatusBadRequest, "Missing login link token")
+	}
+
+	tokens, err := h.authService.ConsumeMagicLink(c.Request().Context(), token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMagicLink) {
+			return response.Error(c, http.StatusBadRequest, "Invalid or expired login link")
+		}
+		if throttled := new(service.LoginThrottledError); errors.As(err, &throttled) {
+			return loginThrottled(c, throttled)
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to log in with login link")
+	}
+
+	if tokens.MFARequired {
+		return response.Success(c, http.StatusOK, "Two-factor authentication required", tokens)
+	}
+
+	return response.Success(c, http.StatusOK, "Login successful", tokens)
+}
+
+// loginThrottled responds to a login refused because of earlier failures,
+// telling the client when to retry
+func loginThrottled(c echo.Context, err *service.LoginThrottledError) error {
+	retryAfter := int(math.Ceil(err.RetryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	if errors.Is(err, service.ErrAccountLocked) {
+		return response.Error(c, http.StatusLocked, "Account is temporarily locked after too many failed login attempts")
+	}
+	return response.Error(c, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+}
+
+// passwordPolicyViolated responds to a new password that breaks the password policy,
+// listing every broken rule as an error on the given field
+func passwordPolicyViolated(c echo.Context, field string, err *service.PasswordPolicyError) error {
+	fieldErrors := make([]response.FieldError, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		fieldErrors = append(fieldErrors, response.FieldError{Field: field, Rule: v.Rule, Message: v.Message})
+	}
+	return response.ErrorWithDetails(c, http.StatusBadRequest, "Password does not meet the password policy", fieldErrors)
+}
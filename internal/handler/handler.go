@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"github.com/labstack/echo/v4"
+
+	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/service"
 	"go-echo-starter/pkg/logger"
 	"go-echo-starter/pkg/validator"
@@ -10,6 +13,8 @@ import (
 type Handler struct {
 	User      *UserHandler
 	Auth      *AuthHandler
+	APIKey    *APIKeyHandler
+	OAuth     *OAuthHandler
 	validator *validator.Validator
 	log       *logger.Logger
 }
@@ -18,13 +23,23 @@ type Handler struct {
 func NewHandler(
 	userService service.UserService,
 	authService service.AuthService,
+	apiKeyService service.APIKeyService,
+	oauthService service.OAuthService,
 	v *validator.Validator,
 	log *logger.Logger,
 ) *Handler {
 	return &Handler{
 		User:      NewUserHandler(userService, v, log),
 		Auth:      NewAuthHandler(authService, v, log),
+		APIKey:    NewAPIKeyHandler(apiKeyService, v, log),
+		OAuth:     NewOAuthHandler(oauthService, v, log),
 		validator: v,
 		log:       log,
 	}
 }
+
+// authUserFromContext returns the authenticated user set by the JWT middleware
+func authUserFromContext(c echo.Context) (*domain.AuthUser, bool) {
+	user, ok := c.Get("user").(*domain.AuthUser)
+	return user, ok
+}
@@ -0,0 +1,446 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/service"
+	"go-echo-starter/pkg/logger"
+	"go-echo-starter/pkg/response"
+	"go-echo-starter/pkg/validator"
+)
+
+// OAuthHandler handles OAuth2 authorization server HTTP requests.
+// The token, introspection and revocation endpoints are called by clients and
+// answer in the plain JSON format of the OAuth2 specifications; the others are
+// called by the frontend and use the usual response envelope.
+type OAuthHandler struct {
+	oauthService service.OAuthService
+	validator    *validator.Validator
+	log          *logger.Logger
+}
+
+// NewOAuthHandler creates a new OAuth handler
+func NewOAuthHandler(oauthService service.OAuthService, v *validator.Validator, log *logger.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: oauthService,
+		validator:    v,
+		log:          log,
+	}
+}
+
+// RegisterClient godoc
+// @Summary Register an OAuth client
+// @Description Register a third-party application. Confidential clients get a client_secret, which is only shown in this response; public clients, such as mobile apps, get none and must register a redirect URI. Scopes default to, and may not exceed, the scopes of the caller's token.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body domain.CreateOAuthClientRequest true "Client name, redirect URIs and scopes"
+// @Success 201 {object} response.Response{data=domain.CreateOAuthClientResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/clients [post]
+func (h *OAuthHandler) RegisterClient(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.CreateOAuthClientRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind register OAuth client request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	client, err := h.oauthService.RegisterClient(c.Request().Context(), user, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			return response.Error(c, http.StatusBadRequest, "Requested scope is invalid or not permitted")
+		}
+		if errors.Is(err, service.ErrInvalidRedirectURI) {
+			return response.Error(c, http.StatusBadRequest, "Redirect URIs must use https, http on a loopback host or an allowed custom scheme and have no fragment, and public clients need at least one")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to register OAuth client")
+	}
+
+	return response.Success(c, http.StatusCreated, "OAuth client registered successfully", client)
+}
+
+// ListClients godoc
+// @Summary List OAuth clients
+// @Description List every registered third-party application. Client secrets are never returned.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=[]domain.OAuthClient}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/clients [get]
+func (h *OAuthHandler) ListClients(c echo.Context) error {
+	clients, err := h.oauthService.ListClients(c.Request().Context())
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to list OAuth clients")
+	}
+
+	return response.Success(c, http.StatusOK, "OAuth clients retrieved successfully", clients)
+}
+
+// DeleteClient godoc
+// @Summary Delete an OAuth client
+// @Description Delete a third-party application along with its refresh tokens and the consents given to it. Access tokens already issued to it stay valid until they expire.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Client ID"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/clients/{id} [delete]
+func (h *OAuthHandler) DeleteClient(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid client ID")
+	}
+
+	if err := h.oauthService.DeleteClient(c.Request().Context(), id); err != nil {
+		if errors.Is(err, service.ErrOAuthClientNotFound) {
+			return response.Error(c, http.StatusNotFound, "OAuth client not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to delete OAuth client")
+	}
+
+	return response.Success(c, http.StatusOK, "OAuth client deleted successfully", nil)
+}
+
+// Authorize godoc
+// @Summary Start an OAuth authorization
+// @Description Called by the frontend with the query of a client's authorization request, on behalf of the signed-in user. A PKCE code challenge with the S256 method is required. If the user already consented to the requested scopes, redirect_to holds the redirect back to the client with an authorization code; otherwise consent_required is set and the frontend must ask the user and post the decision back. Errors the client should see are also returned in redirect_to.
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "Registered redirect URI, required if the client has several"
+// @Param scope query string false "Space-delimited scopes"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} response.Response{data=domain.OAuthAuthorizeResponse}
+// @Failure 400 {object} response.Response{errors=domain.OAuthErrorResponse}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/authorize [get]
+func (h *OAuthHandler) Authorize(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.OAuthAuthorizeRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind OAuth authorize request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request query")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	resp, err := h.oauthService.Authorize(c.Request().Context(), user, &req)
+	if err != nil {
+		return authorizeError(c, err)
+	}
+
+	return response.Success(c, http.StatusOK, "Authorization request accepted", resp)
+}
+
+// Consent godoc
+// @Summary Consent to an OAuth authorization
+// @Description Submit the user's decision on an authorization request, with the same parameters as the request itself. redirect_to holds the redirect back to the client, with an authorization code if the user approved or an access_denied error otherwise.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body domain.OAuthConsentRequest true "Authorization request and decision"
+// @Success 200 {object} response.Response{data=domain.OAuthAuthorizeResponse}
+// @Failure 400 {object} response.Response{errors=domain.OAuthErrorResponse}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/authorize [post]
+func (h *OAuthHandler) Consent(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	var req domain.OAuthConsentRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind OAuth consent request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	resp, err := h.oauthService.Consent(c.Request().Context(), user, &req)
+	if err != nil {
+		return authorizeError(c, err)
+	}
+
+	return response.Success(c, http.StatusOK, "Consent recorded", resp)
+}
+
+// Token godoc
+// @Summary OAuth token endpoint
+// @Description Exchange an authorization code (with its PKCE code_verifier and redirect_uri) or a refresh token for tokens, or get a token for a confidential client itself with client_credentials, limited to the client's non-admin scopes its owner still has. Clients authenticate with HTTP Basic or client_id and client_secret in the body; public clients send only client_id. Errors follow RFC 6749 section 5.2.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Space-delimited scopes"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 {object} domain.TokenResponse
+// @Failure 400 {object} domain.OAuthErrorResponse
+// @Failure 401 {object} domain.OAuthErrorResponse
+// @Failure 500 {object} domain.OAuthErrorResponse
+// @Router /api/v1/oauth/token [post]
+func (h *OAuthHandler) Token(c echo.Context) error {
+	var req domain.OAuthTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return oauthErrorResponse(c, service.OAuthInvalidRequest, "malformed request body")
+	}
+
+	creds, err := clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return h.oauthFailure(c, err)
+	}
+
+	token, err := h.oauthService.Token(c.Request().Context(), creds, &req)
+	if err != nil {
+		return h.oauthFailure(c, err)
+	}
+
+	noStore(c)
+	return c.JSON(http.StatusOK, token)
+}
+
+// Introspect godoc
+// @Summary OAuth token introspection
+// @Description Report whether a token is active, with its scope, client and subject (RFC 7662). Only confidential clients may call it. Access tokens of any client can be introspected, refresh tokens only by the client they were issued to; anything else is reported as inactive.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token, ignored"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 {object} domain.OAuthIntrospectionResponse
+// @Failure 400 {object} domain.OAuthErrorResponse
+// @Failure 401 {object} domain.OAuthErrorResponse
+// @Failure 500 {object} domain.OAuthErrorResponse
+// @Router /api/v1/oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c echo.Context) error {
+	var req domain.OAuthTokenActionRequest
+	if err := c.Bind(&req); err != nil {
+		return oauthErrorResponse(c, service.OAuthInvalidRequest, "malformed request body")
+	}
+
+	creds, err := clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return h.oauthFailure(c, err)
+	}
+
+	resp, err := h.oauthService.Introspect(c.Request().Context(), creds, &req)
+	if err != nil {
+		return h.oauthFailure(c, err)
+	}
+
+	noStore(c)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Revoke godoc
+// @Summary OAuth token revocation
+// @Description Revoke an access token, or a refresh token along with the tokens rotated from it (RFC 7009). Tokens that are unknown or were issued to another client are ignored, so the response is the same either way.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token, ignored"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200
+// @Failure 400 {object} domain.OAuthErrorResponse
+// @Failure 401 {object} domain.OAuthErrorResponse
+// @Failure 500 {object} domain.OAuthErrorResponse
+// @Router /api/v1/oauth/revoke [post]
+func (h *OAuthHandler) Revoke(c echo.Context) error {
+	var req domain.OAuthTokenActionRequest
+	if err := c.Bind(&req); err != nil {
+		return oauthErrorResponse(c, service.OAuthInvalidRequest, "malformed request body")
+	}
+
+	creds, err := clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return h.oauthFailure(c, err)
+	}
+
+	if err := h.oauthService.Revoke(c.Request().Context(), creds, &req); err != nil {
+		return h.oauthFailure(c, err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// ListConsents godoc
+// @Summary List OAuth consents
+// @Description List the third-party applications the current user has given access to, with the scopes each one was allowed
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=[]domain.OAuthConsent}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/consents [get]
+func (h *OAuthHandler) ListConsents(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	consents, err := h.oauthService.ListConsents(c.Request().Context(), user.ID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to list OAuth consents")
+	}
+
+	return response.Success(c, http.StatusOK, "OAuth consents retrieved successfully", consents)
+}
+
+// RevokeConsent godoc
+// @Summary Revoke an OAuth consent
+// @Description Withdraw the current user's consent to a third-party application and revoke its refresh tokens. Its access tokens stay valid until they expire.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/oauth/consents/{client_id} [delete]
+func (h *OAuthHandler) RevokeConsent(c echo.Context) error {
+	user, ok := authUserFromContext(c)
+	if !ok {
+		return response.Error(c, http.StatusUnauthorized, "User context not found")
+	}
+
+	clientID, err := uuid.Parse(c.Param("client_id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid client ID")
+	}
+
+	if err := h.oauthService.RevokeConsent(c.Request().Context(), user.ID, clientID); err != nil {
+		if errors.Is(err, service.ErrOAuthConsentNotFound) {
+			return response.Error(c, http.StatusNotFound, "OAuth consent not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to revoke OAuth consent")
+	}
+
+	return response.Success(c, http.StatusOK, "OAuth consent revoked successfully", nil)
+}
+
+// oauthFailure writes the error of a client-facing endpoint in the OAuth2 format
+func (h *OAuthHandler) oauthFailure(c echo.Context, err error) error {
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		if oauthErr.Code == service.OAuthInvalidClient && c.Request().Header.Get("Authorization") != "" {
+			c.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		return oauthErrorResponse(c, oauthErr.Code, oauthErr.Description)
+	}
+	return oauthErrorResponse(c, "server_error", "")
+}
+
+// authorizeError writes an authorization error that cannot be sent back to the client
+func authorizeError(c echo.Context, err error) error {
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		return response.ErrorWithDetails(c, http.StatusBadRequest, oauthErr.Description,
+			domain.OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description},
+		)
+	}
+	return response.Error(c, http.StatusInternalServerError, "Failed to process authorization request")
+}
+
+// oauthErrorResponse writes an OAuth2 error response (RFC 6749 section 5.2).
+// invalid_client is reported with 401, server_error with 500 and everything else with 400.
+func oauthErrorResponse(c echo.Context, code, description string) error {
+	status := http.StatusBadRequest
+	switch code {
+	case service.OAuthInvalidClient:
+		status = http.StatusUnauthorized
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+
+	noStore(c)
+	return c.JSON(status, domain.OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// clientCredentials returns the credentials the client sent with HTTP Basic, whose
+// parts are form-encoded (RFC 6749 section 2.3.1), or else in the request body.
+// Using both at once is an error.
+func clientCredentials(c echo.Context, bodyID, bodySecret string) (domain.OAuthClientCredentials, error) {
+	id, secret, ok := c.Request().BasicAuth()
+	if !ok {
+		return domain.OAuthClientCredentials{ID: bodyID, Secret: bodySecret}, nil
+	}
+	if bodySecret != "" {
+		return domain.OAuthClientCredentials{}, &service.OAuthError{Code: service.OAuthInvalidRequest, Description: "use only one client authentication method"}
+	}
+
+	id, idErr := url.QueryUnescape(id)
+	secret, secretErr := url.QueryUnescape(secret)
+	if idErr != nil || secretErr != nil {
+		return domain.OAuthClientCredentials{}, &service.OAuthError{Code: service.OAuthInvalidClient, Description: "malformed client credentials"}
+	}
+
+	return domain.OAuthClientCredentials{ID: id, Secret: secret}, nil
+}
+
+// noStore forbids caching a response holding tokens (RFC 6749 section 5.1)
+func noStore(c echo.Context) {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+}
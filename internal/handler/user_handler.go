@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"io"
+	"mime"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -9,6 +13,7 @@ import (
 
 	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/service"
+	"go-echo-starter/pkg/jsonpatch"
 	"go-echo-starter/pkg/logger"
 	"go-echo-starter/pkg/response"
 	"go-echo-starter/pkg/validator"
@@ -37,6 +42,7 @@ func NewUserHandler(userService service.UserService, v *validator.Validator, log
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param user body domain.CreateUserRequest true "User details"
 // @Success 201 {object} response.Response{data=domain.UserResponse}
 // @Failure 400 {object} response.Response
@@ -67,13 +73,15 @@ func (h *UserHandler) Create(c echo.Context) error {
 
 // GetByID godoc
 // @Summary Get user by ID
-// @Description Get a user by their ID
+// @Description Get a user by their ID. Tokens without users:manage may only get their own record.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "User ID"
 // @Success 200 {object} response.Response{data=domain.UserResponse}
+// @Failure 403 {object} response.Response
 // @Failure 404 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /api/v1/users/{id} [get]
@@ -83,6 +91,10 @@ func (h *UserHandler) GetByID(c echo.Context) error {
 		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
 	}
 
+	if !canAccessUser(c, id) {
+		return response.Error(c, http.StatusForbidden, "Insufficient permissions")
+	}
+
 	user, err := h.userService.GetByID(c.Request().Context(), id)
 	if err != nil {
 		if errors.Is(err, service.ErrUserNotFound) {
@@ -95,35 +107,119 @@ func (h *UserHandler) GetByID(c echo.Context) error {
 }
 
 // GetAll godoc
-// @Summary Get all users
-// @Description Get a list of all users
+// @Summary List users
+// @Description Get a page of users, optionally filtered by name, email and creation time. meta holds the total count and links the neighbouring pages.
+// @Description Passing limit or cursor instead of page and per_page pages by cursor, which is stable under concurrent inserts and does not count the users; meta then holds the cursors of the neighbouring pages. It only supports sorting by created_at.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param page query int false "Page number, from 1" minimum(1) default(1)
+// @Param per_page query int false "Users per page" minimum(1) maximum(100) default(20)
+// @Param limit query int false "Users per page, paging by cursor" minimum(1) maximum(100) default(20)
+// @Param cursor query string false "Cursor of the page, from meta or links of the previous response"
+// @Param name query string false "Name contains (case-insensitive)"
+// @Param email query string false "Email contains (case-insensitive)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param sort query string false "Sort field, prefixed with - for descending order" Enums(name, -name, email, -email, created_at, -created_at) default(created_at)
+// @Param include_deleted query bool false "Also list deleted users that have not been purged yet" default(false)
 // @Success 200 {object} response.Response{data=[]domain.UserResponse}
+// @Failure 400 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /api/v1/users [get]
 func (h *UserHandler) GetAll(c echo.Context) error {
-	users, err := h.userService.GetAll(c.Request().Context())
+	var req domain.ListUsersRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind list users request")
+		return response.Error(c, http.StatusBadRequest, "Invalid query parameters")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if req.Keyset() {
+		return h.getAllByCursor(c, &req)
+	}
+
+	users, total, err := h.userService.GetAll(c.Request().Context(), &req)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to get users")
+	}
+
+	page := response.NewPagination(req.PageNumber(), req.PageSize(), total)
+	return response.Paginated(c, "Users retrieved successfully", users, page)
+}
+
+// getAllByCursor lists the page of users at the cursor of req
+func (h *UserHandler) getAllByCursor(c echo.Context, req *domain.ListUsersRequest) error {
+	if req.Page != 0 || req.PerPage != 0 {
+		return response.Error(c, http.StatusBadRequest, "Use either page and per_page or limit and cursor")
+	}
+	if req.Sort != "" && req.Sort != "created_at" && req.Sort != "-created_at" {
+		return response.Error(c, http.StatusBadRequest, "Paging by cursor only supports sorting by created_at")
+	}
+
+	users, cursors, err := h.userService.GetAllByCursor(c.Request().Context(), req)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return response.Error(c, http.StatusBadRequest, "Invalid cursor")
+		}
 		return response.Error(c, http.StatusInternalServerError, "Failed to get users")
 	}
 
-	return response.Success(c, http.StatusOK, "Users retrieved successfully", users)
+	page := &response.CursorPagination{Limit: req.PageLimit(), NextCursor: cursors.Next, PrevCursor: cursors.Prev}
+	return response.CursorPaginated(c, "Users retrieved successfully", users, page)
+}
+
+// Search godoc
+// @Summary Search users
+// @Description Search users by name and email, best match first. Whole words are matched by full-text search and misspelled or partial words by similarity; the highlights hold the HTML-escaped name and email with matching words wrapped in <mark> tags.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param q query string true "Search terms" minlength(2) maxlength(255)
+// @Param limit query int false "Maximum number of results" minimum(1) maximum(100) default(20)
+// @Success 200 {object} response.Response{data=[]domain.UserSearchResponse}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/users/search [get]
+func (h *UserHandler) Search(c echo.Context) error {
+	var req domain.SearchUsersRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind search users request")
+		return response.Error(c, http.StatusBadRequest, "Invalid query parameters")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	results, err := h.userService.Search(c.Request().Context(), &req)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, "Failed to search users")
+	}
+
+	return response.Success(c, http.StatusOK, "Users retrieved successfully", results)
 }
 
 // Update godoc
 // @Summary Update a user
-// @Description Update a user by their ID
+// @Description Update a user by their ID. Tokens without users:manage may only update their own record.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "User ID"
 // @Param user body domain.UpdateUserRequest true "User details"
 // @Success 200 {object} response.Response{data=domain.UserResponse}
 // @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
 // @Failure 404 {object} response.Response
 // @Failure 409 {object} response.Response
 // @Failure 500 {object} response.Response
@@ -134,6 +230,10 @@ func (h *UserHandler) Update(c echo.Context) error {
 		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
 	}
 
+	if !canAccessUser(c, id) {
+		return response.Error(c, http.StatusForbidden, "Insufficient permissions")
+	}
+
 	var req domain.UpdateUserRequest
 	if err := c.Bind(&req); err != nil {
 		h.log.Warn().Err(err).Msg("Failed to bind update user request")
@@ -158,13 +258,189 @@ func (h *UserHandler) Update(c echo.Context) error {
 	return response.Success(c, http.StatusOK, "User updated successfully", user)
 }
 
+// Patch godoc
+// @Summary Partially update a user
+// @Description Update some fields of a user by their ID with a JSON Merge Patch (RFC 7396): members left out are unchanged, null removes one. A JSON Patch (RFC 6902) is accepted as well. The patch applies to {"name", "email"} and the patched document must be a valid user. Test operations are checked against the state the patch is saved over. Tokens without users:manage may only update their own record.
+// @Tags users
+// @Accept application/merge-patch+json,application/json-patch+json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Param patch body object true "Merge patch or JSON Patch of the user document"
+// @Success 200 {object} response.Response{data=domain.UserResponse}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 415 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/users/{id} [patch]
+func (h *UserHandler) Patch(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if !canAccessUser(c, id) {
+		return response.Error(c, http.StatusForbidden, "Insufficient permissions")
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case jsonpatch.MergePatchType:
+		apply = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchType:
+		apply = jsonpatch.Apply
+	default:
+		c.Response().Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		return response.Error(c, http.StatusUnsupportedMediaType, "Unsupported patch format")
+	}
+
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	// The patch is applied inside the service so that it sees the state it is saved over.
+	// Errors of the patched document are kept aside to be reported as such.
+	var invalid error
+	user, err := h.userService.Patch(c.Request().Context(), id, func(current *domain.UserDocument) (*domain.UserPatch, error) {
+		doc, err := json.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+
+		patched, err := apply(doc, patch)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only the fields of the document may be patched
+		var result domain.UserDocument
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&result); err != nil {
+			invalid = errors.New("the patched user is not a valid user document")
+			return nil, invalid
+		}
+
+		if err := h.validator.Validate(&result); err != nil {
+			invalid = err
+			return nil, invalid
+		}
+
+		return result.Diff(current), nil
+	})
+	if err != nil {
+		if invalid != nil {
+			return response.ValidationError(c, invalid)
+		}
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return response.Error(c, http.StatusConflict, "Patch test failed")
+		}
+		if errors.Is(err, jsonpatch.ErrInvalidPatch) {
+			h.log.Warn().Err(err).Msg("Failed to apply user patch")
+			return response.Error(c, http.StatusBadRequest, "Invalid patch")
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusNotFound, "User not found")
+		}
+		if errors.Is(err, service.ErrEmailExists) {
+			return response.Error(c, http.StatusConflict, "Email already exists")
+		}
+		if errors.Is(err, service.ErrUserModified) {
+			return response.Error(c, http.StatusConflict, "User was modified concurrently, try again")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to update user")
+	}
+
+	return response.Success(c, http.StatusOK, "User updated successfully", user)
+}
+
+// UpdateRole godoc
+// @Summary Change a user's role
+// @Description Change the role of a user by their ID (admin only)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Param role body domain.UpdateRoleRequest true "New role"
+// @Success 200 {object} response.Response{data=domain.UserResponse}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/users/{id}/role [put]
+func (h *UserHandler) UpdateRole(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var req domain.UpdateRoleRequest
+	if err := c.Bind(&req); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to bind update role request")
+		return response.Error(c, http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := h.validator.Validate(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	user, err := h.userService.UpdateRole(c.Request().Context(), id, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusNotFound, "User not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to update user role")
+	}
+
+	return response.Success(c, http.StatusOK, "User role updated successfully", user)
+}
+
+// Unlock godoc
+// @Summary Unlock a user
+// @Description Lift a login lockout caused by repeated failed attempts (admin only)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/users/{id}/unlock [post]
+func (h *UserHandler) Unlock(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := h.userService.Unlock(c.Request().Context(), id); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusNotFound, "User not found")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to unlock user")
+	}
+
+	return response.Success(c, http.StatusOK, "User unlocked successfully", nil)
+}
+
 // Delete godoc
 // @Summary Delete a user
-// @Description Delete a user by their ID
+// @Description Soft-delete a user by their ID. The user can no longer sign in and is left out of every listing, but can be restored until it is purged after the retention period.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "User ID"
 // @Success 200 {object} response.Response
 // @Failure 404 {object} response.Response
@@ -186,3 +462,45 @@ func (h *UserHandler) Delete(c echo.Context) error {
 
 	return response.Success(c, http.StatusOK, "User deleted successfully", nil)
 }
+
+// Restore godoc
+// @Summary Restore a deleted user
+// @Description Restore a soft-deleted user that has not been purged yet
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} response.Response{data=domain.UserResponse}
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /api/v1/users/{id}/restore [post]
+func (h *UserHandler) Restore(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	user, err := h.userService.Restore(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return response.Error(c, http.StatusNotFound, "Deleted user not found")
+		}
+		if errors.Is(err, service.ErrEmailExists) {
+			return response.Error(c, http.StatusConflict, "Another user has taken the email address")
+		}
+		return response.Error(c, http.StatusInternalServerError, "Failed to restore user")
+	}
+
+	return response.Success(c, http.StatusOK, "User restored successfully", user)
+}
+
+// canAccessUser reports whether the authenticated user may access the given user record.
+// Tokens granted users:manage may access every record, other tokens only their own.
+func canAccessUser(c echo.Context, id uuid.UUID) bool {
+	user, ok := authUserFromContext(c)
+	return ok && (user.HasScope(domain.PermUsersManage) || user.ID == id)
+}
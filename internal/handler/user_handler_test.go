@@ -14,6 +14,8 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/middleware"
+	"go-echo-starter/internal/service"
 	"go-echo-starter/pkg/logger"
 	"go-echo-starter/pkg/validator"
 )
@@ -38,12 +40,47 @@ func (m *MockUserServiceReal) GetByID(ctx context.Context, id uuid.UUID) (*domai
 	return args.Get(0).(*domain.UserResponse), args.Error(1)
 }
 
-func (m *MockUserServiceReal) GetAll(ctx context.Context) ([]*domain.UserResponse, error) {
-	args := m.Called(ctx)
+func (m *MockUserServiceReal) GetAll(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.UserResponse, int, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]*domain.UserResponse), args.Int(1), args.Error(2)
+}
+
+func (m *MockUserServiceReal) GetAllByCursor(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.UserResponse, *domain.CursorPage, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).([]*domain.UserResponse), args.Get(1).(*domain.CursorPage), args.Error(2)
+}
+
+func (m *MockUserServiceReal) Search(ctx context.Context, req *domain.SearchUsersRequest) ([]*domain.UserSearchResponse, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.UserSearchResponse), args.Error(1)
+}
+
+// Patch runs apply on the document set up for Patch and hands the changes to SavePatch
+func (m *MockUserServiceReal) Patch(ctx context.Context, id uuid.UUID, apply domain.UserPatchFunc) (*domain.UserResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	patch, err := apply(args.Get(0).(*domain.UserDocument))
+	if err != nil {
+		return nil, err
+	}
+
+	args = m.MethodCalled("SavePatch", patch)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]*domain.UserResponse), args.Error(1)
+	return args.Get(0).(*domain.UserResponse), args.Error(1)
 }
 
 func (m *MockUserServiceReal) Update(ctx context.Context, id uuid.UUID, req *domain.UpdateUserRequest) (*domain.UserResponse, error) {
@@ -54,11 +91,32 @@ func (m *MockUserServiceReal) Update(ctx context.Context, id uuid.UUID, req *dom
 	return args.Get(0).(*domain.UserResponse), args.Error(1)
 }
 
+func (m *MockUserServiceReal) UpdateRole(ctx context.Context, id uuid.UUID, req *domain.UpdateRoleRequest) (*domain.UserResponse, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserResponse), args.Error(1)
+}
+
+func (m *MockUserServiceReal) Unlock(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
 func (m *MockUserServiceReal) Delete(ctx context.Context, id uuid.UUID) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockUserServiceReal) Restore(ctx context.Context, id uuid.UUID) (*domain.UserResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserResponse), args.Error(1)
+}
+
 func TestUserHandler_Create(t *testing.T) {
 	e := echo.New()
 	v := validator.New()
@@ -94,3 +152,528 @@ func TestUserHandler_Create(t *testing.T) {
 		}
 	})
 }
+
+func TestUserHandler_GetByID(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	newContext := func(id uuid.UUID, user *domain.AuthUser) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/"+id.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id.String())
+		c.Set("user", user)
+		return c, rec
+	}
+
+	t.Run("own record", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		c, rec := newContext(id, &domain.AuthUser{ID: id, Role: domain.RoleUser})
+
+		mockSvc.On("GetByID", mock.Anything, id).Return(&domain.UserResponse{ID: id}, nil)
+
+		if assert.NoError(t, h.GetByID(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("other user's record is forbidden", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext(uuid.New(), &domain.AuthUser{ID: uuid.New(), Role: domain.RoleUser})
+
+		if assert.NoError(t, h.GetByID(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+		mockSvc.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin may read any record", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		c, rec := newContext(id, &domain.AuthUser{ID: uuid.New(), Role: domain.RoleAdmin, Scopes: []string{"users:manage"}})
+
+		mockSvc.On("GetByID", mock.Anything, id).Return(&domain.UserResponse{ID: id}, nil)
+
+		if assert.NoError(t, h.GetByID(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("admin token without users:manage is limited to own record", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext(uuid.New(), &domain.AuthUser{ID: uuid.New(), Role: domain.RoleAdmin, Scopes: []string{"users:read"}})
+
+		if assert.NoError(t, h.GetByID(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+		mockSvc.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+
+	t.Run("missing scope names the scope", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		c, rec := newContext(id, &domain.AuthUser{ID: id, Role: domain.RoleUser, Scopes: []string{"users:write"}})
+
+		handler := middleware.RequireScope(domain.PermUsersRead)(h.GetByID)
+		if assert.NoError(t, handler(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			var res map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &res)
+			assert.Contains(t, res["message"], "users:read")
+			errs := res["errors"].(map[string]interface{})
+			assert.Equal(t, []interface{}{"users:read"}, errs["missing_scopes"])
+		}
+		mockSvc.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserHandler_GetAll(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	newContext := func(query string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users?"+query, nil)
+		rec := httptest.NewRecorder()
+		return e.NewContext(req, rec), rec
+	}
+
+	t.Run("filters and links the neighbouring pages", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("page=2&per_page=10&email=example.com&created_after=2024-01-01T00:00:00Z&sort=-name")
+
+		mockSvc.On("GetAll", mock.Anything, mock.MatchedBy(func(req *domain.ListUsersRequest) bool {
+			return req.Page == 2 && req.PerPage == 10 && req.Email == "example.com" && req.Sort == "-name" &&
+				req.CreatedAfter != nil && req.CreatedAfter.Year() == 2024 && req.CreatedBefore == nil
+		})).Return([]*domain.UserResponse{{ID: uuid.New()}}, 35, nil)
+
+		if assert.NoError(t, h.GetAll(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var res map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &res)
+
+			meta := res["meta"].(map[string]interface{})
+			assert.Equal(t, float64(35), meta["total"])
+			assert.Equal(t, float64(4), meta["total_pages"])
+
+			links := res["links"].(map[string]interface{})
+			assert.Contains(t, links["next"], "page=3")
+			assert.Contains(t, links["next"], "email=example.com")
+			assert.Contains(t, links["prev"], "page=1")
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("defaults to the first page", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("")
+
+		mockSvc.On("GetAll", mock.Anything, mock.Anything).Return([]*domain.UserResponse{}, 0, nil)
+
+		if assert.NoError(t, h.GetAll(c)) {
+			var res map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &res)
+
+			meta := res["meta"].(map[string]interface{})
+			assert.Equal(t, float64(1), meta["page"])
+			assert.Equal(t, float64(domain.DefaultPerPage), meta["per_page"])
+
+			links := res["links"].(map[string]interface{})
+			assert.Nil(t, links["next"])
+			assert.Nil(t, links["prev"])
+		}
+	})
+
+	t.Run("rejects unknown sort fields and oversized pages", func(t *testing.T) {
+		for _, query := range []string{"sort=password", "per_page=1000", "page=-1"} {
+			mockSvc := new(MockUserServiceReal)
+			h := NewUserHandler(mockSvc, v, log)
+
+			c, rec := newContext(query)
+
+			if assert.NoError(t, h.GetAll(c)) {
+				assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+			}
+			mockSvc.AssertNotCalled(t, "GetAll", mock.Anything, mock.Anything)
+		}
+	})
+
+	t.Run("pages by cursor", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("limit=10&cursor=abc.def&name=jo")
+
+		mockSvc.On("GetAllByCursor", mock.Anything, mock.MatchedBy(func(req *domain.ListUsersRequest) bool {
+			return req.Cursor == "abc.def" && req.Limit == 10 && req.Name == "jo"
+		})).Return([]*domain.UserResponse{{ID: uuid.New()}}, &domain.CursorPage{Next: "next.sig"}, nil)
+
+		if assert.NoError(t, h.GetAll(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var res map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &res)
+
+			meta := res["meta"].(map[string]interface{})
+			assert.Equal(t, float64(10), meta["limit"])
+			assert.Equal(t, "next.sig", meta["next_cursor"])
+			assert.Nil(t, meta["prev_cursor"])
+
+			links := res["links"].(map[string]interface{})
+			assert.Contains(t, links["next"], "cursor=next.sig")
+			assert.Contains(t, links["next"], "name=jo")
+			assert.Nil(t, links["prev"])
+		}
+		mockSvc.AssertNotCalled(t, "GetAll", mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("cursor=forged")
+
+		mockSvc.On("GetAllByCursor", mock.Anything, mock.Anything).Return(nil, nil, service.ErrInvalidCursor)
+
+		if assert.NoError(t, h.GetAll(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("rejects mixing page numbers and cursors or sorting by other fields", func(t *testing.T) {
+		for _, query := range []string{"limit=10&page=2", "cursor=abc.def&sort=name"} {
+			mockSvc := new(MockUserServiceReal)
+			h := NewUserHandler(mockSvc, v, log)
+
+			c, rec := newContext(query)
+
+			if assert.NoError(t, h.GetAll(c)) {
+				assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+			}
+			mockSvc.AssertNotCalled(t, "GetAllByCursor", mock.Anything, mock.Anything)
+		}
+	})
+}
+
+func TestUserHandler_Search(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	t.Run("success", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/search?q=jon+doe&limit=5", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		result := &domain.UserSearchResponse{
+			User:       &domain.UserResponse{ID: uuid.New(), Name: "John Doe"},
+			Rank:       0.8,
+			Highlights: domain.UserHighlights{Name: "John <mark>Doe</mark>"},
+		}
+		mockSvc.On("Search", mock.Anything, mock.MatchedBy(func(req *domain.SearchUsersRequest) bool {
+			return req.Q == "jon doe" && req.Limit == 5
+		})).Return([]*domain.UserSearchResponse{result}, nil)
+
+		if assert.NoError(t, h.Search(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"rank":0.8`)
+			assert.Contains(t, rec.Body.String(), `John \u003cmark\u003eDoe\u003c/mark\u003e`)
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("missing or oversized query", func(t *testing.T) {
+		for _, query := range []string{"", "q=a", "q=jo&limit=1000"} {
+			mockSvc := new(MockUserServiceReal)
+			h := NewUserHandler(mockSvc, v, log)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/search?"+query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if assert.NoError(t, h.Search(c)) {
+				assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+			}
+			mockSvc.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+		}
+	})
+}
+
+func TestUserHandler_Update(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	t.Run("other user's record is forbidden", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/users/"+id.String(), strings.NewReader(`{"name":"Jane Doe"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id.String())
+		c.Set("user", &domain.AuthUser{ID: uuid.New(), Role: domain.RoleUser})
+
+		if assert.NoError(t, h.Update(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+		mockSvc.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserHandler_Patch(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	id := uuid.New()
+	current := &domain.UserDocument{Name: "John Doe", Email: "john@example.com"}
+
+	newContext := func(contentType, body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/"+id.String(), strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id.String())
+		c.Set("user", &domain.AuthUser{ID: id, Role: domain.RoleUser})
+		return c, rec
+	}
+
+	t.Run("merge patch changes only the given fields", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("application/merge-patch+json; charset=utf-8", `{"name":"Jane Doe"}`)
+
+		mockSvc.On("Patch", mock.Anything, id).Return(current, nil)
+		mockSvc.On("SavePatch", mock.MatchedBy(func(patch *domain.UserPatch) bool {
+			return patch.Name != nil && *patch.Name == "Jane Doe" && patch.Email == nil
+		})).Return(&domain.UserResponse{ID: id, Name: "Jane Doe", Email: current.Email}, nil)
+
+		if assert.NoError(t, h.Patch(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("application/json-patch+json", `[
+			{"op":"test","path":"/email","value":"john@example.com"},
+			{"op":"replace","path":"/email","value":"jane@example.com"}
+		]`)
+
+		mockSvc.On("Patch", mock.Anything, id).Return(current, nil)
+		mockSvc.On("SavePatch", mock.MatchedBy(func(patch *domain.UserPatch) bool {
+			return patch.Name == nil && patch.Email != nil && *patch.Email == "jane@example.com"
+		})).Return(&domain.UserResponse{ID: id}, nil)
+
+		if assert.NoError(t, h.Patch(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("failed test operation", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("application/json-patch+json", `[{"op":"test","path":"/name","value":"Someone Else"}]`)
+
+		mockSvc.On("Patch", mock.Anything, id).Return(current, nil)
+
+		if assert.NoError(t, h.Patch(c)) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+		}
+		mockSvc.AssertNotCalled(t, "SavePatch", mock.Anything)
+	})
+
+	t.Run("user kept changing", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("application/merge-patch+json", `{"name":"Jane Doe"}`)
+
+		mockSvc.On("Patch", mock.Anything, id).Return(current, nil)
+		mockSvc.On("SavePatch", mock.Anything).Return(nil, service.ErrUserModified)
+
+		if assert.NoError(t, h.Patch(c)) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+		}
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext("application/merge-patch+json", `{"name":"Jane Doe"}`)
+
+		mockSvc.On("Patch", mock.Anything, id).Return(nil, service.ErrUserNotFound)
+
+		if assert.NoError(t, h.Patch(c)) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+
+	t.Run("invalid resulting document", func(t *testing.T) {
+		for _, body := range []string{`{"name":null}`, `{"email":"not-an-email"}`, `{"role":"admin"}`, `{"name":`} {
+			mockSvc := new(MockUserServiceReal)
+			h := NewUserHandler(mockSvc, v, log)
+
+			c, rec := newContext("application/merge-patch+json", body)
+
+			mockSvc.On("Patch", mock.Anything, id).Return(current, nil)
+
+			if assert.NoError(t, h.Patch(c)) {
+				assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+			}
+			mockSvc.AssertNotCalled(t, "SavePatch", mock.Anything)
+		}
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext(echo.MIMEApplicationJSON, `{"name":"Jane Doe"}`)
+
+		if assert.NoError(t, h.Patch(c)) {
+			assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+			assert.Contains(t, rec.Header().Get("Accept-Patch"), "application/merge-patch+json")
+		}
+		mockSvc.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserHandler_UpdateRole(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	newContext := func(id uuid.UUID, body string, user *domain.AuthUser) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/users/"+id.String()+"/role", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id.String())
+		c.Set("user", user)
+		return c, rec
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		c, rec := newContext(id, `{"role":"admin"}`, &domain.AuthUser{ID: uuid.New(), Role: domain.RoleAdmin})
+
+		mockSvc.On("UpdateRole", mock.Anything, id, &domain.UpdateRoleRequest{Role: domain.RoleAdmin}).
+			Return(&domain.UserResponse{ID: id, Role: domain.RoleAdmin}, nil)
+
+		if assert.NoError(t, h.UpdateRole(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var res map[string]interface{}
+			json.Unmarshal(rec.Body.Bytes(), &res)
+			data := res["data"].(map[string]interface{})
+			assert.Equal(t, "admin", data["role"])
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext(uuid.New(), `{"role":"superuser"}`, &domain.AuthUser{ID: uuid.New(), Role: domain.RoleAdmin})
+
+		if assert.NoError(t, h.UpdateRole(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+		mockSvc.AssertNotCalled(t, "UpdateRole", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("non-admin is forbidden by middleware", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		c, rec := newContext(uuid.New(), `{"role":"admin"}`, &domain.AuthUser{ID: uuid.New(), Role: domain.RoleUser})
+
+		handler := middleware.RequireRole(domain.RoleAdmin)(h.UpdateRole)
+		if assert.NoError(t, handler(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+		mockSvc.AssertNotCalled(t, "UpdateRole", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserHandler_Unlock(t *testing.T) {
+	e := echo.New()
+	v := validator.New()
+	log := logger.New("debug", true)
+
+	newContext := func(id string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/"+id+"/unlock", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return c, rec
+	}
+
+	t.Run("success", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		c, rec := newContext(id.String())
+
+		mockSvc.On("Unlock", mock.Anything, id).Return(nil)
+
+		if assert.NoError(t, h.Unlock(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockSvc := new(MockUserServiceReal)
+		h := NewUserHandler(mockSvc, v, log)
+
+		id := uuid.New()
+		c, rec := newContext(id.String())
+
+		mockSvc.On("Unlock", mock.Anything, id).Return(service.ErrUserNotFound)
+
+		if assert.NoError(t, h.Unlock(c)) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+}
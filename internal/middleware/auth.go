@@ -1,18 +1,24 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 
 	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/service"
 	"go-echo-starter/pkg/jwt"
+	"go-echo-starter/pkg/logger"
 	"go-echo-starter/pkg/response"
 )
 
-// JWTAuth creates a JWT authentication middleware
-func JWTAuth(jwtService *jwt.JWT) echo.MiddlewareFunc {
+// JWTAuth creates a JWT authentication middleware.
+// Rejected tokens are logged with the reason; expired ones only at debug level since they are routine.
+func JWTAuth(tokens jwt.TokenVerifier, revocations service.TokenRevocationService, sessions service.SessionTracker, log *logger.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Get Authorization header
@@ -28,20 +34,162 @@ func JWTAuth(jwtService *jwt.JWT) echo.MiddlewareFunc {
 			}
 
 			// Validate token
-			claims, err := jwtService.Validate(parts[1])
+			claims, err := tokens.Validate(parts[1])
 			if err != nil {
+				event := log.Warn()
+				if errors.Is(err, jwt.ErrExpiredToken) {
+					event = log.Debug()
+				}
+				event.Err(err).Str("ip", c.RealIP()).Msg("Rejected access token")
 				return response.Error(c, http.StatusUnauthorized, "Invalid or expired token")
 			}
 
+			// Check revocation
+			revoked, err := revocations.IsRevoked(c.Request().Context(), claims)
+			if err != nil {
+				return response.Error(c, http.StatusInternalServerError, "Failed to verify token")
+			}
+			if revoked {
+				return response.Error(c, http.StatusUnauthorized, "Token has been revoked")
+			}
+
+			// Tokens of a login session mark it as seen
+			if sessionID, err := uuid.Parse(claims.SessionID); err == nil {
+				sessions.Seen(c.Request().Context(), sessionID)
+			}
+
 			// Set user in context
 			user := &domain.AuthUser{
-				ID:    claims.UserID,
-				Name:  claims.Name,
-				Email: claims.Email,
+				ID:       claims.UserID,
+				Name:     claims.Name,
+				Email:    claims.Email,
+				Role:     claims.Role,
+				Scopes:   claims.Scopes,
+				ClientID: claims.ClientID,
+			}
+			c.Set("user", user)
+			c.Set("claims", claims)
+
+			return next(c)
+		}
+	}
+}
+
+// FirstPartyJWTAuth creates a JWT authentication middleware that, unlike JWTAuth,
+// rejects tokens issued to OAuth clients. It guards account management, which
+// third-party applications must never reach whatever scopes they were granted.
+func FirstPartyJWTAuth(tokens jwt.TokenVerifier, revocations service.TokenRevocationService, sessions service.SessionTracker, log *logger.Logger) echo.MiddlewareFunc {
+	jwtAuth := JWTAuth(tokens, revocations, sessions, log)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtAuth(func(c echo.Context) error {
+			if claims, ok := c.Get("claims").(*jwt.Claims); ok && claims.ClientID != "" {
+				return response.Error(c, http.StatusForbidden, "Tokens issued to OAuth clients cannot be used here")
 			}
+			return next(c)
+		})
+	}
+}
+
+// APIKeyHeader is the header personal API keys are sent in
+const APIKeyHeader = "X-API-Key"
+
+// Authenticate creates an authentication middleware accepting either a JWT in the
+// Authorization header or a personal API key in the X-API-Key header.
+// Both put the same domain.AuthUser in the context; only JWTs also set "claims".
+func Authenticate(tokens jwt.TokenVerifier, revocations service.TokenRevocationService, sessions service.SessionTracker, apiKeys service.APIKeyService, log *logger.Logger) echo.MiddlewareFunc {
+	jwtAuth := JWTAuth(tokens, revocations, sessions, log)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withJWT := jwtAuth(next)
+
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(APIKeyHeader)
+			if key == "" {
+				return withJWT(c)
+			}
+
+			user, err := apiKeys.Authenticate(c.Request().Context(), key)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAPIKey) {
+					log.Warn().Str("ip", c.RealIP()).Msg("Rejected API key")
+					return response.Error(c, http.StatusUnauthorized, "Invalid, expired or revoked API key")
+				}
+				return response.Error(c, http.StatusInternalServerError, "Failed to verify API key")
+			}
+
 			c.Set("user", user)
 
 			return next(c)
 		}
 	}
 }
+
+// RequireRole creates a middleware that only lets users with one of the given roles through.
+// It must be used after JWTAuth.
+func RequireRole(roles ...domain.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*domain.AuthUser)
+			if !ok {
+				return response.Error(c, http.StatusUnauthorized, "User context not found")
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					return next(c)
+				}
+			}
+
+			return response.Error(c, http.StatusForbidden, "Insufficient permissions")
+		}
+	}
+}
+
+// RequireUser creates a middleware that rejects tokens OAuth clients were issued on
+// their own behalf, which act for no user. It must be used after JWTAuth or Authenticate.
+func RequireUser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*domain.AuthUser)
+			if !ok {
+				return response.Error(c, http.StatusUnauthorized, "User context not found")
+			}
+
+			if user.ID == uuid.Nil {
+				return response.Error(c, http.StatusForbidden, "Tokens of OAuth clients acting for themselves cannot be used here")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireScope creates a middleware that only lets tokens granted all of the given scopes through.
+// It must be used after JWTAuth.
+func RequireScope(scopes ...domain.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*domain.AuthUser)
+			if !ok {
+				return response.Error(c, http.StatusUnauthorized, "User context not found")
+			}
+
+			var missing []string
+			for _, scope := range scopes {
+				if !user.HasScope(scope) {
+					missing = append(missing, string(scope))
+				}
+			}
+
+			if len(missing) > 0 {
+				return response.ErrorWithDetails(c, http.StatusForbidden,
+					fmt.Sprintf("Missing required scope: %s", strings.Join(missing, ", ")),
+					map[string][]string{"missing_scopes": missing},
+				)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
+	"go-echo-starter/internal/domain"
 	"go-echo-starter/pkg/logger"
 )
 
@@ -30,6 +31,9 @@ func Setup(e *echo.Echo, log *logger.Logger) {
 	// Request ID middleware
 	e.Use(RequestID())
 
+	// Client info middleware
+	e.Use(ClientInfo())
+
 	// Logger middleware
 	e.Use(Logger(log))
 
@@ -37,7 +41,7 @@ func Setup(e *echo.Echo, log *logger.Logger) {
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{echo.GET, echo.POST, echo.PUT, echo.DELETE, echo.PATCH, echo.OPTIONS},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, RequestIDHeader},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, APIKeyHeader, RequestIDHeader},
 	}))
 
 	// Secure middleware
@@ -65,6 +69,21 @@ func RequestID() echo.MiddlewareFunc {
 	}
 }
 
+// ClientInfo middleware makes the client IP and user agent available to services via the request context
+func ClientInfo() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := domain.WithClientInfo(req.Context(), domain.ClientInfo{
+				IP:        c.RealIP(),
+				UserAgent: req.UserAgent(),
+			})
+			c.SetRequest(req.WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
 // Logger middleware logs each HTTP request
 func Logger(log *logger.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
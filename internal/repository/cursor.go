@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+)
+
+// ErrInvalidCursor is returned when a cursor was tampered with or does not belong to the listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a listing ordered by (created_at, id).
+// Desc records the order of the listing it was issued for, and Before whether
+// it points at the rows before the position rather than after it.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	Desc      bool
+	Before    bool
+}
+
+// cursorPayload is the encoded form of a Cursor
+type cursorPayload struct {
+	CreatedAt int64     `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Desc      bool      `json:"d,omitempty"`
+	Before    bool      `json:"b,omitempty"`
+}
+
+// CursorCodec turns cursors into opaque strings signed with HMAC-SHA256, so
+// clients can neither read nor forge positions in a listing
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec creates a cursor codec signing with secret
+func NewCursorCodec(secret []byte) *CursorCodec {
+	return &CursorCodec{secret: secret}
+}
+
+// Encode returns the opaque form of a cursor
+func (c *CursorCodec) Encode(cursor Cursor) string {
+	// Postgres keeps microseconds, so the position round-trips exactly
+	payload, _ := json.Marshal(cursorPayload{
+		CreatedAt: cursor.CreatedAt.UnixMicro(),
+		ID:        cursor.ID,
+		Desc:      cursor.Desc,
+		Before:    cursor.Before,
+	})
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded))
+}
+
+// Decode parses a cursor returned by Encode
+func (c *CursorCodec) Decode(s string) (Cursor, error) {
+	encoded, signature, ok := strings.Cut(s, ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.sign(encoded)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{
+		CreatedAt: time.UnixMicro(payload.CreatedAt).UTC(),
+		ID:        payload.ID,
+		Desc:      payload.Desc,
+		Before:    payload.Before,
+	}, nil
+}
+
+// sign returns the MAC of an encoded cursor payload
+func (c *CursorCodec) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// keyset describes a page of a listing ordered by (created_at, id), the ID
+// breaking ties so the order is total and no row is skipped or repeated
+type keyset struct {
+	cursor *Cursor
+	desc   bool
+	limit  int
+}
+
+// keyset decodes the cursor of a page request. An empty cursor starts the
+// listing; any other must have been issued for a listing in the same order.
+func (c *CursorCodec) keyset(req domain.CursorRequest, desc bool) (*keyset, error) {
+	k := &keyset{desc: desc, limit: req.PageLimit()}
+	if req.Cursor == "" {
+		return k, nil
+	}
+
+	cursor, err := c.Decode(req.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+
+	k.cursor = &cursor
+	return k, nil
+}
+
+// backward reports whether the page is fetched walking the listing backwards
+func (k *keyset) backward() bool {
+	return k.cursor != nil && k.cursor.Before
+}
+
+// condition returns the condition selecting the rows past the cursor, its
+// placeholders numbered from n, or an empty condition on the first page
+func (k *keyset) condition(n int) (string, []interface{}) {
+	if k.cursor == nil {
+		return "", nil
+	}
+
+	op := ">"
+	if k.desc != k.backward() {
+		op = "<"
+	}
+	return fmt.Sprintf("(created_at, id) %s ($%d, $%d)", op, n, n+1), []interface{}{k.cursor.CreatedAt, k.cursor.ID}
+}
+
+// orderAndLimit returns the ORDER BY and LIMIT clauses of the page, fetching
+// one row more than the page holds to tell whether another page follows
+func (k *keyset) orderAndLimit() string {
+	direction := "ASC"
+	if k.desc != k.backward() {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY created_at %s, id %s LIMIT %d", direction, direction, k.limit+1)
+}
+
+// keysetPage trims the rows fetched for a page to its size, puts them in
+// listing order and returns the cursors to the neighbouring pages; key returns
+// the position of a row
+func keysetPage[T any](codec *CursorCodec, k *keyset, rows []T, key func(T) Cursor) ([]T, *domain.CursorPage) {
+	more := len(rows) > k.limit
+	if more {
+		rows = rows[:k.limit]
+	}
+	if k.backward() {
+		slices.Reverse(rows)
+	}
+
+	page := &domain.CursorPage{}
+	cursor := func(position Cursor, before bool) string {
+		position.Desc, position.Before = k.desc, before
+		return codec.Encode(position)
+	}
+
+	// Only rows removed since the cursor was issued leave a page empty; the listing ends there
+	if len(rows) == 0 {
+		return rows, page
+	}
+
+	// A page reached through a cursor has a neighbour on the side it was reached from
+	hasNext, hasPrev := more, k.cursor != nil
+	if k.backward() {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		page.Next = cursor(key(rows[len(rows)-1]), false)
+	}
+	if hasPrev {
+		page.Prev = cursor(key(rows[0]), true)
+	}
+
+	return rows, page
+}
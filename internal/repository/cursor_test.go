@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"go-echo-starter/internal/domain"
+)
+
+func TestCursorCodec(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	cursor := Cursor{
+		CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+		Desc:      true,
+		Before:    true,
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		decoded, err := codec.Decode(codec.Encode(cursor))
+
+		assert.NoError(t, err)
+		assert.Equal(t, cursor, decoded)
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		other := codec.Encode(Cursor{CreatedAt: cursor.CreatedAt, ID: uuid.New()})
+		payload, _, _ := strings.Cut(other, ".")
+		_, signature, _ := strings.Cut(codec.Encode(cursor), ".")
+
+		_, err := codec.Decode(payload + "." + signature)
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("signed with another secret", func(t *testing.T) {
+		_, err := codec.Decode(NewCursorCodec([]byte("other")).Encode(cursor))
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, s := range []string{"", "abc", "abc.def", "!!.!!"} {
+			_, err := codec.Decode(s)
+			assert.ErrorIs(t, err, ErrInvalidCursor, s)
+		}
+	})
+}
+
+func TestKeyset(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	positions := make([]Cursor, 5)
+	for i := range positions {
+		positions[i] = Cursor{CreatedAt: base.Add(time.Duration(i) * time.Minute), ID: uuid.New()}
+	}
+	key := func(c Cursor) Cursor { return c }
+	request := func(cursor string) domain.CursorRequest {
+		return domain.CursorRequest{Cursor: cursor, Limit: 2}
+	}
+
+	t.Run("first page", func(t *testing.T) {
+		k, err := codec.keyset(request(""), false)
+		assert.NoError(t, err)
+
+		condition, _ := k.condition(1)
+		assert.Empty(t, condition)
+		assert.Equal(t, "ORDER BY created_at ASC, id ASC LIMIT 3", k.orderAndLimit())
+
+		rows, page := keysetPage(codec, k, positions[:3], key)
+		assert.Equal(t, positions[:2], rows)
+		assert.Empty(t, page.Prev)
+
+		next, err := codec.Decode(page.Next)
+		assert.NoError(t, err)
+		assert.Equal(t, positions[1].ID, next.ID)
+		assert.False(t, next.Before)
+	})
+
+	t.Run("next page", func(t *testing.T) {
+		k, err := codec.keyset(request(codec.Encode(positions[1])), false)
+		assert.NoError(t, err)
+
+		condition, args := k.condition(3)
+		assert.Equal(t, "(created_at, id) > ($3, $4)", condition)
+		assert.Equal(t, []interface{}{positions[1].CreatedAt, positions[1].ID}, args)
+
+		rows, page := keysetPage(codec, k, positions[2:5], key)
+		assert.Equal(t, positions[2:4], rows)
+		assert.NotEmpty(t, page.Next)
+
+		prev, err := codec.Decode(page.Prev)
+		assert.NoError(t, err)
+		assert.Equal(t, positions[2].ID, prev.ID)
+		assert.True(t, prev.Before)
+	})
+
+	t.Run("previous page", func(t *testing.T) {
+		k, err := codec.keyset(request(codec.Encode(Cursor{CreatedAt: positions[2].CreatedAt, ID: positions[2].ID, Before: true})), false)
+		assert.NoError(t, err)
+
+		condition, _ := k.condition(1)
+		assert.Equal(t, "(created_at, id) < ($1, $2)", condition)
+		assert.Equal(t, "ORDER BY created_at DESC, id DESC LIMIT 3", k.orderAndLimit())
+
+		// Rows arrive walking backwards from the cursor
+		rows, page := keysetPage(codec, k, []Cursor{positions[1], positions[0]}, key)
+		assert.Equal(t, positions[:2], rows)
+		assert.Empty(t, page.Prev)
+		assert.NotEmpty(t, page.Next)
+	})
+
+	t.Run("descending listing", func(t *testing.T) {
+		k, err := codec.keyset(request(codec.Encode(Cursor{CreatedAt: positions[3].CreatedAt, ID: positions[3].ID, Desc: true})), true)
+		assert.NoError(t, err)
+
+		condition, _ := k.condition(1)
+		assert.Equal(t, "(created_at, id) < ($1, $2)", condition)
+		assert.Equal(t, "ORDER BY created_at DESC, id DESC LIMIT 3", k.orderAndLimit())
+	})
+
+	t.Run("cursor of a listing in another order", func(t *testing.T) {
+		_, err := codec.keyset(request(codec.Encode(positions[1])), true)
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
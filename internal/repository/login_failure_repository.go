@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-echo-starter/internal/domain"
+)
+
+type loginFailureRepository struct {
+	db *sqlx.DB
+}
+
+// NewLoginFailureRepository creates a new login failure repository
+func NewLoginFailureRepository(db *sqlx.DB) LoginFailureRepository {
+	return &loginFailureRepository{db: db}
+}
+
+// Get gets the failed login attempts of a subject
+func (r *loginFailureRepository) Get(ctx context.Context, subject string) (*domain.LoginFailure, error) {
+	failure := &domain.LoginFailure{}
+	query := `SELECT subject, failures, last_failed_at, locked_until FROM login_failures WHERE subject = $1`
+
+	err := r.db.GetContext(ctx, failure, query, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return failure, nil
+}
+
+// RecordFailure counts a failed login attempt and returns the updated record.
+// The count starts over if neither a failure nor a lockout happened since windowStart.
+func (r *loginFailureRepository) RecordFailure(ctx context.Context, subject string, at, windowStart time.Time) (*domain.LoginFailure, error) {
+	failure := &domain.LoginFailure{}
+	query := `
+		INSERT INTO login_failures (subject, failures, last_failed_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (subject) DO UPDATE SET
+			failures = CASE
+				WHEN login_failures.last_failed_at < $3
+					AND (login_failures.locked_until IS NULL OR login_failures.locked_until < $3)
+				THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failed_at = EXCLUDED.last_failed_at
+		RETURNING subject, failures, last_failed_at, locked_until
+	`
+
+	err := r.db.GetContext(ctx, failure, query, subject, at, windowStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return failure, nil
+}
+
+// Lock locks a subject out until the given time
+func (r *loginFailureRepository) Lock(ctx context.Context, subject string, until time.Time) error {
+	query := `UPDATE login_failures SET locked_until = $1 WHERE subject = $2`
+
+	result, err := r.db.ExecContext(ctx, query, until, subject)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// Reset clears the failed login attempts and any lockout of a subject
+func (r *loginFailureRepository) Reset(ctx context.Context, subject string) error {
+	query := `DELETE FROM login_failures WHERE subject = $1`
+
+	_, err := r.db.ExecContext(ctx, query, subject)
+	return err
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"go-echo-starter/internal/domain"
+)
+
+type oauthClientRepository struct {
+	db *sqlx.DB
+}
+
+// NewOAuthClientRepository creates a new OAuth client repository
+func NewOAuthClientRepository(db *sqlx.DB) OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+// oauthClientColumns are the columns scanned by scanOAuthClient, in order
+const oauthClientColumns = `id, name, secret_hash, redirect_uris, scopes, created_by, created_at`
+
+// Create stores a new OAuth client
+func (r *oauthClientRepository) Create(ctx context.Context, client *domain.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (name, secret_hash, redirect_uris, scopes, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRowxContext(ctx, query, client.Name, client.SecretHash, pq.Array(client.RedirectURIs), pq.Array(client.Scopes), client.CreatedBy).
+		Scan(&client.ID, &client.CreatedAt)
+}
+
+// GetByID gets an OAuth client by ID
+func (r *oauthClientRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE id = $1`
+
+	client, err := scanOAuthClient(r.db.QueryRowxContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// List lists every OAuth client, newest first
+func (r *oauthClientRepository) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*domain.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// Delete deletes an OAuth client along with its codes, consents and refresh tokens
+func (r *oauthClientRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM oauth_clients WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// scanOAuthClient scans a row selected with oauthClientColumns
+func scanOAuthClient(row interface{ Scan(dest ...any) error }) (*domain.OAuthClient, error) {
+	client := &domain.OAuthClient{}
+	err := row.Scan(
+		&client.ID, &client.Name, &client.SecretHash, pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes),
+		&client.CreatedBy, &client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"go-echo-starter/internal/domain"
+)
+
+type oauthCodeRepository struct {
+	db *sqlx.DB
+}
+
+// NewOAuthCodeRepository creates a new OAuth authorization code repository
+func NewOAuthCodeRepository(db *sqlx.DB) OAuthCodeRepository {
+	return &oauthCodeRepository{db: db}
+}
+
+// Create stores a new authorization code
+func (r *oauthCodeRepository) Create(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+
+	return r.db.QueryRowxContext(ctx, query, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, pq.Array(code.Scopes), code.CodeChallenge, code.ExpiresAt).
+		Scan(&code.CreatedAt)
+}
+
+// Consume deletes an authorization code and returns it, whether or not it has expired.
+// It returns ErrNotFound if the code does not exist or was already exchanged.
+func (r *oauthCodeRepository) Consume(ctx context.Context, hash string) (*domain.OAuthAuthorizationCode, error) {
+	code := &domain.OAuthAuthorizationCode{}
+	query := `
+		DELETE FROM oauth_authorization_codes
+		WHERE code_hash = $1
+		RETURNING code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at, created_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, hash).Scan(
+		&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, pq.Array(&code.Scopes),
+		&code.CodeChallenge, &code.ExpiresAt, &code.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return code, nil
+}
+
+// DeleteExpired deletes authorization codes that were never exchanged
+func (r *oauthCodeRepository) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM oauth_authorization_codes WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	_, err := r.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"go-echo-starter/internal/domain"
+)
+
+type oauthConsentRepository struct {
+	db *sqlx.DB
+}
+
+// NewOAuthConsentRepository creates a new OAuth consent repository
+func NewOAuthConsentRepository(db *sqlx.DB) OAuthConsentRepository {
+	return &oauthConsentRepository{db: db}
+}
+
+// oauthConsentSelect selects the columns scanned by scanOAuthConsent, in order
+const oauthConsentSelect = `
+	SELECT oc.user_id, oc.client_id, c.name, oc.scopes, oc.created_at, oc.updated_at
+	FROM oauth_consents oc
+	JOIN oauth_clients c ON c.id = oc.client_id
+`
+
+// Get gets the consent a user gave a client
+func (r *oauthConsentRepository) Get(ctx context.Context, userID, clientID uuid.UUID) (*domain.OAuthConsent, error) {
+	query := oauthConsentSelect + `WHERE oc.user_id = $1 AND oc.client_id = $2`
+
+	consent, err := scanOAuthConsent(r.db.QueryRowxContext(ctx, query, userID, clientID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return consent, nil
+}
+
+// Upsert records a consent, replacing the scopes of an earlier one
+func (r *oauthConsentRepository) Upsert(ctx context.Context, consent *domain.OAuthConsent) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = EXCLUDED.scopes
+		RETURNING created_at, updated_at
+	`
+
+	return r.db.QueryRowxContext(ctx, query, consent.UserID, consent.ClientID, pq.Array(consent.Scopes)).
+		Scan(&consent.CreatedAt, &consent.UpdatedAt)
+}
+
+// ListByUser lists the consents a user gave, most recently updated first
+func (r *oauthConsentRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.OAuthConsent, error) {
+	query := oauthConsentSelect + `WHERE oc.user_id = $1 ORDER BY oc.updated_at DESC`
+
+	rows, err := r.db.QueryxContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := []*domain.OAuthConsent{}
+	for rows.Next() {
+		consent, err := scanOAuthConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// Delete withdraws the consent a user gave a client.
+// It returns ErrNotFound if there is none.
+func (r *oauthConsentRepository) Delete(ctx context.Context, userID, clientID uuid.UUID) error {
+	query := `DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, userID, clientID)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// scanOAuthConsent scans a row selected with oauthConsentSelect
+func scanOAuthConsent(row interface{ Scan(dest ...any) error }) (*domain.OAuthConsent, error) {
+	consent := &domain.OAuthConsent{}
+	err := row.Scan(
+		&consent.UserID, &consent.ClientID, &consent.ClientName, pq.Array(&consent.Scopes),
+		&consent.CreatedAt, &consent.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
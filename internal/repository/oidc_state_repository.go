@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	"go-echo-starter/internal/domain"
+)
+
+type oidcStateRepository struct {
+	db *sqlx.DB
+}
+
+// NewOIDCStateRepository creates a new OIDC login state repository
+func NewOIDCStateRepository(db *sqlx.DB) OIDCStateRepository {
+	return &oidcStateRepository{db: db}
+}
+
+// Create stores a new login state
+func (r *oidcStateRepository) Create(ctx context.Context, state *domain.OIDCLoginState) error {
+	query := `
+		INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+
+	return r.db.QueryRowxContext(ctx, query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt).
+		Scan(&state.CreatedAt)
+}
+
+// Consume deletes a login state and returns it, whether or not it has expired.
+// It returns ErrNotFound if the state does not exist or was already consumed.
+func (r *oidcStateRepository) Consume(ctx context.Context, hash string) (*domain.OIDCLoginState, error) {
+	state := &domain.OIDCLoginState{}
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1
+		RETURNING state_hash, provider, nonce, code_verifier, expires_at, created_at
+	`
+
+	err := r.db.GetContext(ctx, state, query, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// DeleteExpired deletes login states that were abandoned
+func (r *oidcStateRepository) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM oidc_login_states WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	_, err := r.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"go-echo-starter/internal/domain"
+)
+
+type refreshTokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewRefreshTokenRepository creates a new refresh token repository
+func NewRefreshTokenRepository(db *sqlx.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+// Create stores a new refresh token
+func (r *refreshTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, client_id, token_hash, scopes, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRowxContext(ctx, query,
+		token.UserID, token.FamilyID, token.ClientID, token.TokenHash, pq.Array(token.Scopes), token.UserAgent, token.IPAddress, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetByHash gets a refresh token by its hash
+func (r *refreshTokenRepository) GetByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	token := &domain.RefreshToken{}
+	query := `
+		SELECT id, user_id, family_id, client_id, token_hash, scopes, user_agent, ip_address, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, hash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.ClientID, &token.TokenHash, pq.Array(&token.Scopes),
+		&token.UserAgent, &token.IPAddress, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// MarkUsed marks a refresh token as used.
+// It returns ErrNotFound if the token was already used or revoked, so that
+// concurrent refreshes with the same token cannot both succeed.
+func (r *refreshTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// TouchSession records that an access token of a session was used at the given time.
+// It is kept on the family's current refresh token, which a session is last seen at
+// the latest of along with its creation.
+func (r *refreshTokenRepository) TouchSession(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	query := `
+		UPDATE refresh_tokens
+		SET last_seen_at = $2
+		WHERE family_id = $1 AND used_at IS NULL AND revoked_at IS NULL AND (last_seen_at IS NULL OR last_seen_at < $2)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, familyID, at)
+	return err
+}
+
+// RevokeFamily revokes every token in a refresh token family
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// RevokeAllForUser revokes every refresh token belonging to a user
+func (r *refreshTokenRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// RevokeForClient revokes every refresh token a client was issued for a user
+func (r *refreshTokenRepository) RevokeForClient(ctx context.Context, userID, clientID uuid.UUID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, userID, clientID)
+	return err
+}
+
+// ListSessions lists the active sessions of a user, most recently seen first.
+// A session is a token family the user logged in with that still has a usable
+// refresh token; it is described by the client its latest token was issued to.
+func (r *refreshTokenRepository) ListSessions(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	sessions := []*domain.Session{}
+	query := `
+		SELECT
+			family_id AS id,
+			(ARRAY_AGG(user_agent ORDER BY created_at DESC))[1] AS user_agent,
+			(ARRAY_AGG(ip_address ORDER BY created_at DESC))[1] AS ip_address,
+			MIN(created_at) AS created_at,
+			GREATEST(MAX(created_at), MAX(last_seen_at)) AS last_seen_at,
+			MAX(expires_at) AS expires_at
+		FROM refresh_tokens
+		WHERE user_id = $1 AND client_id IS NULL
+		GROUP BY family_id
+		HAVING BOOL_OR(used_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP)
+		ORDER BY last_seen_at DESC
+	`
+
+	err := r.db.SelectContext(ctx, &sessions, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -13,7 +14,111 @@ type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
-	GetAll(ctx context.Context) ([]*domain.User, error)
+	GetAll(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.User, int, error)
+	GetAllByCursor(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.User, *domain.CursorPage, error)
+	Search(ctx context.Context, req *domain.SearchUsersRequest) ([]*domain.UserSearchResult, error)
 	Update(ctx context.Context, user *domain.User) error
+	UpdateRole(ctx context.Context, id uuid.UUID, role domain.Role) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, password string) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	Restore(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RefreshTokenRepository defines the interface for refresh token data access
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *domain.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*domain.RefreshToken, error)
+	MarkUsed(ctx context.Context, id uuid.UUID) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeForClient(ctx context.Context, userID, clientID uuid.UUID) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error)
+	TouchSession(ctx context.Context, familyID uuid.UUID, at time.Time) error
+}
+
+// TokenRevocationRepository defines the interface for access token revocation data access
+type TokenRevocationRepository interface {
+	RevokeToken(ctx context.Context, token *domain.RevokedToken) error
+	GetActiveRevokedTokens(ctx context.Context) ([]*domain.RevokedToken, error)
+	DeleteExpired(ctx context.Context) error
+	GetTokenVersion(ctx context.Context, userID uuid.UUID) (int, error)
+	IncrementTokenVersion(ctx context.Context, userID uuid.UUID) (int, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	GetRevokedSessions(ctx context.Context, since time.Time) ([]uuid.UUID, error)
+}
+
+// UserTokenRepository defines the interface for single-use user token data access
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *domain.UserToken) error
+	GetActive(ctx context.Context, purpose domain.TokenPurpose, hash string) (*domain.UserToken, error)
+	Consume(ctx context.Context, purpose domain.TokenPurpose, hash string) (*domain.UserToken, error)
+	DeleteForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error
+	ConsumeForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error
+	CountCreatedSince(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose, since time.Time) (int, error)
+}
+
+// TwoFactorRepository defines the interface for two-factor authentication data access
+type TwoFactorRepository interface {
+	GetTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPConfig, error)
+	SetPendingSecret(ctx context.Context, userID uuid.UUID, secret string) error
+	Enable(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	Disable(ctx context.Context, userID uuid.UUID) error
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) error
+	ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) error
+}
+
+// LoginFailureRepository defines the interface for failed login attempt tracking
+type LoginFailureRepository interface {
+	Get(ctx context.Context, subject string) (*domain.LoginFailure, error)
+	RecordFailure(ctx context.Context, subject string, at, windowStart time.Time) (*domain.LoginFailure, error)
+	Lock(ctx context.Context, subject string, until time.Time) error
+	Reset(ctx context.Context, subject string) error
+}
+
+// APIKeyRepository defines the interface for API key data access
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *domain.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*domain.APIKey, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error)
+	Revoke(ctx context.Context, userID, id uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// UserIdentityRepository defines the interface for external identity data access
+type UserIdentityRepository interface {
+	Create(ctx context.Context, identity *domain.UserIdentity) error
+	GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error)
+}
+
+// OIDCStateRepository defines the interface for pending social login data access
+type OIDCStateRepository interface {
+	Create(ctx context.Context, state *domain.OIDCLoginState) error
+	Consume(ctx context.Context, hash string) (*domain.OIDCLoginState, error)
+	DeleteExpired(ctx context.Context) error
+}
+
+// OAuthClientRepository defines the interface for OAuth client data access
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *domain.OAuthClient) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.OAuthClient, error)
+	List(ctx context.Context) ([]*domain.OAuthClient, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// OAuthCodeRepository defines the interface for OAuth authorization code data access
+type OAuthCodeRepository interface {
+	Create(ctx context.Context, code *domain.OAuthAuthorizationCode) error
+	Consume(ctx context.Context, hash string) (*domain.OAuthAuthorizationCode, error)
+	DeleteExpired(ctx context.Context) error
+}
+
+// OAuthConsentRepository defines the interface for OAuth consent data access
+type OAuthConsentRepository interface {
+	Get(ctx context.Context, userID, clientID uuid.UUID) (*domain.OAuthConsent, error)
+	Upsert(ctx context.Context, consent *domain.OAuthConsent) error
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.OAuthConsent, error)
+	Delete(ctx context.Context, userID, clientID uuid.UUID) error
 }
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"go-echo-starter/internal/domain"
+)
+
+type tokenRevocationRepository struct {
+	db *sqlx.DB
+}
+
+// NewTokenRevocationRepository creates a new token revocation repository
+func NewTokenRevocationRepository(db *sqlx.DB) TokenRevocationRepository {
+	return &tokenRevocationRepository{db: db}
+}
+
+// RevokeToken records a revoked access token.
+// Tokens without a user, issued to OAuth clients on their own behalf, have a nil user ID.
+func (r *tokenRevocationRepository) RevokeToken(ctx context.Context, token *domain.RevokedToken) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, NULLIF($2, uuid_nil()), $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	_, err := r.db.ExecContext(ctx, query, token.JTI, token.UserID, token.ExpiresAt)
+	return err
+}
+
+// GetActiveRevokedTokens gets all revoked tokens that have not expired yet
+func (r *tokenRevocationRepository) GetActiveRevokedTokens(ctx context.Context) ([]*domain.RevokedToken, error) {
+	var tokens []*domain.RevokedToken
+	query := `
+		SELECT jti, COALESCE(user_id, uuid_nil()) AS user_id, expires_at, revoked_at
+		FROM revoked_tokens
+		WHERE expires_at > CURRENT_TIMESTAMP
+	`
+
+	err := r.db.SelectContext(ctx, &tokens, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// DeleteExpired deletes revocations of tokens that have expired anyway
+func (r *tokenRevocationRepository) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM revoked_tokens WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	_, err := r.db.ExecContext(ctx, query)
+	return err
+}
+
+// GetTokenVersion gets the current token version of a user
+func (r *tokenRevocationRepository) GetTokenVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	var version int
+	query := `SELECT token_version FROM users WHERE id = $1 AND deleted_at IS NULL`
+
+	err := r.db.GetContext(ctx, &version, query, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// IncrementTokenVersion bumps the token version of a user, invalidating all issued tokens
+func (r *tokenRevocationRepository) IncrementTokenVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	var version int
+	query := `UPDATE users SET token_version = token_version + 1 WHERE id = $1 AND deleted_at IS NULL RETURNING token_version`
+
+	err := r.db.QueryRowxContext(ctx, query, userID).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// RevokeSession revokes the refresh tokens of one of a user's sessions.
+// It returns ErrNotFound if the user has no such session or it was already revoked.
+func (r *tokenRevocationRepository) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family_id = $1 AND user_id = $2 AND client_id IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// GetRevokedSessions gets the IDs of the sessions revoked since the given time
+func (r *tokenRevocationRepository) GetRevokedSessions(ctx context.Context, since time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	query := `SELECT DISTINCT family_id FROM refresh_tokens WHERE revoked_at > $1 AND client_id IS NULL`
+
+	err := r.db.SelectContext(ctx, &ids, query, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
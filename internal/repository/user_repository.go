@@ -4,6 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -17,24 +21,28 @@ var ErrNotFound = errors.New("record not found")
 // ErrDuplicateEmail is returned when email already exists
 var ErrDuplicateEmail = errors.New("email already exists")
 
+// ErrModified is returned when a record changed since it was read
+var ErrModified = errors.New("record modified")
+
 type userRepository struct {
-	db *sqlx.DB
+	db      *sqlx.DB
+	cursors *CursorCodec
 }
 
 // NewUserRepository creates a new user repository
-func NewUserRepository(db *sqlx.DB) UserRepository {
-	return &userRepository{db: db}
+func NewUserRepository(db *sqlx.DB, cursors *CursorCodec) UserRepository {
+	return &userRepository{db: db, cursors: cursors}
 }
 
 // Create creates a new user
 func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 	query := `
-		INSERT INTO users (name, email, password)
-		VALUES ($1, $2, $3)
+		INSERT INTO users (name, email, password, role)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRowxContext(ctx, query, user.Name, user.Email, user.Password).
+	err := r.db.QueryRowxContext(ctx, query, user.Name, user.Email, user.Password, user.Role).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if isDuplicateKeyError(err) {
@@ -49,7 +57,7 @@ func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 // GetByID gets a user by ID
 func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	user := &domain.User{}
-	query := `SELECT id, name, email, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, name, email, password, role, token_version, email_verified_at, totp_enabled_at, created_at, updated_at FROM users WHERE id = $1 AND deleted_at IS NULL`
 
 	err := r.db.GetContext(ctx, user, query, id)
 	if err != nil {
@@ -65,7 +73,7 @@ func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Use
 // GetByEmail gets a user by email
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	user := &domain.User{}
-	query := `SELECT id, name, email, password, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, name, email, password, role, token_version, email_verified_at, totp_enabled_at, created_at, updated_at FROM users WHERE email = $1 AND deleted_at IS NULL`
 
 	err := r.db.GetContext(ctx, user, query, email)
 	if err != nil {
@@ -78,33 +86,177 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.
 	return user, nil
 }
 
-// GetAll gets all users
-func (r *userRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
-	var users []*domain.User
-	query := `SELECT id, name, email, created_at, updated_at FROM users ORDER BY id DESC`
+// userSortColumns maps the sort fields of a user listing to their columns
+var userSortColumns = map[string]string{
+	"name":       "name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// userFilter returns the conditions selecting the users matching the filters
+// of req, along with their arguments. Deleted users are left out unless requested.
+func userFilter(req *domain.ListUsersRequest) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !req.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if req.Name != "" {
+		where("name ILIKE $%d", containsPattern(req.Name))
+	}
+	if req.Email != "" {
+		where("email ILIKE $%d", containsPattern(req.Email))
+	}
+	if req.CreatedAfter != nil {
+		where("created_at >= $%d", *req.CreatedAfter)
+	}
+	if req.CreatedBefore != nil {
+		where("created_at < $%d", *req.CreatedBefore)
+	}
+
+	return conditions, args
+}
+
+// whereClause joins conditions into a WHERE clause, empty without conditions
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// GetAll gets a page of the users matching the filters of req, along with the
+// total number of matching users
+func (r *userRepository) GetAll(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.User, int, error) {
+	conditions, args := userFilter(req)
+	filter := whereClause(conditions)
+
+	var total int
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM users`+filter, args...); err != nil {
+		return nil, 0, err
+	}
+
+	// The ID breaks ties, so pages do not overlap when sorting by a non-unique column
+	column, direction := "created_at", "ASC"
+	if field := strings.TrimPrefix(req.Sort, "-"); userSortColumns[field] != "" {
+		column = userSortColumns[field]
+		if strings.HasPrefix(req.Sort, "-") {
+			direction = "DESC"
+		}
+	}
+
+	users := []*domain.User{}
+	query := fmt.Sprintf(
+		`SELECT id, name, email, role, email_verified_at, totp_enabled_at, created_at, updated_at, deleted_at FROM users%s ORDER BY %s %s, id %s LIMIT $%d OFFSET $%d`,
+		filter, column, direction, direction, len(args)+1, len(args)+2,
+	)
+
+	err := r.db.SelectContext(ctx, &users, query, append(args, req.PageSize(), req.Offset())...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// GetAllByCursor gets the page of the users matching the filters of req that
+// follows or precedes req.Cursor, ordered by creation time, along with the
+// cursors to the neighbouring pages. Sorts other than by creation time are not supported.
+func (r *userRepository) GetAllByCursor(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.User, *domain.CursorPage, error) {
+	if req.Sort != "" && strings.TrimPrefix(req.Sort, "-") != "created_at" {
+		return nil, nil, ErrInvalidCursor
+	}
 
-	err := r.db.SelectContext(ctx, &users, query)
+	page, err := r.cursors.keyset(req.CursorRequest, req.Sort == "-created_at")
 	if err != nil {
+		return nil, nil, err
+	}
+
+	conditions, args := userFilter(req)
+	if condition, keyArgs := page.condition(len(args) + 1); condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, keyArgs...)
+	}
+
+	users := []*domain.User{}
+	query := `SELECT id, name, email, role, email_verified_at, totp_enabled_at, created_at, updated_at, deleted_at FROM users` +
+		whereClause(conditions) + " " + page.orderAndLimit()
+
+	if err := r.db.SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, nil, err
+	}
+
+	users, cursors := keysetPage(r.cursors, page, users, func(user *domain.User) Cursor {
+		return Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+	})
+	return users, cursors, nil
+}
+
+// Highlights come back from Postgres wrapped in private-use characters, so the
+// user-controlled text can be escaped before the markers become HTML tags
+const (
+	highlightStart   = "\uE000"
+	highlightStop    = "\uE001"
+	highlightOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+)
+
+// markHighlights returns s HTML-escaped, with its highlighted words wrapped in <mark> tags
+func markHighlights(s string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(s))
+}
+
+// Search gets the users best matching req.Q, by full-text search on whole words
+// and by trigram similarity for misspelled and partial words
+func (r *userRepository) Search(ctx context.Context, req *domain.SearchUsersRequest) ([]*domain.UserSearchResult, error) {
+	query := `
+		WITH q AS (SELECT websearch_to_tsquery('simple', $1) AS query)
+		SELECT u.id, u.name, u.email, u.role, u.email_verified_at, u.totp_enabled_at, u.created_at, u.updated_at,
+			ts_rank(u.search_vector, q.query) + GREATEST(word_similarity($1, u.name), word_similarity($1, u.email)) AS rank,
+			ts_headline('simple', u.name, q.query, $2) AS name_highlight,
+			ts_headline('simple', u.email, q.query, $2) AS email_highlight
+		FROM users u, q
+		WHERE u.deleted_at IS NULL AND (u.search_vector @@ q.query OR $1 <% u.name OR $1 <% u.email)
+		ORDER BY rank DESC, u.id
+		LIMIT $3
+	`
+
+	results := []*domain.UserSearchResult{}
+	if err := r.db.SelectContext(ctx, &results, query, req.Q, highlightOptions, req.PageLimit()); err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	for _, result := range results {
+		result.NameHighlight = markHighlights(result.NameHighlight)
+		result.EmailHighlight = markHighlights(result.EmailHighlight)
+	}
+
+	return results, nil
 }
 
-// Update updates a user
+// Update updates a user as read at user.UpdatedAt.
+// Changing the email address clears its verification. It returns ErrModified if
+// the user was modified or deleted since, leaving it unchanged.
 func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2
-		WHERE id = $3
-		RETURNING updated_at
+		SET name = $1,
+			email = $2,
+			email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
+		WHERE id = $3 AND updated_at = $4 AND deleted_at IS NULL
+		RETURNING email_verified_at, updated_at
 	`
 
-	err := r.db.QueryRowxContext(ctx, query, user.Name, user.Email, user.ID).
-		Scan(&user.UpdatedAt)
+	err := r.db.QueryRowxContext(ctx, query, user.Name, user.Email, user.ID, user.UpdatedAt).
+		Scan(&user.EmailVerifiedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNotFound
+			return ErrModified
 		}
 		if isDuplicateKeyError(err) {
 			return ErrDuplicateEmail
@@ -115,11 +267,37 @@ func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
 	return nil
 }
 
-// Delete deletes a user
-func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM users WHERE id = $1`
+// UpdateRole changes the role of a user.
+// The token version is bumped as well so tokens carrying the old role stop working.
+func (r *userRepository) UpdateRole(ctx context.Context, id uuid.UUID, role domain.Role) error {
+	query := `
+		UPDATE users
+		SET role = $1, token_version = token_version + 1
+		WHERE id = $2 AND deleted_at IS NULL
+	`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.db.ExecContext(ctx, query, role, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdatePassword updates the password hash of a user
+func (r *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, password string) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, password, id)
 	if err != nil {
 		return err
 	}
@@ -136,6 +314,59 @@ func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// MarkEmailVerified marks the email address of a user as verified
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = $1 AND email_verified_at IS NULL AND deleted_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete soft-deletes a user.
+// The token version is bumped as well so the tokens of the user stop working.
+func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET deleted_at = CURRENT_TIMESTAMP, token_version = token_version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// Restore restores a soft-deleted user
+func (r *userRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// PurgeDeleted permanently deletes the users soft-deleted before the given time,
+// along with everything they own, and returns how many were deleted
+func (r *userRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM users WHERE deleted_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 // isDuplicateKeyError checks if error is a duplicate key violation
 func isDuplicateKeyError(err error) bool {
 	if err == nil {
@@ -157,3 +388,9 @@ func containsSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+// containsPattern returns a LIKE pattern matching values that contain s literally
+func containsPattern(s string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+	return "%" + escaped + "%"
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkHighlights(t *testing.T) {
+	highlighted := "<b>Jo</b> " + highlightStart + "Doe" + highlightStop
+
+	assert.Equal(t, "&lt;b&gt;Jo&lt;/b&gt; <mark>Doe</mark>", markHighlights(highlighted))
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"go-echo-starter/internal/domain"
+)
+
+type userTokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewUserTokenRepository creates a new user token repository
+func NewUserTokenRepository(db *sqlx.DB) UserTokenRepository {
+	return &userTokenRepository{db: db}
+}
+
+// Create stores a new user token
+func (r *userTokenRepository) Create(ctx context.Context, token *domain.UserToken) error {
+	query := `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRowxContext(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetActive gets an unconsumed, unexpired token without consuming it
+func (r *userTokenRepository) GetActive(ctx context.Context, purpose domain.TokenPurpose, hash string) (*domain.UserToken, error) {
+	token := &domain.UserToken{}
+	query := `
+		SELECT id, user_id, purpose, token_hash, expires_at, consumed_at, created_at
+		FROM user_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	err := r.db.GetContext(ctx, token, query, hash, purpose)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Consume marks a valid token as consumed and returns it.
+// It returns ErrNotFound if the token does not exist, has expired or was already consumed.
+func (r *userTokenRepository) Consume(ctx context.Context, purpose domain.TokenPurpose, hash string) (*domain.UserToken, error) {
+	token := &domain.UserToken{}
+	query := `
+		UPDATE user_tokens
+		SET consumed_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2 AND consumed_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, user_id, purpose, token_hash, expires_at, consumed_at, created_at
+	`
+
+	err := r.db.GetContext(ctx, token, query, hash, purpose)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// DeleteForUser deletes every token of a user with the given purpose
+func (r *userTokenRepository) DeleteForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error {
+	query := `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2`
+
+	_, err := r.db.ExecContext(ctx, query, userID, purpose)
+	return err
+}
+
+// ConsumeForUser marks every unconsumed token of a user with the given purpose as consumed.
+// Unlike DeleteForUser, it keeps them for CountCreatedSince.
+func (r *userTokenRepository) ConsumeForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error {
+	query := `UPDATE user_tokens SET consumed_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND purpose = $2 AND consumed_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, userID, purpose)
+	return err
+}
+
+// CountCreatedSince counts the tokens of a user with the given purpose created at or after since,
+// whether or not they were consumed
+func (r *userTokenRepository) CountCreatedSince(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose, since time.Time) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at >= $3`
+
+	err := r.db.GetContext(ctx, &count, query, userID, purpose, since)
+	return count, err
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/logger"
+)
+
+// API key errors
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+const (
+	// apiKeyMarker starts every API key, so leaked keys are easy to recognize
+	apiKeyMarker = "sk_"
+	// apiKeyPrefixBytes is the randomness in the visible part of a key
+	apiKeyPrefixBytes = 6
+	// apiKeySecretBytes is the randomness in the secret part of a key
+	apiKeySecretBytes = 32
+	// apiKeyLastUsedInterval limits how often the last-used timestamp of a key is written
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// APIKeyService defines the interface for personal API keys
+type APIKeyService interface {
+	Create(ctx context.Context, user *domain.AuthUser, req *domain.CreateAPIKeyRequest) (*domain.CreateAPIKeyResponse, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error)
+	Revoke(ctx context.Context, userID, id uuid.UUID) error
+	Authenticate(ctx context.Context, key string) (*domain.AuthUser, error)
+}
+
+type apiKeyService struct {
+	apiKeyRepo repository.APIKeyRepository
+	userRepo   repository.UserRepository
+	log        *logger.Logger
+	now        func() time.Time
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(apiKeyRepo repository.APIKeyRepository, userRepo repository.UserRepository, log *logger.Logger) APIKeyService {
+	return &apiKeyService{
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+		log:        log,
+		now:        time.Now,
+	}
+}
+
+// Create creates an API key for the authenticated user.
+// A key can only be granted scopes the caller's own token has; requesting none grants all of them.
+// The key is returned once and only its hash is stored.
+func (s *apiKeyService) Create(ctx context.Context, user *domain.AuthUser, req *domain.CreateAPIKeyRequest) (*domain.CreateAPIKeyResponse, error) {
+	scopes, err := delegatedScopes(user, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate API key")
+		return nil, err
+	}
+
+	apiKey := &domain.APIKey{
+		UserID:  user.ID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		KeyHash: hashToken(key),
+		Scopes:  scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := s.now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := s.apiKeyRepo.Create(ctx, apiKey); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to create API key")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Str("api_key_id", apiKey.ID.String()).Msg("API key created")
+	return &domain.CreateAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+// List lists the API keys of a user
+func (s *apiKeyService) List(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	keys, err := s.apiKeyRepo.ListByUser(ctx, userID)
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to list API keys")
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key of a user
+func (s *apiKeyService) Revoke(ctx context.Context, userID, id uuid.UUID) error {
+	if err := s.apiKeyRepo.Revoke(ctx, userID, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Str("api_key_id", id.String()).Msg("Failed to revoke API key")
+		return err
+	}
+
+	s.log.Info().Str("user_id", userID.String()).Str("api_key_id", id.String()).Msg("API key revoked")
+	return nil
+}
+
+// Authenticate returns the user an active API key belongs to.
+// The key's scopes are narrowed down to what the user's current role still grants.
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (*domain.AuthUser, error) {
+	if !strings.HasPrefix(key, apiKeyMarker) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.apiKeyRepo.GetByHash(ctx, hashToken(key))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		s.log.Error().Err(err).Msg("Failed to get API key")
+		return nil, err
+	}
+
+	now := s.now()
+	if !apiKey.IsActiveAt(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(ctx, apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		s.log.Error().Err(err).Str("user_id", apiKey.UserID.String()).Msg("Failed to get API key owner")
+		return nil, err
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyLastUsedInterval {
+		if err := s.apiKeyRepo.TouchLastUsed(ctx, apiKey.ID, now); err != nil {
+			s.log.Warn().Err(err).Str("api_key_id", apiKey.ID.String()).Msg("Failed to record API key use")
+		}
+	}
+
+	scopes := make([]string, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		if user.Role.Grants(domain.Permission(scope)) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &domain.AuthUser{
+		ID:     user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+		Role:   user.Role,
+		Scopes: scopes,
+	}, nil
+}
+
+// delegatedScopes returns the scopes a user may hand to a new API key or OAuth client.
+// Requesting no scopes grants every scope of the user's token.
+func delegatedScopes(user *domain.AuthUser, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		scopes := append([]string{}, user.Scopes...)
+		sort.Strings(scopes)
+		return scopes, nil
+	}
+
+	seen := make(map[string]bool, len(requested))
+	granted := make([]domain.Permission, 0, len(requested))
+	for _, scope := range requested {
+		perm := domain.Permission(scope)
+		if !domain.IsValidPermission(perm) || !user.HasScope(perm) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, perm)
+		}
+	}
+
+	return domain.ScopeStrings(granted), nil
+}
+
+// generateAPIKey returns a new API key of the form sk_<prefix>_<secret> and its visible prefix
+func generateAPIKey() (string, string, error) {
+	prefixBytes := make([]byte, apiKeyPrefixBytes)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	secretBytes := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	prefix := apiKeyMarker + hex.EncodeToString(prefixBytes)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes), prefix, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/logger"
+)
+
+// MockAPIKeyRepository is a mock implementation of repository.APIKeyRepository
+type MockAPIKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepository) Revoke(ctx context.Context, userID, id uuid.UUID) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepository) TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+// newTestAPIKeyService creates an API key service backed by fresh mocks whose clock is frozen at testNow
+func newTestAPIKeyService() (APIKeyService, *MockAPIKeyRepository, *MockUserRepository) {
+	keys := new(MockAPIKeyRepository)
+	users := new(MockUserRepository)
+	svc := NewAPIKeyService(keys, users, logger.New("debug", true))
+	svc.(*apiKeyService).now = func() time.Time { return testNow }
+	return svc, keys, users
+}
+
+func TestAPIKeyService_Create(t *testing.T) {
+	caller := &domain.AuthUser{ID: uuid.New(), Role: domain.RoleUser, Scopes: []string{"users:read", "users:write"}}
+
+	t.Run("stores only the hash and defaults to the caller's scopes", func(t *testing.T) {
+		svc, keys, _ := newTestAPIKeyService()
+
+		var stored *domain.APIKey
+		keys.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*domain.APIKey)
+		}).Return(nil)
+
+		res, err := svc.Create(context.Background(), caller, &domain.CreateAPIKeyRequest{Name: "ci", ExpiresInDays: 30})
+
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(res.Key, stored.Prefix+"_"))
+		assert.Equal(t, hashToken(res.Key), stored.KeyHash)
+		assert.Equal(t, []string{"users:read", "users:write"}, stored.Scopes)
+		assert.Equal(t, testNow.Add(30*24*time.Hour), *stored.ExpiresAt)
+	})
+
+	t.Run("scope beyond the caller's token", func(t *testing.T) {
+		svc, keys, _ := newTestAPIKeyService()
+
+		narrowed := &domain.AuthUser{ID: caller.ID, Role: domain.RoleUser, Scopes: []string{"users:read"}}
+		_, err := svc.Create(context.Background(), narrowed, &domain.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"users:write"}})
+
+		assert.True(t, errors.Is(err, ErrInvalidScope))
+		keys.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	const key = "sk_0123456789ab_secret"
+	user := &domain.User{ID: uuid.New(), Name: "CI", Email: "ci@example.com", Role: domain.RoleUser}
+
+	t.Run("success narrows scopes to the current role", func(t *testing.T) {
+		svc, keys, users := newTestAPIKeyService()
+
+		apiKey := &domain.APIKey{ID: uuid.New(), UserID: user.ID, Scopes: []string{"users:manage", "users:read"}}
+		keys.On("GetByHash", mock.Anything, hashToken(key)).Return(apiKey, nil)
+		users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		keys.On("TouchLastUsed", mock.Anything, apiKey.ID, testNow).Return(nil)
+
+		authUser, err := svc.Authenticate(context.Background(), key)
+
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, authUser.ID)
+		assert.Equal(t, []string{"users:read"}, authUser.Scopes)
+		keys.AssertExpectations(t)
+	})
+
+	t.Run("recently used key is not touched again", func(t *testing.T) {
+		svc, keys, users := newTestAPIKeyService()
+
+		lastUsed := testNow.Add(-10 * time.Second)
+		keys.On("GetByHash", mock.Anything, hashToken(key)).Return(&domain.APIKey{ID: uuid.New(), UserID: user.ID, LastUsedAt: &lastUsed}, nil)
+		users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := svc.Authenticate(context.Background(), key)
+
+		assert.NoError(t, err)
+		keys.AssertNotCalled(t, "TouchLastUsed", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	revokedAt := testNow.Add(-time.Hour)
+	expiredAt := testNow.Add(-time.Second)
+	cases := []struct {
+		name   string
+		apiKey *domain.APIKey
+		err    error
+	}{
+		{"unknown", nil, repository.ErrNotFound},
+		{"revoked", &domain.APIKey{UserID: user.ID, RevokedAt: &revokedAt}, nil},
+		{"expired", &domain.APIKey{UserID: user.ID, ExpiresAt: &expiredAt}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, keys, users := newTestAPIKeyService()
+
+			keys.On("GetByHash", mock.Anything, hashToken(key)).Return(tc.apiKey, tc.err)
+
+			_, err := svc.Authenticate(context.Background(), key)
+
+			assert.True(t, errors.Is(err, ErrInvalidAPIKey))
+			users.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("not an API key", func(t *testing.T) {
+		svc, keys, _ := newTestAPIKeyService()
+
+		_, err := svc.Authenticate(context.Background(), "eyJhbGciOi...")
+
+		assert.True(t, errors.Is(err, ErrInvalidAPIKey))
+		keys.AssertNotCalled(t, "GetByHash", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	svc, keys, _ := newTestAPIKeyService()
+
+	userID, id := uuid.New(), uuid.New()
+	keys.On("Revoke", mock.Anything, userID, id).Return(repository.ErrNotFound)
+
+	err := svc.Revoke(context.Background(), userID, id)
+
+	assert.True(t, errors.Is(err, ErrAPIKeyNotFound))
+}
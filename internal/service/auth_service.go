@@ -3,47 +3,163 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 
+	"go-echo-starter/internal/config"
 	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/hasher"
 	"go-echo-starter/pkg/jwt"
 	"go-echo-starter/pkg/logger"
+	"go-echo-starter/pkg/mailer"
+	"go-echo-starter/pkg/oidc"
+	"go-echo-starter/pkg/passwordpolicy"
 )
 
 // Common auth errors
 var (
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrEmailAlreadyExists = errors.New("email already exists")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrEmailAlreadyExists  = errors.New("email already exists")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrInvalidScope        = errors.New("requested scope is invalid or not permitted")
+	ErrInvalidResetToken   = errors.New("invalid or expired password reset token")
+	ErrInvalidVerifyToken  = errors.New("invalid or expired email verification token")
+	ErrEmailNotVerified    = errors.New("email address has not been verified")
+	ErrIncorrectPassword   = errors.New("current password is incorrect")
+	ErrPasswordTooLong     = errors.New("password is too long")
+	ErrPasswordPolicy      = errors.New("password does not meet the password policy")
 )
 
+// PasswordPolicyError lists the password policy rules a new password breaks.
+// It unwraps to ErrPasswordPolicy.
+type PasswordPolicyError struct {
+	Violations []passwordpolicy.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrPasswordPolicy.Error()
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrPasswordPolicy
+}
+
 // AuthService defines the interface for authentication
 type AuthService interface {
 	Register(ctx context.Context, req *domain.RegisterRequest) (*domain.TokenResponse, error)
 	Login(ctx context.Context, req *domain.LoginRequest) (*domain.TokenResponse, error)
+	Refresh(ctx context.Context, req *domain.RefreshTokenRequest) (*domain.TokenResponse, error)
+	Logout(ctx context.Context, claims *jwt.Claims, req *domain.LogoutRequest) error
+	LogoutAll(ctx context.Context, userID uuid.UUID) error
+	ForgotPassword(ctx context.Context, req *domain.ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req *domain.ResetPasswordRequest) error
+	ChangePassword(ctx context.Context, claims *jwt.Claims, req *domain.ChangePasswordRequest) (*domain.TokenResponse, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, req *domain.ResendVerificationRequest) error
+	SetupTwoFactor(ctx context.Context, userID uuid.UUID) (*domain.TwoFactorSetupResponse, error)
+	EnableTwoFactor(ctx context.Context, userID uuid.UUID, req *domain.TwoFactorCodeRequest) (*domain.TwoFactorEnableResponse, error)
+	DisableTwoFactor(ctx context.Context, userID uuid.UUID, req *domain.TwoFactorCodeRequest) error
+	VerifyTwoFactor(ctx context.Context, req *domain.TwoFactorVerifyRequest) (*domain.TokenResponse, error)
+	OIDCAuthorize(ctx context.Context, provider string) (string, error)
+	OIDCCallback(ctx context.Context, provider string, req *domain.OIDCCallbackRequest) (*domain.TokenResponse, error)
+	RequestMagicLink(ctx context.Context, req *domain.MagicLinkRequest) error
+	ConsumeMagicLink(ctx context.Context, token string) (*domain.TokenResponse, error)
+	ListSessions(ctx context.Context, claims *jwt.Claims) ([]*domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	JWKS() jwt.JWKS
 }
 
 type authService struct {
-	userRepo repository.UserRepository
-	jwt      *jwt.JWT
-	log      *logger.Logger
+	userRepo         repository.UserRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	userTokenRepo    repository.UserTokenRepository
+	twoFactorRepo    repository.TwoFactorRepository
+	apiKeyRepo       repository.APIKeyRepository
+	identityRepo     repository.UserIdentityRepository
+	oidcStateRepo    repository.OIDCStateRepository
+	revocations      TokenRevocationService
+	loginThrottle    LoginThrottleService
+	hasher           hasher.PasswordHasher
+	passwordPolicy   *passwordpolicy.Policy
+	dummyHash        func() string
+	tokens           jwt.TokenIssuer
+	oidcProviders    map[string]*oidc.Provider
+	mailer           mailer.Sender
+	cfg              *config.AuthConfig
+	log              *logger.Logger
+	now              func() time.Time
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo repository.UserRepository, jwt *jwt.JWT, log *logger.Logger) AuthService {
-	return &authService{
-		userRepo: userRepo,
-		jwt:      jwt,
-		log:      log,
+func NewAuthService(
+	userRepo repository.UserRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	userTokenRepo repository.UserTokenRepository,
+	twoFactorRepo repository.TwoFactorRepository,
+	apiKeyRepo repository.APIKeyRepository,
+	identityRepo repository.UserIdentityRepository,
+	oidcStateRepo repository.OIDCStateRepository,
+	revocations TokenRevocationService,
+	loginThrottle LoginThrottleService,
+	passwordHasher hasher.PasswordHasher,
+	passwordPolicy *passwordpolicy.Policy,
+	tokens jwt.TokenIssuer,
+	oidcProviders map[string]*oidc.Provider,
+	mailer mailer.Sender,
+	cfg *config.AuthConfig,
+	log *logger.Logger,
+) AuthService {
+	s := &authService{
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		userTokenRepo:    userTokenRepo,
+		twoFactorRepo:    twoFactorRepo,
+		apiKeyRepo:       apiKeyRepo,
+		identityRepo:     identityRepo,
+		oidcStateRepo:    oidcStateRepo,
+		revocations:      revocations,
+		loginThrottle:    loginThrottle,
+		hasher:           passwordHasher,
+		passwordPolicy:   passwordPolicy,
+		tokens:           tokens,
+		oidcProviders:    oidcProviders,
+		mailer:           mailer,
+		cfg:              cfg,
+		log:              log,
+		now:              time.Now,
 	}
+
+	// Hashed on first use, so unknown emails cost as much to check as real accounts
+	s.dummyHash = sync.OnceValue(func() string {
+		hash, _ := passwordHasher.Hash("dummy-password")
+		return hash
+	})
+
+	return s
 }
 
-// Register registers a new user
+// Register registers a new user and sends a verification email.
+// When email verification is required, no token is returned until the email is verified.
+// In enumeration-safe mode no token is returned either, and registering an existing email
+// looks like a success to the caller while its owner is notified by email instead.
 func (s *authService) Register(ctx context.Context, req *domain.RegisterRequest) (*domain.TokenResponse, error) {
+	// Checked first, so the outcome does not depend on whether the email is taken
+	if err := s.checkPasswordPolicy(req.Password, req.Email, req.Name); err != nil {
+		return nil, err
+	}
+
 	// Check if email already exists
-	_, err := s.userRepo.GetByEmail(ctx, req.Email)
+	existing, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err == nil {
+		if s.cfg.EnumerationSafeRegistration {
+			return nil, s.registerExistingEmail(ctx, existing, req.Password)
+		}
 		return nil, ErrEmailAlreadyExists
 	}
 	if !errors.Is(err, repository.ErrNotFound) {
@@ -52,9 +168,8 @@ func (s *authService) Register(ctx context.Context, req *domain.RegisterRequest)
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
-		s.log.Error().Err(err).Msg("Failed to hash password")
 		return nil, err
 	}
 
@@ -62,59 +177,650 @@ func (s *authService) Register(ctx context.Context, req *domain.RegisterRequest)
 	user := &domain.User{
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
+		Role:     domain.RoleUser,
 	}
 
 	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			if s.cfg.EnumerationSafeRegistration {
+				return nil, nil
+			}
+			return nil, ErrEmailAlreadyExists
+		}
 		s.log.Error().Err(err).Msg("Failed to create user")
 		return nil, err
 	}
 
-	// Generate token
-	token, err := s.jwt.Generate(user)
-	if err != nil {
-		s.log.Error().Err(err).Msg("Failed to generate token")
-		return nil, err
+	// Send verification email; the user can ask for another one if this fails
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		s.log.Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send verification email")
 	}
 
 	s.log.Info().Str("user_id", user.ID.String()).Msg("User registered successfully")
 
-	return &domain.TokenResponse{
-		AccessToken: token,
-		TokenType:   "Bearer",
-		ExpiresIn:   s.jwt.GetExpireTime(),
-	}, nil
+	// Unverified users cannot log in, so do not hand out tokens either.
+	// Enumeration-safe mode never does, so new and existing emails get the same response.
+	if s.cfg.RequireEmailVerification || s.cfg.EnumerationSafeRegistration {
+		return nil, nil
+	}
+
+	// Generate tokens
+	return s.issueTokens(ctx, user, uuid.New(), domain.ScopeStrings(domain.PermissionsForRole(user.Role)))
 }
 
-// Login authenticates a user
+// Login authenticates a user.
+// Users with two-factor authentication enabled get a short-lived MFA token instead,
+// which has to be exchanged together with a code via VerifyTwoFactor.
 func (s *authService) Login(ctx context.Context, req *domain.LoginRequest) (*domain.TokenResponse, error) {
+	client := domain.ClientInfoFromContext(ctx)
+
+	// Refuse attempts while the account or client is locked out
+	if err := s.loginThrottle.Check(ctx, req.Email, client.IP); err != nil {
+		return nil, err
+	}
+
 	// Get user by email
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
-			return nil, ErrInvalidCredentials
+			// Spend as long as for a real account so timing does not reveal registered emails
+			s.verifyPassword(req.Password, s.dummyHash())
+			return nil, s.loginFailed(ctx, req.Email, client.IP)
 		}
 		s.log.Error().Err(err).Msg("Failed to get user by email")
 		return nil, err
 	}
 
 	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, ErrInvalidCredentials
+	if !s.verifyPassword(req.Password, user.Password) {
+		return nil, s.loginFailed(ctx, req.Email, client.IP)
 	}
 
-	// Generate token
-	token, err := s.jwt.Generate(user)
+	// Upgrade hashes made with an outdated algorithm or cost while the password is at hand
+	s.rehashPassword(ctx, user, req.Password)
+
+	if s.cfg.RequireEmailVerification && !user.IsEmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Failures are only cleared once the second factor has been checked as well
+	if user.IsTwoFactorEnabled() {
+		return s.issueMFAToken(ctx, user)
+	}
+
+	if err := s.loginThrottle.RecordSuccess(ctx, req.Email); err != nil {
+		return nil, err
+	}
+
+	// Resolve granted scopes
+	scopes, err := grantScopes(user.Role, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate tokens
+	token, err := s.issueTokens(ctx, user, uuid.New(), scopes)
 	if err != nil {
-		s.log.Error().Err(err).Msg("Failed to generate token")
 		return nil, err
 	}
 
 	s.log.Info().Str("user_id", user.ID.String()).Msg("User logged in successfully")
 
+	return token, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair.
+// Every refresh token can be used once; presenting one that was already used
+// revokes the whole token family, since it means the token has leaked.
+func (s *authService) Refresh(ctx context.Context, req *domain.RefreshTokenRequest) (*domain.TokenResponse, error) {
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		s.log.Error().Err(err).Msg("Failed to get refresh token")
+		return nil, err
+	}
+
+	// Tokens issued to OAuth clients are only refreshed at the OAuth token endpoint
+	if stored.ClientID != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+
+	if s.now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Mark as used; losing this race means another request rotated it first
+	if err := s.refreshTokenRepo.MarkUsed(ctx, stored.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, s.handleRefreshTokenReuse(ctx, stored)
+		}
+		s.log.Error().Err(err).Msg("Failed to mark refresh token as used")
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to get user for refresh")
+		return nil, err
+	}
+
+	// Keep the scopes of the family, minus anything the user's role no longer grants.
+	// Only tokens stored before scopes were recorded have none and get the whole role.
+	if len(stored.Scopes) == 0 {
+		return s.issueTokens(ctx, user, stored.FamilyID, domain.ScopeStrings(domain.PermissionsForRole(user.Role)))
+	}
+
+	scopes := make([]string, 0, len(stored.Scopes))
+	for _, scope := range stored.Scopes {
+		if user.Role.Grants(domain.Permission(scope)) {
+			scopes = append(scopes, scope)
+		}
+	}
+	// A family narrowed down to nothing must not fall back to the whole role on its next rotation
+	if len(scopes) == 0 {
+		s.log.Info().Str("user_id", user.ID.String()).Msg("Refresh token has no scope left that the user's role grants")
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(ctx, user, stored.FamilyID, scopes)
+}
+
+// Logout revokes the current access token and, if given, the refresh token family
+func (s *authService) Logout(ctx context.Context, claims *jwt.Claims, req *domain.LogoutRequest) error {
+	if err := s.revocations.Revoke(ctx, claims); err != nil {
+		return err
+	}
+
+	if req.RefreshToken != "" {
+		stored, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			s.log.Error().Err(err).Msg("Failed to get refresh token")
+			return err
+		}
+
+		// Never let one user revoke another user's session
+		if stored != nil && stored.UserID == claims.UserID {
+			if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.log.Info().Str("user_id", claims.UserID.String()).Msg("User logged out successfully")
+	return nil
+}
+
+// LogoutAll revokes every access and refresh token of a user
+func (s *authService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	if err := s.revokeAllTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	s.log.Info().Str("user_id", userID.String()).Msg("User logged out of all sessions")
+	return nil
+}
+
+// ForgotPassword emails a password reset link if the email belongs to a user.
+// It succeeds whether or not the email is registered, so callers cannot probe for accounts.
+func (s *authService) ForgotPassword(ctx context.Context, req *domain.ForgotPasswordRequest) error {
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		s.log.Error().Err(err).Msg("Failed to get user by email")
+		return err
+	}
+
+	// Only the most recent reset link stays valid
+	if err := s.userTokenRepo.DeleteForUser(ctx, user.ID, domain.TokenPurposePasswordReset); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to delete previous reset tokens")
+		return err
+	}
+
+	token, err := s.createUserToken(ctx, user.ID, domain.TokenPurposePasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to reset your password. It expires in %s.\n\n%s\n\nIf you did not request a password reset, you can ignore this email.\n",
+			user.Name, s.cfg.PasswordResetTTL, linkWithToken(s.cfg.PasswordResetURL, token),
+		),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send password reset email")
+		return err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("Password reset requested")
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and revokes all existing sessions
+func (s *authService) ResetPassword(ctx context.Context, req *domain.ResetPasswordRequest) error {
+	// Look the token up without consuming it, so a rejected password does not burn the link
+	stored, err := s.userTokenRepo.GetActive(ctx, domain.TokenPurposePasswordReset, hashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		s.log.Error().Err(err).Msg("Failed to get password reset token")
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to get user for password reset")
+		return err
+	}
+
+	if err := s.checkPasswordPolicy(req.Password, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.userTokenRepo.Consume(ctx, domain.TokenPurposePasswordReset, stored.TokenHash); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		s.log.Error().Err(err).Msg("Failed to consume password reset token")
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, stored.UserID, hashedPassword); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to update password")
+		return err
+	}
+
+	if err := s.revokeAllTokens(ctx, stored.UserID); err != nil {
+		return err
+	}
+
+	s.log.Info().Str("user_id", stored.UserID.String()).Msg("Password reset successfully")
+	return nil
+}
+
+// ChangePassword changes the password of the authenticated user.
+// Every other token of the user is revoked and a fresh token pair is returned for the caller.
+func (s *authService) ChangePassword(ctx context.Context, claims *jwt.Claims, req *domain.ChangePasswordRequest) (*domain.TokenResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", claims.UserID.String()).Msg("Failed to get user for password change")
+		return nil, err
+	}
+
+	if !s.verifyPassword(req.CurrentPassword, user.Password) {
+		return nil, ErrIncorrectPassword
+	}
+
+	if err := s.checkPasswordPolicy(req.NewPassword, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hashPassword(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to update password")
+		return nil, err
+	}
+
+	if err := s.revokeAllTokens(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	// Outstanding reset links would allow undoing the change
+	if err := s.userTokenRepo.DeleteForUser(ctx, user.ID, domain.TokenPurposePasswordReset); err != nil {
+		s.log.Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to delete password reset tokens")
+	}
+
+	// Reload the user to pick up the bumped token version
+	user, err = s.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", claims.UserID.String()).Msg("Failed to get user after password change")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("Password changed successfully")
+
+	return s.issueTokens(ctx, user, uuid.New(), claims.Scopes)
+}
+
+// VerifyEmail marks the email of the token's user as verified
+func (s *authService) VerifyEmail(ctx context.Context, token string) error {
+	stored, err := s.userTokenRepo.Consume(ctx, domain.TokenPurposeEmailVerification, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidVerifyToken
+		}
+		s.log.Error().Err(err).Msg("Failed to consume email verification token")
+		return err
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, stored.UserID); err != nil {
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to mark email as verified")
+		return err
+	}
+
+	s.log.Info().Str("user_id", stored.UserID.String()).Msg("Email verified successfully")
+	return nil
+}
+
+// ResendVerification sends a new verification email if the email belongs to an unverified user.
+// It succeeds whether or not the email is registered, so callers cannot probe for accounts.
+func (s *authService) ResendVerification(ctx context.Context, req *domain.ResendVerificationRequest) error {
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		s.log.Error().Err(err).Msg("Failed to get user by email")
+		return err
+	}
+
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// registerExistingEmail handles an enumeration-safe registration for an email that is already taken.
+// It does the same expensive work as a real registration and tells the owner about the attempt.
+func (s *authService) registerExistingEmail(ctx context.Context, user *domain.User, password string) error {
+	if _, err := s.hashPassword(password); err != nil {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      user.Email,
+		Subject: "Someone tried to register with your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone just tried to create an account with this email address, but you already have one.\n\nIf this was you, log in instead or reset your password at:\n\n%s\n\nOtherwise you can ignore this email.\n",
+			user.Name, s.cfg.PasswordResetURL,
+		),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send existing account notice")
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("Registration attempted for existing email")
+	return nil
+}
+
+// JWKS returns the public keys access tokens are signed with.
+// It is empty if the token issuer does not publish any.
+func (s *authService) JWKS() jwt.JWKS {
+	if provider, ok := s.tokens.(jwt.KeySetProvider); ok {
+		return provider.JWKS()
+	}
+	return jwt.JWKS{Keys: []jwt.JWK{}}
+}
+
+// sendVerificationEmail replaces any outstanding verification token and emails a new link
+func (s *authService) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	if err := s.userTokenRepo.DeleteForUser(ctx, user.ID, domain.TokenPurposeEmailVerification); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to delete previous verification tokens")
+		return err
+	}
+
+	token, err := s.createUserToken(ctx, user.ID, domain.TokenPurposeEmailVerification, s.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Name, s.cfg.EmailVerificationTTL, linkWithToken(s.cfg.EmailVerificationURL, token),
+		),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send verification email")
+		return err
+	}
+
+	return nil
+}
+
+// loginFailed records a failed login attempt and returns the error to report for it
+func (s *authService) loginFailed(ctx context.Context, email, ip string) error {
+	if err := s.loginThrottle.RecordFailure(ctx, email, ip); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// checkPasswordPolicy returns a *PasswordPolicyError if a new password breaks the password policy.
+// userInputs are details of the account the password must not be built from.
+func (s *authService) checkPasswordPolicy(password string, userInputs ...string) error {
+	violations, err := s.passwordPolicy.Check(password, userInputs...)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to check password policy")
+		return err
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// hashPassword hashes a password for storage
+func (s *authService) hashPassword(password string) (string, error) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		if errors.Is(err, hasher.ErrPasswordTooLong) {
+			return "", ErrPasswordTooLong
+		}
+		s.log.Error().Err(err).Msg("Failed to hash password")
+		return "", err
+	}
+	return hashedPassword, nil
+}
+
+// verifyPassword reports whether a password matches a stored hash
+func (s *authService) verifyPassword(password, encoded string) bool {
+	ok, err := s.hasher.Verify(password, encoded)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to verify password")
+		return false
+	}
+	return ok
+}
+
+// rehashPassword replaces an outdated password hash with one using the current settings.
+// Failing to do so is not fatal; it is retried on the next login.
+func (s *authService) rehashPassword(ctx context.Context, user *domain.User, password string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		s.log.Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to rehash password")
+		return
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		s.log.Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to store rehashed password")
+		return
+	}
+
+	user.Password = hashedPassword
+	s.log.Info().Str("user_id", user.ID.String()).Msg("Password rehashed with current settings")
+}
+
+// createUserToken generates and stores a single-use token, returning the raw token
+func (s *authService) createUserToken(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose, ttl time.Duration) (string, error) {
+	token, tokenHash, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate user token")
+		return "", err
+	}
+
+	err = s.userTokenRepo.Create(ctx, &domain.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: s.now().Add(ttl),
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Str("purpose", string(purpose)).Msg("Failed to store user token")
+		return "", err
+	}
+
+	return token, nil
+}
+
+// linkWithToken appends a token query parameter to a URL
+func linkWithToken(base, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// revokeAllTokens revokes every access token, refresh token and API key of a user
+func (s *authService) revokeAllTokens(ctx context.Context, userID uuid.UUID) error {
+	if err := s.revocations.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to revoke refresh tokens")
+		return err
+	}
+
+	if err := s.apiKeyRepo.RevokeAllForUser(ctx, userID); err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to revoke API keys")
+		return err
+	}
+
+	return nil
+}
+
+// handleRefreshTokenReuse revokes the family of a refresh token that was presented again
+func (s *authService) handleRefreshTokenReuse(ctx context.Context, stored *domain.RefreshToken) error {
+	s.log.Warn().
+		Str("user_id", stored.UserID.String()).
+		Str("family_id", stored.FamilyID.String()).
+		Msg("Refresh token reuse detected, revoking token family")
+
+	if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// revokeFamily revokes a refresh token family along with the access tokens
+// issued in the session it makes up
+func (s *authService) revokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, familyID); err != nil {
+		s.log.Error().Err(err).Str("family_id", familyID.String()).Msg("Failed to revoke refresh token family")
+		return err
+	}
+
+	s.revocations.MarkSessionRevoked(familyID)
+	return nil
+}
+
+// issueTokens generates an access token and a refresh token in the given family.
+// The family is the session both tokens belong to, recorded with the client they are issued to.
+func (s *authService) issueTokens(ctx context.Context, user *domain.User, familyID uuid.UUID, scopes []string) (*domain.TokenResponse, error) {
+	accessToken, err := s.tokens.Generate(user, familyID, scopes)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate token")
+		return nil, err
+	}
+
+	refreshToken, refreshTokenHash, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate refresh token")
+		return nil, err
+	}
+
+	client := domain.ClientInfoFromContext(ctx)
+	err = s.refreshTokenRepo.Create(ctx, &domain.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: refreshTokenHash,
+		Scopes:    scopes,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IP,
+		ExpiresAt: s.now().Add(s.cfg.RefreshTokenTTL),
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to store refresh token")
+		return nil, err
+	}
+
 	return &domain.TokenResponse{
-		AccessToken: token,
-		TokenType:   "Bearer",
-		ExpiresIn:   s.jwt.GetExpireTime(),
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    s.tokens.GetExpireTime(),
+		Scope:        domain.JoinScopes(scopes),
 	}, nil
 }
+
+// grantScopes returns the scopes to grant to a user of the given role.
+// Requesting no scopes grants every permission of the role.
+func grantScopes(role domain.Role, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return domain.ScopeStrings(domain.PermissionsForRole(role)), nil
+	}
+
+	seen := make(map[string]bool, len(requested))
+	granted := make([]domain.Permission, 0, len(requested))
+	for _, scope := range requested {
+		perm := domain.Permission(scope)
+		if !domain.IsValidPermission(perm) || !role.Grants(perm) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, perm)
+		}
+	}
+
+	return domain.ScopeStrings(granted), nil
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,22 +15,287 @@ import (
 	"go-echo-starter/internal/config"
 	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/hasher"
 	"go-echo-starter/pkg/jwt"
+	"go-echo-starter/pkg/jwt/jwttest"
 	"go-echo-starter/pkg/logger"
+	"go-echo-starter/pkg/mailer"
+	"go-echo-starter/pkg/passwordpolicy"
 )
 
-// MockJWT is a mock implementation of jwt.JWT
-// Actually, jwt.JWT is a struct, we might need an interface or just mock it.
-// Since jwt.JWT is a struct, I'll mock the internal behavior or just use a real one with a test secret.
-// Alternatively, I can create an interface for JWT if it was missing.
+// MockRefreshTokenRepository is a mock implementation of repository.RefreshTokenRepository
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
 
-func TestAuthService_Register(t *testing.T) {
-	log := logger.New("debug", true)
-	jwtSvc := jwt.New(&config.JWTConfig{Secret: "test-secret", ExpireTime: 24 * time.Hour})
+func (m *MockRefreshTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.RefreshToken), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeForClient(ctx context.Context, userID, clientID uuid.UUID) error {
+	args := m.Called(ctx, userID, clientID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) ListSessions(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Session), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) TouchSession(ctx context.Context, familyID uuid.UUID, at time.Time) error {
+	args := m.Called(ctx, familyID, at)
+	return args.Error(0)
+}
+
+// MockTokenRevocationService is a mock implementation of TokenRevocationService
+type MockTokenRevocationService struct {
+	mock.Mock
+}
+
+func (m *MockTokenRevocationService) Revoke(ctx context.Context, claims *jwt.Claims) error {
+	args := m.Called(ctx, claims)
+	return args.Error(0)
+}
 
+func (m *MockTokenRevocationService) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRevocationService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRevocationService) MarkSessionRevoked(sessionID uuid.UUID) {
+	m.Called(sessionID)
+}
+
+func (m *MockTokenRevocationService) IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	args := m.Called(ctx, claims)
+	return args.Bool(0), args.Error(1)
+}
+
+// MockUserTokenRepository is a mock implementation of repository.UserTokenRepository
+type MockUserTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserTokenRepository) Create(ctx context.Context, token *domain.UserToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockUserTokenRepository) GetActive(ctx context.Context, purpose domain.TokenPurpose, hash string) (*domain.UserToken, error) {
+	args := m.Called(ctx, purpose, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserToken), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) Consume(ctx context.Context, purpose domain.TokenPurpose, hash string) (*domain.UserToken, error) {
+	args := m.Called(ctx, purpose, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserToken), args.Error(1)
+}
+
+func (m *MockUserTokenRepository) DeleteForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error {
+	args := m.Called(ctx, userID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockUserTokenRepository) ConsumeForUser(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose) error {
+	args := m.Called(ctx, userID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockUserTokenRepository) CountCreatedSince(ctx context.Context, userID uuid.UUID, purpose domain.TokenPurpose, since time.Time) (int, error) {
+	args := m.Called(ctx, userID, purpose, since)
+	return args.Int(0), args.Error(1)
+}
+
+// MockTwoFactorRepository is a mock implementation of repository.TwoFactorRepository
+type MockTwoFactorRepository struct {
+	mock.Mock
+}
+
+func (m *MockTwoFactorRepository) GetTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPConfig, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.TOTPConfig), args.Error(1)
+}
+
+func (m *MockTwoFactorRepository) SetPendingSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	args := m.Called(ctx, userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) Enable(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	args := m.Called(ctx, userID, step, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) Disable(ctx context.Context, userID uuid.UUID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorRepository) ConsumeRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) error {
+	args := m.Called(ctx, userID, hash)
+	return args.Error(0)
+}
+
+// MockLoginThrottleService is a mock implementation of LoginThrottleService
+type MockLoginThrottleService struct {
+	mock.Mock
+}
+
+func (m *MockLoginThrottleService) Check(ctx context.Context, email, ip string) error {
+	args := m.Called(ctx, email, ip)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) RecordFailure(ctx context.Context, email, ip string) error {
+	args := m.Called(ctx, email, ip)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *MockLoginThrottleService) Unlock(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+// MockMailer is a mock implementation of mailer.Sender
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	args := m.Called(ctx, msg)
+	return args.Error(0)
+}
+
+var (
+	testAuthConfig = &config.AuthConfig{
+		RefreshTokenTTL:      24 * time.Hour,
+		PasswordResetTTL:     30 * time.Minute,
+		PasswordResetURL:     "http://localhost:3000/reset-password",
+		EmailVerificationTTL: 24 * time.Hour,
+		EmailVerificationURL: "http://localhost:8080/api/v1/auth/verify",
+		MFATokenTTL:          5 * time.Minute,
+		TOTPIssuer:           "go-echo-starter",
+		OIDCStateTTL:         10 * time.Minute,
+		OAuthCodeTTL:         time.Minute,
+		MagicLinkTTL:         15 * time.Minute,
+		MagicLinkURL:         "http://localhost:8080/api/v1/auth/magic-link/consume",
+		MagicLinkLimit:       3,
+		MagicLinkWindow:      15 * time.Minute,
+	}
+	testHasher, _ = hasher.New(&config.PasswordConfig{Algorithm: hasher.AlgorithmBcrypt, BcryptCost: bcrypt.MinCost})
+	testPolicy    = passwordpolicy.New(&config.PasswordConfig{MinLength: 8, ForbidUserInfo: true})
+)
+
+// authServiceMocks holds the mocked dependencies of an auth service under test
+type authServiceMocks struct {
+	users         *MockUserRepository
+	refreshTokens *MockRefreshTokenRepository
+	userTokens    *MockUserTokenRepository
+	twoFactor     *MockTwoFactorRepository
+	apiKeys       *MockAPIKeyRepository
+	identities    *MockUserIdentityRepository
+	oidcStates    *MockOIDCStateRepository
+	revocations   *MockTokenRevocationService
+	loginThrottle *MockLoginThrottleService
+	mailer        *MockMailer
+	tokens        *jwttest.Fake
+}
+
+// newTestAuthService creates an auth service backed by fresh mocks
+func newTestAuthService() (AuthService, *authServiceMocks) {
+	return newTestAuthServiceWithConfig(testAuthConfig)
+}
+
+// newTestAuthServiceWithConfig creates an auth service with the given config backed by fresh mocks
+func newTestAuthServiceWithConfig(cfg *config.AuthConfig) (AuthService, *authServiceMocks) {
+	m := &authServiceMocks{
+		users:         new(MockUserRepository),
+		refreshTokens: new(MockRefreshTokenRepository),
+		userTokens:    new(MockUserTokenRepository),
+		twoFactor:     new(MockTwoFactorRepository),
+		apiKeys:       new(MockAPIKeyRepository),
+		identities:    new(MockUserIdentityRepository),
+		oidcStates:    new(MockOIDCStateRepository),
+		revocations:   new(MockTokenRevocationService),
+		loginThrottle: new(MockLoginThrottleService),
+		mailer:        new(MockMailer),
+		tokens:        jwttest.New(),
+	}
+	svc := NewAuthService(
+		m.users,
+		m.refreshTokens,
+		m.userTokens,
+		m.twoFactor,
+		m.apiKeys,
+		m.identities,
+		m.oidcStates,
+		m.revocations,
+		m.loginThrottle,
+		testHasher,
+		testPolicy,
+		m.tokens,
+		nil,
+		m.mailer,
+		cfg,
+		logger.New("debug", true),
+	)
+	return svc, m
+}
+
+func TestAuthService_Register(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
-		repo := new(MockUserRepository)
-		svc := NewAuthService(repo, jwtSvc, log)
+		svc, m := newTestAuthService()
 
 		req := &domain.RegisterRequest{
 			Name:     "Test User",
@@ -37,22 +303,56 @@ func TestAuthService_Register(t *testing.T) {
 			Password: "password123",
 		}
 
-		repo.On("GetByEmail", mock.Anything, req.Email).Return(nil, repository.ErrNotFound)
-		repo.On("Create", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(nil, repository.ErrNotFound)
+		m.users.On("Create", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
 			return u.Name == req.Name && u.Email == req.Email
 		})).Return(nil)
+		m.userTokens.On("DeleteForUser", mock.Anything, mock.Anything, domain.TokenPurposeEmailVerification).Return(nil)
+		m.userTokens.On("Create", mock.Anything, mock.MatchedBy(func(ut *domain.UserToken) bool {
+			return ut.Purpose == domain.TokenPurposeEmailVerification
+		})).Return(nil)
+		m.mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg *mailer.Message) bool {
+			return msg.To == req.Email && strings.Contains(msg.Body, "/api/v1/auth/verify?token=")
+		})).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
 
 		res, err := svc.Register(context.Background(), req)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
 		assert.NotEmpty(t, res.AccessToken)
-		repo.AssertExpectations(t)
+		assert.NotEmpty(t, res.RefreshToken)
+		m.users.AssertExpectations(t)
+		m.refreshTokens.AssertExpectations(t)
+		m.mailer.AssertExpectations(t)
+	})
+
+	t.Run("verification required returns no token", func(t *testing.T) {
+		cfg := *testAuthConfig
+		cfg.RequireEmailVerification = true
+		svc, m := newTestAuthServiceWithConfig(&cfg)
+
+		req := &domain.RegisterRequest{
+			Name:     "Test User",
+			Email:    "test@example.com",
+			Password: "password123",
+		}
+
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(nil, repository.ErrNotFound)
+		m.users.On("Create", mock.Anything, mock.Anything).Return(nil)
+		m.userTokens.On("DeleteForUser", mock.Anything, mock.Anything, domain.TokenPurposeEmailVerification).Return(nil)
+		m.userTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+		m.mailer.On("Send", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.Register(context.Background(), req)
+
+		assert.NoError(t, err)
+		assert.Nil(t, res)
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
 	})
 
 	t.Run("email already exists", func(t *testing.T) {
-		repo := new(MockUserRepository)
-		svc := NewAuthService(repo, jwtSvc, log)
+		svc, m := newTestAuthService()
 
 		req := &domain.RegisterRequest{
 			Name:     "Test User",
@@ -60,24 +360,74 @@ func TestAuthService_Register(t *testing.T) {
 			Password: "password123",
 		}
 
-		repo.On("GetByEmail", mock.Anything, req.Email).Return(&domain.User{ID: uuid.New()}, nil)
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(&domain.User{ID: uuid.New()}, nil)
 
 		res, err := svc.Register(context.Background(), req)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.True(t, errors.Is(err, ErrEmailAlreadyExists))
-		repo.AssertExpectations(t)
+		m.users.AssertExpectations(t)
+	})
+
+	t.Run("enumeration-safe mode hides existing email", func(t *testing.T) {
+		cfg := *testAuthConfig
+		cfg.EnumerationSafeRegistration = true
+		svc, m := newTestAuthServiceWithConfig(&cfg)
+
+		existing := &domain.User{ID: uuid.New(), Name: "Owner", Email: "test@example.com"}
+		req := &domain.RegisterRequest{Name: "Test User", Email: existing.Email, Password: "password123"}
+
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(existing, nil)
+		m.mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg *mailer.Message) bool {
+			return msg.To == existing.Email && strings.Contains(msg.Subject, "tried to register")
+		})).Return(nil)
+
+		res, err := svc.Register(context.Background(), req)
+
+		assert.NoError(t, err)
+		assert.Nil(t, res)
+		m.users.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		m.mailer.AssertExpectations(t)
+	})
+
+	t.Run("enumeration-safe mode returns no token for new email", func(t *testing.T) {
+		cfg := *testAuthConfig
+		cfg.EnumerationSafeRegistration = true
+		svc, m := newTestAuthServiceWithConfig(&cfg)
+
+		req := &domain.RegisterRequest{Name: "Test User", Email: "new@example.com", Password: "password123"}
+
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(nil, repository.ErrNotFound)
+		m.users.On("Create", mock.Anything, mock.Anything).Return(nil)
+		m.userTokens.On("DeleteForUser", mock.Anything, mock.Anything, domain.TokenPurposeEmailVerification).Return(nil)
+		m.userTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+		m.mailer.On("Send", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.Register(context.Background(), req)
+
+		assert.NoError(t, err)
+		assert.Nil(t, res)
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+	t.Run("password containing the email is rejected before lookup", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		req := &domain.RegisterRequest{Name: "Test User", Email: "alice@example.com", Password: "alice12345"}
+
+		res, err := svc.Register(context.Background(), req)
+
+		assert.Nil(t, res)
+		var policyErr *PasswordPolicyError
+		assert.True(t, errors.As(err, &policyErr))
+		assert.Equal(t, passwordpolicy.RuleUserInfo, policyErr.Violations[0].Rule)
+		m.users.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
 	})
 }
 
 func TestAuthService_Login(t *testing.T) {
-	log := logger.New("debug", true)
-	jwtSvc := jwt.New(&config.JWTConfig{Secret: "test-secret", ExpireTime: 24 * time.Hour})
-
 	t.Run("success", func(t *testing.T) {
-		repo := new(MockUserRepository)
-		svc := NewAuthService(repo, jwtSvc, log)
+		svc, m := newTestAuthService()
 
 		password := "password123"
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -92,32 +442,592 @@ func TestAuthService_Login(t *testing.T) {
 			Password: password,
 		}
 
-		repo.On("GetByEmail", mock.Anything, req.Email).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, req.Email, "").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(user, nil)
+		m.loginThrottle.On("RecordSuccess", mock.Anything, req.Email).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.MatchedBy(func(rt *domain.RefreshToken) bool {
+			return rt.UserID == user.ID && rt.TokenHash != ""
+		})).Return(nil)
 
 		res, err := svc.Login(context.Background(), req)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
 		assert.NotEmpty(t, res.AccessToken)
-		repo.AssertExpectations(t)
+		assert.NotEmpty(t, res.RefreshToken)
+		m.users.AssertExpectations(t)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("narrowed scopes", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword), Role: domain.RoleAdmin}
+
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.loginThrottle.On("RecordSuccess", mock.Anything, user.Email).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.MatchedBy(func(rt *domain.RefreshToken) bool {
+			return assert.ObjectsAreEqual([]string{"users:read"}, rt.Scopes)
+		})).Return(nil)
+
+		res, err := svc.Login(context.Background(), &domain.LoginRequest{
+			Email:    user.Email,
+			Password: "password123",
+			Scopes:   []string{"users:read", "users:read"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "users:read", res.Scope)
+
+		claims, err := m.tokens.Validate(res.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"users:read"}, claims.Scopes)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("scope not granted by role", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword), Role: domain.RoleUser}
+
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.loginThrottle.On("RecordSuccess", mock.Anything, user.Email).Return(nil)
+
+		res, err := svc.Login(context.Background(), &domain.LoginRequest{
+			Email:    user.Email,
+			Password: "password123",
+			Scopes:   []string{"users:manage"},
+		})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrInvalidScope))
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unverified email refused when verification required", func(t *testing.T) {
+		cfg := *testAuthConfig
+		cfg.RequireEmailVerification = true
+		svc, m := newTestAuthServiceWithConfig(&cfg)
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword), Role: domain.RoleUser}
+
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		res, err := svc.Login(context.Background(), &domain.LoginRequest{Email: user.Email, Password: "password123"})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrEmailNotVerified))
 	})
 
 	t.Run("invalid credentials", func(t *testing.T) {
-		repo := new(MockUserRepository)
-		svc := NewAuthService(repo, jwtSvc, log)
+		svc, m := newTestAuthService()
 
 		req := &domain.LoginRequest{
 			Email:    "test@example.com",
 			Password: "wrongpassword",
 		}
 
-		repo.On("GetByEmail", mock.Anything, req.Email).Return(nil, repository.ErrNotFound)
+		m.loginThrottle.On("Check", mock.Anything, req.Email, "").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, req.Email).Return(nil, repository.ErrNotFound)
+		m.loginThrottle.On("RecordFailure", mock.Anything, req.Email, "").Return(nil)
 
 		res, err := svc.Login(context.Background(), req)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.True(t, errors.Is(err, ErrInvalidCredentials))
-		repo.AssertExpectations(t)
+		m.users.AssertExpectations(t)
+		m.loginThrottle.AssertExpectations(t)
+	})
+
+	t.Run("wrong password counts as failure", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword)}
+		ctx := domain.WithClientInfo(context.Background(), domain.ClientInfo{IP: "203.0.113.7"})
+
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "203.0.113.7").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.loginThrottle.On("RecordFailure", mock.Anything, user.Email, "203.0.113.7").Return(nil)
+
+		res, err := svc.Login(ctx, &domain.LoginRequest{Email: user.Email, Password: "wrongpassword"})
+
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+		m.loginThrottle.AssertExpectations(t)
+		m.loginThrottle.AssertNotCalled(t, "RecordSuccess", mock.Anything, mock.Anything)
+	})
+
+	t.Run("outdated hash is upgraded", func(t *testing.T) {
+		svc, m := newTestAuthService()
+		argon2Hasher, _ := hasher.New(&config.PasswordConfig{
+			Algorithm:         hasher.AlgorithmArgon2id,
+			Argon2Memory:      1024,
+			Argon2Iterations:  1,
+			Argon2Parallelism: 1,
+		})
+		svc.(*authService).hasher = argon2Hasher
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword)}
+
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.users.On("UpdatePassword", mock.Anything, user.ID, mock.MatchedBy(func(hash string) bool {
+			ok, err := argon2Hasher.Verify("password123", hash)
+			return strings.HasPrefix(hash, "$argon2id$") && ok && err == nil
+		})).Return(nil)
+		m.loginThrottle.On("RecordSuccess", mock.Anything, user.Email).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.Login(context.Background(), &domain.LoginRequest{Email: user.Email, Password: "password123"})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.AccessToken)
+		m.users.AssertExpectations(t)
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		locked := &LoginThrottledError{Err: ErrAccountLocked, RetryAfter: time.Minute}
+		m.loginThrottle.On("Check", mock.Anything, "test@example.com", "").Return(locked)
+
+		res, err := svc.Login(context.Background(), &domain.LoginRequest{Email: "test@example.com", Password: "password123"})
+
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, ErrAccountLocked)
+		m.users.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	t.Run("success rotates token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com"}
+		stored := &domain.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FamilyID:  uuid.New(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+		m.refreshTokens.On("MarkUsed", mock.Anything, stored.ID).Return(nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.MatchedBy(func(rt *domain.RefreshToken) bool {
+			return rt.FamilyID == stored.FamilyID && rt.TokenHash != hashToken("old-token")
+		})).Return(nil)
+
+		res, err := svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: "old-token"})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+		assert.NotEmpty(t, res.AccessToken)
+		assert.NotEqual(t, "old-token", res.RefreshToken)
+		m.users.AssertExpectations(t)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("scopes stay narrowed across rotations after a role downgrade", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Role: domain.RoleUser}
+		stored := &domain.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FamilyID:  uuid.New(),
+			Scopes:    []string{"users:manage", "users:read"},
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		var rotated []*domain.RefreshToken
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+		m.refreshTokens.On("MarkUsed", mock.Anything, mock.Anything).Return(nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			rt := args.Get(1).(*domain.RefreshToken)
+			rt.ID = uuid.New()
+			rotated = append(rotated, rt)
+		}).Return(nil)
+
+		res, err := svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: "old-token"})
+		assert.NoError(t, err)
+		assert.Equal(t, "users:read", res.Scope)
+
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken(res.RefreshToken)).Return(rotated[0], nil)
+
+		res, err = svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: res.RefreshToken})
+		assert.NoError(t, err)
+		assert.Equal(t, "users:read", res.Scope)
+		assert.Equal(t, []string{"users:read"}, rotated[1].Scopes)
+	})
+
+	t.Run("no scope left after a role downgrade", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Role: domain.RoleUser}
+		stored := &domain.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FamilyID:  uuid.New(),
+			Scopes:    []string{"users:manage"},
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+		m.refreshTokens.On("MarkUsed", mock.Anything, stored.ID).Return(nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		res, err := svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: "old-token"})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrInvalidRefreshToken))
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("reuse revokes family", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		usedAt := time.Now().Add(-time.Minute)
+		stored := &domain.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    uuid.New(),
+			FamilyID:  uuid.New(),
+			ExpiresAt: time.Now().Add(time.Hour),
+			UsedAt:    &usedAt,
+		}
+
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("used-token")).Return(stored, nil)
+		m.refreshTokens.On("RevokeFamily", mock.Anything, stored.FamilyID).Return(nil)
+		m.revocations.On("MarkSessionRevoked", stored.FamilyID).Return()
+
+		res, err := svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: "used-token"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrRefreshTokenReused))
+		m.refreshTokens.AssertExpectations(t)
+		m.revocations.AssertExpectations(t)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		stored := &domain.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    uuid.New(),
+			FamilyID:  uuid.New(),
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}
+
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("expired-token")).Return(stored, nil)
+
+		res, err := svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: "expired-token"})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrInvalidRefreshToken))
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("token issued to an OAuth client", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		clientID := uuid.New()
+		stored := &domain.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    uuid.New(),
+			FamilyID:  uuid.New(),
+			ClientID:  &clientID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("client-token")).Return(stored, nil)
+
+		res, err := svc.Refresh(context.Background(), &domain.RefreshTokenRequest{RefreshToken: "client-token"})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrInvalidRefreshToken))
+		m.refreshTokens.AssertNotCalled(t, "MarkUsed", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	t.Run("revokes access token and refresh token family", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		claims := &jwt.Claims{UserID: uuid.New()}
+		stored := &domain.RefreshToken{ID: uuid.New(), UserID: claims.UserID, FamilyID: uuid.New()}
+
+		m.revocations.On("Revoke", mock.Anything, claims).Return(nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("refresh-token")).Return(stored, nil)
+		m.refreshTokens.On("RevokeFamily", mock.Anything, stored.FamilyID).Return(nil)
+		m.revocations.On("MarkSessionRevoked", stored.FamilyID).Return()
+
+		err := svc.Logout(context.Background(), claims, &domain.LogoutRequest{RefreshToken: "refresh-token"})
+
+		assert.NoError(t, err)
+		m.revocations.AssertExpectations(t)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("ignores refresh token of another user", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		claims := &jwt.Claims{UserID: uuid.New()}
+		stored := &domain.RefreshToken{ID: uuid.New(), UserID: uuid.New(), FamilyID: uuid.New()}
+
+		m.revocations.On("Revoke", mock.Anything, claims).Return(nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("refresh-token")).Return(stored, nil)
+
+		err := svc.Logout(context.Background(), claims, &domain.LogoutRequest{RefreshToken: "refresh-token"})
+
+		assert.NoError(t, err)
+		m.refreshTokens.AssertNotCalled(t, "RevokeFamily", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_LogoutAll(t *testing.T) {
+	svc, m := newTestAuthService()
+
+	userID := uuid.New()
+	m.revocations.On("RevokeAllForUser", mock.Anything, userID).Return(nil)
+	m.refreshTokens.On("RevokeAllForUser", mock.Anything, userID).Return(nil)
+	m.apiKeys.On("RevokeAllForUser", mock.Anything, userID).Return(nil)
+
+	err := svc.LogoutAll(context.Background(), userID)
+
+	assert.NoError(t, err)
+	m.revocations.AssertExpectations(t)
+	m.refreshTokens.AssertExpectations(t)
+	m.apiKeys.AssertExpectations(t)
+}
+
+func TestAuthService_ForgotPassword(t *testing.T) {
+	t.Run("sends reset link", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Name: "Test User", Email: "test@example.com"}
+
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.userTokens.On("DeleteForUser", mock.Anything, user.ID, domain.TokenPurposePasswordReset).Return(nil)
+		m.userTokens.On("Create", mock.Anything, mock.MatchedBy(func(ut *domain.UserToken) bool {
+			return ut.UserID == user.ID && ut.Purpose == domain.TokenPurposePasswordReset && ut.ExpiresAt.After(time.Now())
+		})).Return(nil)
+		m.mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg *mailer.Message) bool {
+			return msg.To == user.Email && strings.Contains(msg.Body, "http://localhost:3000/reset-password?token=")
+		})).Return(nil)
+
+		err := svc.ForgotPassword(context.Background(), &domain.ForgotPasswordRequest{Email: user.Email})
+
+		assert.NoError(t, err)
+		m.userTokens.AssertExpectations(t)
+		m.mailer.AssertExpectations(t)
+	})
+
+	t.Run("unknown email succeeds silently", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		m.users.On("GetByEmail", mock.Anything, "unknown@example.com").Return(nil, repository.ErrNotFound)
+
+		err := svc.ForgotPassword(context.Background(), &domain.ForgotPasswordRequest{Email: "unknown@example.com"})
+
+		assert.NoError(t, err)
+		m.mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	t.Run("success revokes sessions", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Name: "Test User", Email: "test@example.com"}
+		stored := &domain.UserToken{ID: uuid.New(), UserID: user.ID, TokenHash: hashToken("reset-token")}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposePasswordReset, hashToken("reset-token")).Return(stored, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposePasswordReset, hashToken("reset-token")).Return(stored, nil)
+		m.users.On("UpdatePassword", mock.Anything, user.ID, mock.MatchedBy(func(hash string) bool {
+			return bcrypt.CompareHashAndPassword([]byte(hash), []byte("newpassword")) == nil
+		})).Return(nil)
+		m.revocations.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.refreshTokens.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.apiKeys.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+
+		err := svc.ResetPassword(context.Background(), &domain.ResetPasswordRequest{Token: "reset-token", Password: "newpassword"})
+
+		assert.NoError(t, err)
+		m.users.AssertExpectations(t)
+		m.userTokens.AssertExpectations(t)
+		m.revocations.AssertExpectations(t)
+		m.refreshTokens.AssertExpectations(t)
+		m.apiKeys.AssertExpectations(t)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposePasswordReset, hashToken("used-token")).
+			Return(nil, repository.ErrNotFound)
+
+		err := svc.ResetPassword(context.Background(), &domain.ResetPasswordRequest{Token: "used-token", Password: "newpassword"})
+
+		assert.True(t, errors.Is(err, ErrInvalidResetToken))
+		m.users.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("policy violation keeps the token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Name: "Jane Doe", Email: "jane@example.com"}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposePasswordReset, hashToken("reset-token")).
+			Return(&domain.UserToken{ID: uuid.New(), UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		err := svc.ResetPassword(context.Background(), &domain.ResetPasswordRequest{Token: "reset-token", Password: "janedoe2024"})
+
+		var policyErr *PasswordPolicyError
+		assert.True(t, errors.As(err, &policyErr))
+		assert.True(t, errors.Is(err, ErrPasswordPolicy))
+		assert.Equal(t, passwordpolicy.RuleUserInfo, policyErr.Violations[0].Rule)
+		m.userTokens.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything, mock.Anything)
+		m.users.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("password the hasher rejects keeps the token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Name: "Test User", Email: "test@example.com"}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposePasswordReset, hashToken("reset-token")).
+			Return(&domain.UserToken{ID: uuid.New(), UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		// bcrypt only takes 72 bytes, fewer than the request allows
+		err := svc.ResetPassword(context.Background(), &domain.ResetPasswordRequest{Token: "reset-token", Password: strings.Repeat("Ab1!", 25)})
+
+		assert.True(t, errors.Is(err, ErrPasswordTooLong))
+		m.userTokens.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything, mock.Anything)
+		m.users.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_VerifyEmail(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		userID := uuid.New()
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeEmailVerification, hashToken("verify-token")).
+			Return(&domain.UserToken{ID: uuid.New(), UserID: userID}, nil)
+		m.users.On("MarkEmailVerified", mock.Anything, userID).Return(nil)
+
+		err := svc.VerifyEmail(context.Background(), "verify-token")
+
+		assert.NoError(t, err)
+		m.users.AssertExpectations(t)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeEmailVerification, hashToken("bad-token")).
+			Return(nil, repository.ErrNotFound)
+
+		err := svc.VerifyEmail(context.Background(), "bad-token")
+
+		assert.True(t, errors.Is(err, ErrInvalidVerifyToken))
+		m.users.AssertNotCalled(t, "MarkEmailVerified", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_ResendVerification(t *testing.T) {
+	t.Run("already verified sends nothing", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		verifiedAt := time.Now()
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", EmailVerifiedAt: &verifiedAt}
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		err := svc.ResendVerification(context.Background(), &domain.ResendVerificationRequest{Email: user.Email})
+
+		assert.NoError(t, err)
+		m.mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	t.Run("success revokes other sessions and issues new tokens", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword), Role: domain.RoleUser}
+		claims := &jwt.Claims{UserID: user.ID, Scopes: []string{"users:read"}}
+
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.users.On("UpdatePassword", mock.Anything, user.ID, mock.MatchedBy(func(hash string) bool {
+			return bcrypt.CompareHashAndPassword([]byte(hash), []byte("newpassword")) == nil
+		})).Return(nil)
+		m.revocations.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.refreshTokens.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.apiKeys.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.userTokens.On("DeleteForUser", mock.Anything, user.ID, domain.TokenPurposePasswordReset).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.ChangePassword(context.Background(), claims, &domain.ChangePasswordRequest{
+			CurrentPassword: "oldpassword",
+			NewPassword:     "newpassword",
+		})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.AccessToken)
+		assert.Equal(t, "users:read", res.Scope)
+		m.users.AssertExpectations(t)
+		m.revocations.AssertExpectations(t)
+		m.refreshTokens.AssertExpectations(t)
+		m.apiKeys.AssertExpectations(t)
+	})
+
+	t.Run("incorrect current password", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Password: string(hashedPassword)}
+
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		res, err := svc.ChangePassword(context.Background(), &jwt.Claims{UserID: user.ID}, &domain.ChangePasswordRequest{
+			CurrentPassword: "wrongpassword",
+			NewPassword:     "newpassword",
+		})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrIncorrectPassword))
+		m.users.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("new password breaks the policy", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("oldpassword"), bcrypt.MinCost)
+		user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword)}
+
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		res, err := svc.ChangePassword(context.Background(), &jwt.Claims{UserID: user.ID}, &domain.ChangePasswordRequest{
+			CurrentPassword: "oldpassword",
+			NewPassword:     "short",
+		})
+
+		assert.Nil(t, res)
+		var policyErr *PasswordPolicyError
+		assert.True(t, errors.As(err, &policyErr))
+		assert.Equal(t, passwordpolicy.RuleMinLength, policyErr.Violations[0].Rule)
+		m.users.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
 	})
 }
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/logger"
+)
+
+// Login throttling errors
+var (
+	ErrAccountLocked        = errors.New("account is temporarily locked after too many failed login attempts")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+)
+
+// LoginThrottledError is returned when a login attempt is refused because of earlier failures.
+// It wraps ErrAccountLocked or ErrTooManyLoginAttempts.
+type LoginThrottledError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// LoginThrottleService defines the interface for brute-force protection on login
+type LoginThrottleService interface {
+	Check(ctx context.Context, email, ip string) error
+	RecordFailure(ctx context.Context, email, ip string) error
+	RecordSuccess(ctx context.Context, email string) error
+	Unlock(ctx context.Context, email string) error
+}
+
+// loginThrottleService counts failed logins per account and per client IP.
+// Once a subject reaches its threshold, every further failure locks it out
+// for twice as long as the previous one, up to LockoutMaxDuration.
+type loginThrottleService struct {
+	repo repository.LoginFailureRepository
+	cfg  *config.AuthConfig
+	log  *logger.Logger
+	now  func() time.Time
+}
+
+// NewLoginThrottleService creates a new login throttle service
+func NewLoginThrottleService(repo repository.LoginFailureRepository, cfg *config.AuthConfig, log *logger.Logger) LoginThrottleService {
+	return &loginThrottleService{
+		repo: repo,
+		cfg:  cfg,
+		log:  log,
+		now:  time.Now,
+	}
+}
+
+// Check returns a *LoginThrottledError if the account or the client IP is locked out
+func (s *loginThrottleService) Check(ctx context.Context, email, ip string) error {
+	if err := s.check(ctx, accountSubject(email), ErrAccountLocked); err != nil {
+		return err
+	}
+
+	if ip != "" {
+		return s.check(ctx, ipSubject(ip), ErrTooManyLoginAttempts)
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed login against the account and the client IP,
+// locking either out once its threshold is reached
+func (s *loginThrottleService) RecordFailure(ctx context.Context, email, ip string) error {
+	if err := s.recordFailure(ctx, accountSubject(email), s.cfg.LockoutThreshold); err != nil {
+		return err
+	}
+
+	if ip != "" {
+		return s.recordFailure(ctx, ipSubject(ip), s.cfg.LockoutIPThreshold)
+	}
+
+	return nil
+}
+
+// RecordSuccess clears the failed logins of an account.
+// Failures from the client IP are kept, so one valid account cannot be used to keep guessing others.
+func (s *loginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	if err := s.repo.Reset(ctx, accountSubject(email)); err != nil {
+		s.log.Error().Err(err).Msg("Failed to reset login failures")
+		return err
+	}
+	return nil
+}
+
+// Unlock lifts the lockout of an account
+func (s *loginThrottleService) Unlock(ctx context.Context, email string) error {
+	if err := s.repo.Reset(ctx, accountSubject(email)); err != nil {
+		s.log.Error().Err(err).Msg("Failed to unlock account")
+		return err
+	}
+
+	s.log.Info().Str("event", "account_unlocked").Str("email", email).Msg("Account unlocked")
+	return nil
+}
+
+// check returns a *LoginThrottledError wrapping lockedErr if the subject is locked out
+func (s *loginThrottleService) check(ctx context.Context, subject string, lockedErr error) error {
+	failure, err := s.repo.Get(ctx, subject)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		s.log.Error().Err(err).Msg("Failed to get login failures")
+		return err
+	}
+
+	now := s.now()
+	if !failure.IsLockedAt(now) {
+		return nil
+	}
+
+	return &LoginThrottledError{Err: lockedErr, RetryAfter: failure.LockedUntil.Sub(now)}
+}
+
+// recordFailure counts a failure against the subject and locks it out once threshold is reached
+func (s *loginThrottleService) recordFailure(ctx context.Context, subject string, threshold int) error {
+	if threshold <= 0 {
+		return nil
+	}
+
+	now := s.now()
+	failure, err := s.repo.RecordFailure(ctx, subject, now, now.Add(-s.cfg.LockoutWindow))
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to record login failure")
+		return err
+	}
+
+	if failure.Failures < threshold {
+		return nil
+	}
+
+	until := now.Add(s.lockoutDuration(failure.Failures - threshold))
+	if err := s.repo.Lock(ctx, subject, until); err != nil {
+		s.log.Error().Err(err).Msg("Failed to lock out login subject")
+		return err
+	}
+
+	kind, value, _ := strings.Cut(subject, ":")
+	s.log.Warn().
+		Str("event", "login_lockout").
+		Str(kind, value).
+		Int("failures", failure.Failures).
+		Time("locked_until", until).
+		Msg("Login locked out after repeated failures")
+
+	return nil
+}
+
+// lockoutDuration doubles the base duration for every failure past the threshold
+func (s *loginThrottleService) lockoutDuration(excess int) time.Duration {
+	d := s.cfg.LockoutBaseDuration
+	for i := 0; i < excess && d < s.cfg.LockoutMaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, s.cfg.LockoutMaxDuration)
+}
+
+// accountSubject keys failures by email, so unknown addresses are throttled like real accounts
+func accountSubject(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipSubject keys failures by client IP
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/logger"
+)
+
+// MockLoginFailureRepository is a mock implementation of repository.LoginFailureRepository
+type MockLoginFailureRepository struct {
+	mock.Mock
+}
+
+func (m *MockLoginFailureRepository) Get(ctx context.Context, subject string) (*domain.LoginFailure, error) {
+	args := m.Called(ctx, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LoginFailure), args.Error(1)
+}
+
+func (m *MockLoginFailureRepository) RecordFailure(ctx context.Context, subject string, at, windowStart time.Time) (*domain.LoginFailure, error) {
+	args := m.Called(ctx, subject, at, windowStart)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LoginFailure), args.Error(1)
+}
+
+func (m *MockLoginFailureRepository) Lock(ctx context.Context, subject string, until time.Time) error {
+	args := m.Called(ctx, subject, until)
+	return args.Error(0)
+}
+
+func (m *MockLoginFailureRepository) Reset(ctx context.Context, subject string) error {
+	args := m.Called(ctx, subject)
+	return args.Error(0)
+}
+
+var testLockoutConfig = &config.AuthConfig{
+	LockoutThreshold:    3,
+	LockoutIPThreshold:  10,
+	LockoutBaseDuration: 30 * time.Second,
+	LockoutMaxDuration:  5 * time.Minute,
+	LockoutWindow:       15 * time.Minute,
+}
+
+// newTestLoginThrottleService creates a login throttle service whose clock is frozen at now
+func newTestLoginThrottleService(now time.Time) (LoginThrottleService, *MockLoginFailureRepository) {
+	repo := new(MockLoginFailureRepository)
+	svc := NewLoginThrottleService(repo, testLockoutConfig, logger.New("debug", true))
+	svc.(*loginThrottleService).now = func() time.Time { return now }
+	return svc, repo
+}
+
+func TestLoginThrottleService_Check(t *testing.T) {
+	t.Run("no failures", func(t *testing.T) {
+		svc, repo := newTestLoginThrottleService(testNow)
+
+		repo.On("Get", mock.Anything, "email:test@example.com").Return(nil, repository.ErrNotFound)
+		repo.On("Get", mock.Anything, "ip:203.0.113.7").Return(nil, repository.ErrNotFound)
+
+		assert.NoError(t, svc.Check(context.Background(), "Test@Example.com", "203.0.113.7"))
+	})
+
+	t.Run("locked account", func(t *testing.T) {
+		svc, repo := newTestLoginThrottleService(testNow)
+
+		until := testNow.Add(90 * time.Second)
+		repo.On("Get", mock.Anything, "email:test@example.com").
+			Return(&domain.LoginFailure{Failures: 4, LockedUntil: &until}, nil)
+
+		err := svc.Check(context.Background(), "test@example.com", "203.0.113.7")
+
+		assert.ErrorIs(t, err, ErrAccountLocked)
+		var throttled *LoginThrottledError
+		assert.ErrorAs(t, err, &throttled)
+		assert.Equal(t, 90*time.Second, throttled.RetryAfter)
+	})
+
+	t.Run("expired lock", func(t *testing.T) {
+		svc, repo := newTestLoginThrottleService(testNow)
+
+		until := testNow.Add(-time.Second)
+		repo.On("Get", mock.Anything, "email:test@example.com").
+			Return(&domain.LoginFailure{Failures: 4, LockedUntil: &until}, nil)
+
+		assert.NoError(t, svc.Check(context.Background(), "test@example.com", ""))
+	})
+
+	t.Run("locked ip", func(t *testing.T) {
+		svc, repo := newTestLoginThrottleService(testNow)
+
+		until := testNow.Add(time.Minute)
+		repo.On("Get", mock.Anything, "email:test@example.com").Return(nil, repository.ErrNotFound)
+		repo.On("Get", mock.Anything, "ip:203.0.113.7").
+			Return(&domain.LoginFailure{Failures: 10, LockedUntil: &until}, nil)
+
+		err := svc.Check(context.Background(), "test@example.com", "203.0.113.7")
+
+		assert.ErrorIs(t, err, ErrTooManyLoginAttempts)
+	})
+}
+
+func TestLoginThrottleService_RecordFailure(t *testing.T) {
+	windowStart := testNow.Add(-testLockoutConfig.LockoutWindow)
+
+	t.Run("below threshold", func(t *testing.T) {
+		svc, repo := newTestLoginThrottleService(testNow)
+
+		repo.On("RecordFailure", mock.Anything, "email:test@example.com", testNow, windowStart).
+			Return(&domain.LoginFailure{Failures: 2}, nil)
+
+		assert.NoError(t, svc.RecordFailure(context.Background(), "test@example.com", ""))
+		repo.AssertNotCalled(t, "Lock", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("backoff doubles past threshold", func(t *testing.T) {
+		cases := []struct {
+			failures int
+			lockout  time.Duration
+		}{
+			{3, 30 * time.Second},
+			{4, time.Minute},
+			{5, 2 * time.Minute},
+			{7, 5 * time.Minute},
+			{50, 5 * time.Minute},
+		}
+
+		for _, tc := range cases {
+			svc, repo := newTestLoginThrottleService(testNow)
+
+			repo.On("RecordFailure", mock.Anything, "email:test@example.com", testNow, windowStart).
+				Return(&domain.LoginFailure{Failures: tc.failures}, nil)
+			repo.On("Lock", mock.Anything, "email:test@example.com", testNow.Add(tc.lockout)).Return(nil)
+
+			assert.NoError(t, svc.RecordFailure(context.Background(), "test@example.com", ""))
+			repo.AssertExpectations(t)
+		}
+	})
+
+	t.Run("counts ip separately", func(t *testing.T) {
+		svc, repo := newTestLoginThrottleService(testNow)
+
+		repo.On("RecordFailure", mock.Anything, "email:test@example.com", testNow, windowStart).
+			Return(&domain.LoginFailure{Failures: 1}, nil)
+		repo.On("RecordFailure", mock.Anything, "ip:203.0.113.7", testNow, windowStart).
+			Return(&domain.LoginFailure{Failures: 10}, nil)
+		repo.On("Lock", mock.Anything, "ip:203.0.113.7", testNow.Add(30*time.Second)).Return(nil)
+
+		assert.NoError(t, svc.RecordFailure(context.Background(), "test@example.com", "203.0.113.7"))
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestLoginThrottleService_Unlock(t *testing.T) {
+	svc, repo := newTestLoginThrottleService(testNow)
+
+	repo.On("Reset", mock.Anything, "email:test@example.com").Return(nil)
+
+	assert.NoError(t, svc.Unlock(context.Background(), "test@example.com"))
+	repo.AssertExpectations(t)
+}
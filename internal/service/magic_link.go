@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/mailer"
+)
+
+// ErrInvalidMagicLink is returned for unknown, expired or already used login links
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+// RequestMagicLink emails a single-use login link to a registered user.
+// It succeeds whether or not the email is registered or rate limited,
+// so callers cannot probe for accounts.
+func (s *authService) RequestMagicLink(ctx context.Context, req *domain.MagicLinkRequest) error {
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		s.log.Error().Err(err).Msg("Failed to get user by email")
+		return err
+	}
+
+	// Earlier links are kept so they count towards the limit
+	sent, err := s.userTokenRepo.CountCreatedSince(ctx, user.ID, domain.TokenPurposeMagicLink, s.now().Add(-s.cfg.MagicLinkWindow))
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to count login links")
+		return err
+	}
+	if sent >= s.cfg.MagicLinkLimit {
+		s.log.Warn().Str("user_id", user.ID.String()).Msg("Login link rate limit reached")
+		return nil
+	}
+
+	token, err := s.createUserToken(ctx, user.ID, domain.TokenPurposeMagicLink, s.cfg.MagicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	msg := &mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to log in. It can be used once and expires in %s.\n\n%s\n\nIf you did not request a login link, you can ignore this email.\n",
+			user.Name, s.cfg.MagicLinkTTL, linkWithToken(s.cfg.MagicLinkURL, token),
+		),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send login link email")
+		return err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("Login link requested")
+	return nil
+}
+
+// ConsumeMagicLink logs a user in with a login link.
+// Following the link proves ownership of the email, so an unverified user is
+// claimed the same way as through an identity provider. Users with two-factor
+// authentication enabled get an MFA token, as with a password login, and locked
+// out accounts and clients are refused the same way. A refused link stays usable.
+func (s *authService) ConsumeMagicLink(ctx context.Context, token string) (*domain.TokenResponse, error) {
+	hash := hashToken(token)
+	stored, err := s.userTokenRepo.GetActive(ctx, domain.TokenPurposeMagicLink, hash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		s.log.Error().Err(err).Msg("Failed to get login link")
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to get user")
+		return nil, err
+	}
+
+	if err := s.loginThrottle.Check(ctx, user.Email, domain.ClientInfoFromContext(ctx).IP); err != nil {
+		return nil, err
+	}
+
+	// Consuming decides between concurrent uses of the same link
+	if _, err := s.userTokenRepo.Consume(ctx, domain.TokenPurposeMagicLink, hash); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		s.log.Error().Err(err).Msg("Failed to consume login link")
+		return nil, err
+	}
+
+	// Other outstanding links are burned once one of them is used, but still count towards the limit
+	if err := s.userTokenRepo.ConsumeForUser(ctx, user.ID, domain.TokenPurposeMagicLink); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to burn login links")
+		return nil, err
+	}
+
+	if user, err = s.claimUnverifiedUser(ctx, user, "a login link"); err != nil {
+		return nil, err
+	}
+
+	if user.IsTwoFactorEnabled() {
+		return s.issueMFAToken(ctx, user)
+	}
+
+	tokens, err := s.issueTokens(ctx, user, uuid.New(), domain.ScopeStrings(domain.PermissionsForRole(user.Role)))
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("User logged in with login link")
+
+	return tokens, nil
+}
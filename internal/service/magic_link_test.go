@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/mailer"
+)
+
+func TestAuthService_RequestMagicLink(t *testing.T) {
+	user := &domain.User{ID: uuid.New(), Name: "Test User", Email: "test@example.com"}
+
+	t.Run("sends login link", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.userTokens.On("CountCreatedSince", mock.Anything, user.ID, domain.TokenPurposeMagicLink, testNow.Add(-15*time.Minute)).Return(2, nil)
+		m.userTokens.On("Create", mock.Anything, mock.MatchedBy(func(ut *domain.UserToken) bool {
+			return ut.UserID == user.ID && ut.Purpose == domain.TokenPurposeMagicLink && ut.ExpiresAt.Equal(testNow.Add(15*time.Minute))
+		})).Return(nil)
+		m.mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg *mailer.Message) bool {
+			return msg.To == user.Email && strings.Contains(msg.Body, "http://localhost:8080/api/v1/auth/magic-link/consume?token=")
+		})).Return(nil)
+
+		err := svc.RequestMagicLink(context.Background(), &domain.MagicLinkRequest{Email: user.Email})
+
+		assert.NoError(t, err)
+		m.userTokens.AssertExpectations(t)
+		m.mailer.AssertExpectations(t)
+		m.userTokens.AssertNotCalled(t, "DeleteForUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("rate limited email succeeds silently", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+
+		m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+		m.userTokens.On("CountCreatedSince", mock.Anything, user.ID, domain.TokenPurposeMagicLink, mock.Anything).Return(3, nil)
+
+		err := svc.RequestMagicLink(context.Background(), &domain.MagicLinkRequest{Email: user.Email})
+
+		assert.NoError(t, err)
+		m.userTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		m.mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown email succeeds silently", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		m.users.On("GetByEmail", mock.Anything, "unknown@example.com").Return(nil, repository.ErrNotFound)
+
+		err := svc.RequestMagicLink(context.Background(), &domain.MagicLinkRequest{Email: "unknown@example.com"})
+
+		assert.NoError(t, err)
+		m.mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_ConsumeMagicLink(t *testing.T) {
+	verifiedAt := testNow.Add(-time.Hour)
+
+	t.Run("logs the user in and burns other links", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Role: domain.RoleUser, EmailVerifiedAt: &verifiedAt}
+		stored := &domain.UserToken{ID: uuid.New(), UserID: user.ID}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(stored, nil)
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(stored, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.userTokens.On("ConsumeForUser", mock.Anything, user.ID, domain.TokenPurposeMagicLink).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.ConsumeMagicLink(context.Background(), "link-token")
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.AccessToken)
+		assert.NotEmpty(t, res.RefreshToken)
+		claims, _ := m.tokens.Claims(res.AccessToken)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.ElementsMatch(t, domain.ScopeStrings(domain.PermissionsForRole(domain.RoleUser)), claims.Scopes)
+		m.userTokens.AssertExpectations(t)
+		m.users.AssertNotCalled(t, "MarkEmailVerified", mock.Anything, mock.Anything)
+	})
+
+	t.Run("claims an unverified user", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Role: domain.RoleUser}
+		claimed := &domain.User{ID: user.ID, Role: domain.RoleUser, EmailVerifiedAt: &verifiedAt, TokenVersion: 1}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil).Once()
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.userTokens.On("ConsumeForUser", mock.Anything, user.ID, domain.TokenPurposeMagicLink).Return(nil)
+		m.users.On("UpdatePassword", mock.Anything, user.ID, mock.Anything).Return(nil)
+		m.revocations.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.refreshTokens.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.apiKeys.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.users.On("MarkEmailVerified", mock.Anything, user.ID).Return(nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(claimed, nil).Once()
+		m.mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg *mailer.Message) bool {
+			return strings.Contains(msg.Body, "a login link")
+		})).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.ConsumeMagicLink(context.Background(), "link-token")
+
+		assert.NoError(t, err)
+		claims, _ := m.tokens.Claims(res.AccessToken)
+		assert.Equal(t, 1, claims.TokenVersion)
+		m.users.AssertExpectations(t)
+		m.revocations.AssertExpectations(t)
+	})
+
+	t.Run("two-factor user gets an mfa token", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Role: domain.RoleUser, EmailVerifiedAt: &verifiedAt, TOTPEnabledAt: &verifiedAt}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.userTokens.On("ConsumeForUser", mock.Anything, user.ID, domain.TokenPurposeMagicLink).Return(nil)
+		m.userTokens.On("Create", mock.Anything, mock.MatchedBy(func(ut *domain.UserToken) bool {
+			return ut.Purpose == domain.TokenPurposeMFAPending
+		})).Return(nil)
+
+		res, err := svc.ConsumeMagicLink(context.Background(), "link-token")
+
+		assert.NoError(t, err)
+		assert.True(t, res.MFARequired)
+		assert.Empty(t, res.AccessToken)
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("locked out account keeps its link", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Email: "jane@example.com", Role: domain.RoleUser, EmailVerifiedAt: &verifiedAt}
+		locked := &LoginThrottledError{Err: ErrAccountLocked, RetryAfter: time.Minute}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(locked)
+
+		res, err := svc.ConsumeMagicLink(context.Background(), "link-token")
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrAccountLocked))
+		m.userTokens.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything, mock.Anything)
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("link used concurrently", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		user := &domain.User{ID: uuid.New(), Role: domain.RoleUser, EmailVerifiedAt: &verifiedAt}
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMagicLink, hashToken("link-token")).Return(nil, repository.ErrNotFound)
+
+		_, err := svc.ConsumeMagicLink(context.Background(), "link-token")
+
+		assert.True(t, errors.Is(err, ErrInvalidMagicLink))
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid or used link", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		m.userTokens.On("GetActive", mock.Anything, domain.TokenPurposeMagicLink, hashToken("used-token")).Return(nil, repository.ErrNotFound)
+
+		_, err := svc.ConsumeMagicLink(context.Background(), "used-token")
+
+		assert.True(t, errors.Is(err, ErrInvalidMagicLink))
+		m.users.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+}
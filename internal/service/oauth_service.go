@@ -0,0 +1,880 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/jwt"
+	"go-echo-starter/pkg/logger"
+	"go-echo-starter/pkg/oidc"
+)
+
+// OAuth client management errors
+var (
+	ErrOAuthClientNotFound  = errors.New("OAuth client not found")
+	ErrOAuthConsentNotFound = errors.New("OAuth consent not found")
+	ErrInvalidRedirectURI   = errors.New("redirect URIs must use https, loopback http or an allowed custom scheme and have no fragment, and public clients need at least one")
+	ErrOAuthRequest         = errors.New("invalid OAuth request")
+)
+
+// OAuth2 error codes (RFC 6749 sections 4.1.2.1 and 5.2)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+)
+
+// pkceMethod is the only PKCE code challenge method accepted
+const pkceMethod = "S256"
+
+// OAuthError is an OAuth2 protocol error, reported to clients with its code.
+// It unwraps to ErrOAuthRequest.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func (e *OAuthError) Unwrap() error {
+	return ErrOAuthRequest
+}
+
+// oauthError returns an OAuthError with the given code and description
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthService defines the interface for the OAuth2 authorization server
+type OAuthService interface {
+	RegisterClient(ctx context.Context, user *domain.AuthUser, req *domain.CreateOAuthClientRequest) (*domain.CreateOAuthClientResponse, error)
+	ListClients(ctx context.Context) ([]*domain.OAuthClient, error)
+	DeleteClient(ctx context.Context, id uuid.UUID) error
+	Authorize(ctx context.Context, user *domain.AuthUser, req *domain.OAuthAuthorizeRequest) (*domain.OAuthAuthorizeResponse, error)
+	Consent(ctx context.Context, user *domain.AuthUser, req *domain.OAuthConsentRequest) (*domain.OAuthAuthorizeResponse, error)
+	Token(ctx context.Context, creds domain.OAuthClientCredentials, req *domain.OAuthTokenRequest) (*domain.TokenResponse, error)
+	Introspect(ctx context.Context, creds domain.OAuthClientCredentials, req *domain.OAuthTokenActionRequest) (*domain.OAuthIntrospectionResponse, error)
+	Revoke(ctx context.Context, creds domain.OAuthClientCredentials, req *domain.OAuthTokenActionRequest) error
+	ListConsents(ctx context.Context, userID uuid.UUID) ([]*domain.OAuthConsent, error)
+	RevokeConsent(ctx context.Context, userID, clientID uuid.UUID) error
+}
+
+type oauthService struct {
+	clientRepo       repository.OAuthClientRepository
+	codeRepo         repository.OAuthCodeRepository
+	consentRepo      repository.OAuthConsentRepository
+	userRepo         repository.UserRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	revocations      TokenRevocationService
+	tokens           jwt.TokenIssuer
+	verifier         jwt.TokenVerifier
+	cfg              *config.AuthConfig
+	log              *logger.Logger
+	now              func() time.Time
+}
+
+// NewOAuthService creates a new OAuth service
+func NewOAuthService(
+	clientRepo repository.OAuthClientRepository,
+	codeRepo repository.OAuthCodeRepository,
+	consentRepo repository.OAuthConsentRepository,
+	userRepo repository.UserRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	revocations TokenRevocationService,
+	tokens jwt.TokenIssuer,
+	verifier jwt.TokenVerifier,
+	cfg *config.AuthConfig,
+	log *logger.Logger,
+) OAuthService {
+	return &oauthService{
+		clientRepo:       clientRepo,
+		codeRepo:         codeRepo,
+		consentRepo:      consentRepo,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revocations:      revocations,
+		tokens:           tokens,
+		verifier:         verifier,
+		cfg:              cfg,
+		log:              log,
+		now:              time.Now,
+	}
+}
+
+// RegisterClient registers an OAuth client. Confidential clients get a secret,
+// which is returned once and only its hash is stored.
+// A client can only be granted scopes the caller's own token has; requesting none grants all of them.
+func (s *oauthService) RegisterClient(ctx context.Context, user *domain.AuthUser, req *domain.CreateOAuthClientRequest) (*domain.CreateOAuthClientResponse, error) {
+	if req.Public && len(req.RedirectURIs) == 0 {
+		return nil, ErrInvalidRedirectURI
+	}
+	for _, uri := range req.RedirectURIs {
+		if !isValidRedirectURI(uri, s.cfg.OAuthRedirectSchemes) {
+			return nil, ErrInvalidRedirectURI
+		}
+	}
+
+	scopes, err := delegatedScopes(user, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	createdBy := user.ID
+	client := &domain.OAuthClient{
+		Name:         req.Name,
+		RedirectURIs: append([]string{}, req.RedirectURIs...),
+		Scopes:       scopes,
+		CreatedBy:    &createdBy,
+	}
+
+	var secret string
+	if !req.Public {
+		var secretHash string
+		secret, secretHash, err = generateOpaqueToken()
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to generate client secret")
+			return nil, err
+		}
+		client.SecretHash = &secretHash
+	}
+
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to create OAuth client")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Str("client_id", client.ID.String()).Msg("OAuth client registered")
+	return &domain.CreateOAuthClientResponse{ClientSecret: secret, OAuthClient: client}, nil
+}
+
+// ListClients lists every registered OAuth client
+func (s *oauthService) ListClients(ctx context.Context) ([]*domain.OAuthClient, error) {
+	clients, err := s.clientRepo.List(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to list OAuth clients")
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient deletes an OAuth client. Its refresh tokens, codes and consents go with it;
+// access tokens already issued to it stay valid until they expire.
+func (s *oauthService) DeleteClient(ctx context.Context, id uuid.UUID) error {
+	if err := s.clientRepo.Delete(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrOAuthClientNotFound
+		}
+		s.log.Error().Err(err).Str("client_id", id.String()).Msg("Failed to delete OAuth client")
+		return err
+	}
+
+	s.log.Info().Str("client_id", id.String()).Msg("OAuth client deleted")
+	return nil
+}
+
+// Authorize handles an authorization request on behalf of the signed-in user.
+// If the user already consented to every requested scope, the response holds the
+// redirect back to the client with an authorization code. Otherwise the frontend
+// has to ask for consent and submit the decision to Consent.
+// Errors that cannot be reported to the client through its redirect URI are returned as an OAuthError.
+func (s *oauthService) Authorize(ctx context.Context, user *domain.AuthUser, req *domain.OAuthAuthorizeRequest) (*domain.OAuthAuthorizeResponse, error) {
+	auth, err := s.checkAuthorizeRequest(ctx, user, req)
+	if err != nil || auth.redirect != nil {
+		return auth.redirect, err
+	}
+
+	consent, err := s.consentRepo.Get(ctx, user.ID, auth.client.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Str("client_id", auth.client.ID.String()).Msg("Failed to get OAuth consent")
+		return nil, err
+	}
+	if consent == nil || !containsAll(consent.Scopes, auth.scopes) {
+		return &domain.OAuthAuthorizeResponse{ConsentRequired: true, Client: auth.client, Scopes: auth.scopes}, nil
+	}
+
+	return s.issueCode(ctx, user.ID, auth, req)
+}
+
+// Consent records the user's decision on an authorization request and returns the
+// redirect back to the client, with an authorization code if the user approved.
+// Approved scopes are added to those the user consented to before.
+func (s *oauthService) Consent(ctx context.Context, user *domain.AuthUser, req *domain.OAuthConsentRequest) (*domain.OAuthAuthorizeResponse, error) {
+	auth, err := s.checkAuthorizeRequest(ctx, user, &req.OAuthAuthorizeRequest)
+	if err != nil || auth.redirect != nil {
+		return auth.redirect, err
+	}
+
+	if !req.Approve {
+		s.log.Info().Str("user_id", user.ID.String()).Str("client_id", auth.client.ID.String()).Msg("OAuth consent denied")
+		return authorizeRedirect(auth.redirectURI, req.State, url.Values{
+			"error":             {OAuthAccessDenied},
+			"error_description": {"The user denied the request"},
+		}), nil
+	}
+
+	scopes := auth.scopes
+	existing, err := s.consentRepo.Get(ctx, user.ID, auth.client.ID)
+	switch {
+	case err == nil:
+		scopes = unionScopes(existing.Scopes, auth.scopes)
+	case !errors.Is(err, repository.ErrNotFound):
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Str("client_id", auth.client.ID.String()).Msg("Failed to get OAuth consent")
+		return nil, err
+	}
+
+	err = s.consentRepo.Upsert(ctx, &domain.OAuthConsent{UserID: user.ID, ClientID: auth.client.ID, Scopes: scopes})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Str("client_id", auth.client.ID.String()).Msg("Failed to store OAuth consent")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Str("client_id", auth.client.ID.String()).Msg("OAuth consent granted")
+	return s.issueCode(ctx, user.ID, auth, &req.OAuthAuthorizeRequest)
+}
+
+// Token handles a token request from an authenticated client.
+// Authorization codes require the PKCE verifier and the redirect URI of the authorization
+// request, and can be exchanged once. Refresh tokens rotate as with first-party logins.
+// The client credentials grant is limited to confidential clients and issues no refresh token.
+// Clients acting for themselves only get scopes a regular user has, and only as long as
+// the user who registered them still exists and has them.
+func (s *oauthService) Token(ctx context.Context, creds domain.OAuthClientCredentials, req *domain.OAuthTokenRequest) (*domain.TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case domain.GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case domain.GrantTypeRefreshToken:
+		return s.refresh(ctx, client, req)
+	case domain.GrantTypeClientCredentials:
+		return s.clientCredentials(ctx, client, req)
+	case "":
+		return nil, oauthError(OAuthInvalidRequest, "grant_type is required")
+	default:
+		return nil, oauthError(OAuthUnsupportedGrantType, "")
+	}
+}
+
+// Introspect reports the state of a token to a confidential client (RFC 7662).
+// Any access token can be introspected, so that clients can act as resource servers;
+// refresh tokens only by the client they were issued to.
+func (s *oauthService) Introspect(ctx context.Context, creds domain.OAuthClientCredentials, req *domain.OAuthTokenActionRequest) (*domain.OAuthIntrospectionResponse, error) {
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, oauthError(OAuthUnauthorizedClient, "public clients cannot introspect tokens")
+	}
+	if req.Token == "" {
+		return nil, oauthError(OAuthInvalidRequest, "token is required")
+	}
+
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.Token))
+	switch {
+	case err == nil:
+		if stored.ClientID == nil || *stored.ClientID != client.ID || stored.UsedAt != nil || stored.RevokedAt != nil || !s.now().Before(stored.ExpiresAt) {
+			return &domain.OAuthIntrospectionResponse{}, nil
+		}
+		return &domain.OAuthIntrospectionResponse{
+			Active:    true,
+			Scope:     domain.JoinScopes(stored.Scopes),
+			ClientID:  client.ID.String(),
+			ExpiresAt: stored.ExpiresAt.Unix(),
+			IssuedAt:  stored.CreatedAt.Unix(),
+			Subject:   stored.UserID.String(),
+		}, nil
+	case !errors.Is(err, repository.ErrNotFound):
+		s.log.Error().Err(err).Msg("Failed to get refresh token")
+		return nil, err
+	}
+
+	claims, err := s.activeAccessToken(ctx, req.Token)
+	if err != nil || claims == nil {
+		return &domain.OAuthIntrospectionResponse{}, err
+	}
+
+	resp := &domain.OAuthIntrospectionResponse{
+		Active:    true,
+		Scope:     domain.JoinScopes(claims.Scopes),
+		ClientID:  claims.ClientID,
+		TokenType: "Bearer",
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JTI:       claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return resp, nil
+}
+
+// Revoke revokes a token issued to the authenticated client (RFC 7009): the whole
+// family of a refresh token, or a single access token. Unknown tokens, and tokens
+// of other clients, are ignored so that callers cannot probe for them.
+func (s *oauthService) Revoke(ctx context.Context, creds domain.OAuthClientCredentials, req *domain.OAuthTokenActionRequest) error {
+	client, err := s.authenticateClient(ctx, creds)
+	if err != nil {
+		return err
+	}
+	if req.Token == "" {
+		return oauthError(OAuthInvalidRequest, "token is required")
+	}
+
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.Token))
+	switch {
+	case err == nil:
+		if stored.ClientID == nil || *stored.ClientID != client.ID {
+			return nil
+		}
+		if err := s.refreshTokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			s.log.Error().Err(err).Str("family_id", stored.FamilyID.String()).Msg("Failed to revoke refresh token family")
+			return err
+		}
+		s.log.Info().Str("client_id", client.ID.String()).Str("family_id", stored.FamilyID.String()).Msg("OAuth refresh token revoked")
+		return nil
+	case !errors.Is(err, repository.ErrNotFound):
+		s.log.Error().Err(err).Msg("Failed to get refresh token")
+		return err
+	}
+
+	claims, err := s.verifier.Validate(req.Token)
+	if err != nil || claims.ClientID != client.ID.String() {
+		return nil
+	}
+	if err := s.revocations.Revoke(ctx, claims); err != nil {
+		return err
+	}
+
+	s.log.Info().Str("client_id", client.ID.String()).Str("jti", claims.ID).Msg("OAuth access token revoked")
+	return nil
+}
+
+// ListConsents lists the clients a user has consented to, with the scopes they were allowed
+func (s *oauthService) ListConsents(ctx context.Context, userID uuid.UUID) ([]*domain.OAuthConsent, error) {
+	consents, err := s.consentRepo.ListByUser(ctx, userID)
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to list OAuth consents")
+		return nil, err
+	}
+	return consents, nil
+}
+
+// RevokeConsent withdraws a user's consent to a client and revokes the refresh tokens
+// it holds for the user. Its access tokens stay valid until they expire.
+func (s *oauthService) RevokeConsent(ctx context.Context, userID, clientID uuid.UUID) error {
+	if err := s.consentRepo.Delete(ctx, userID, clientID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrOAuthConsentNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Str("client_id", clientID.String()).Msg("Failed to delete OAuth consent")
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeForClient(ctx, userID, clientID); err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Str("client_id", clientID.String()).Msg("Failed to revoke OAuth refresh tokens")
+		return err
+	}
+
+	s.log.Info().Str("user_id", userID.String()).Str("client_id", clientID.String()).Msg("OAuth consent revoked")
+	return nil
+}
+
+// authorizeRequest is an authorization request that passed the checks of checkAuthorizeRequest
+type authorizeRequest struct {
+	client      *domain.OAuthClient
+	redirectURI string
+	scopes      []string
+	// redirect is set instead when the request failed with an error for the client
+	redirect *domain.OAuthAuthorizeResponse
+}
+
+// checkAuthorizeRequest checks an authorization request. Until the client and redirect URI
+// are known to be valid, errors are returned to the caller; after that, they are sent
+// back to the client through the redirect URI.
+func (s *oauthService) checkAuthorizeRequest(ctx context.Context, user *domain.AuthUser, req *domain.OAuthAuthorizeRequest) (*authorizeRequest, error) {
+	client, err := s.getClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, ErrOAuthClientNotFound) {
+			return &authorizeRequest{}, oauthError(OAuthInvalidRequest, "unknown client_id")
+		}
+		return &authorizeRequest{}, err
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !containsAll(client.RedirectURIs, []string{redirectURI}) || redirectURI == "" {
+		return &authorizeRequest{}, oauthError(OAuthInvalidRequest, "redirect_uri is not registered for the client")
+	}
+
+	auth := &authorizeRequest{client: client, redirectURI: redirectURI}
+	fail := func(code, description string) (*authorizeRequest, error) {
+		auth.redirect = authorizeRedirect(redirectURI, req.State, url.Values{
+			"error":             {code},
+			"error_description": {description},
+		})
+		return auth, nil
+	}
+
+	if req.ResponseType != "code" {
+		return fail(OAuthUnsupportedResponseType, "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != pkceMethod {
+		return fail(OAuthInvalidRequest, "a PKCE code_challenge with the S256 method is required")
+	}
+
+	auth.scopes, err = clientUserScopes(client, user.Role, domain.SplitScopes(req.Scope))
+	if err != nil {
+		return fail(OAuthInvalidScope, "requested scope is invalid or not permitted")
+	}
+
+	return auth, nil
+}
+
+// issueCode stores a new authorization code and returns the redirect carrying it
+func (s *oauthService) issueCode(ctx context.Context, userID uuid.UUID, auth *authorizeRequest, req *domain.OAuthAuthorizeRequest) (*domain.OAuthAuthorizeResponse, error) {
+	code, codeHash, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate authorization code")
+		return nil, err
+	}
+
+	// Codes that were never exchanged are cleaned up as new ones are issued
+	if err := s.codeRepo.DeleteExpired(ctx); err != nil {
+		s.log.Warn().Err(err).Msg("Failed to delete expired authorization codes")
+	}
+
+	err = s.codeRepo.Create(ctx, &domain.OAuthAuthorizationCode{
+		CodeHash:      codeHash,
+		ClientID:      auth.client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        auth.scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     s.now().Add(s.cfg.OAuthCodeTTL),
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", userID.String()).Str("client_id", auth.client.ID.String()).Msg("Failed to store authorization code")
+		return nil, err
+	}
+
+	return authorizeRedirect(auth.redirectURI, req.State, url.Values{"code": {code}}), nil
+}
+
+// exchangeCode handles the authorization code grant
+func (s *oauthService) exchangeCode(ctx context.Context, client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.TokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code and code_verifier are required")
+	}
+
+	// The code is burned whatever the outcome, so it cannot be replayed
+	code, err := s.codeRepo.Consume(ctx, hashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, "invalid or expired authorization code")
+		}
+		s.log.Error().Err(err).Msg("Failed to consume authorization code")
+		return nil, err
+	}
+
+	if code.ClientID != client.ID || !s.now().Before(code.ExpiresAt) {
+		return nil, oauthError(OAuthInvalidGrant, "invalid or expired authorization code")
+	}
+	if code.RedirectURI != req.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if subtle.ConstantTimeCompare([]byte(oidc.Challenge(req.CodeVerifier)), []byte(code.CodeChallenge)) != 1 {
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, "the user no longer exists")
+		}
+		s.log.Error().Err(err).Str("user_id", code.UserID.String()).Msg("Failed to get user for authorization code")
+		return nil, err
+	}
+
+	token, err := s.issueTokens(ctx, client, user, uuid.New(), grantedScopes(code.Scopes, client, user.Role))
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Str("client_id", client.ID.String()).Msg("OAuth authorization code exchanged")
+	return token, nil
+}
+
+// refresh handles the refresh token grant. A scope narrower than the original one may be requested.
+func (s *oauthService) refresh(ctx context.Context, client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, oauthError(OAuthInvalidRequest, "refresh_token is required")
+	}
+
+	stored, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, "invalid or expired refresh token")
+		}
+		s.log.Error().Err(err).Msg("Failed to get refresh token")
+		return nil, err
+	}
+
+	if stored.ClientID == nil || *stored.ClientID != client.ID {
+		return nil, oauthError(OAuthInvalidGrant, "invalid or expired refresh token")
+	}
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+	if !s.now().Before(stored.ExpiresAt) {
+		return nil, oauthError(OAuthInvalidGrant, "invalid or expired refresh token")
+	}
+
+	scopes := stored.Scopes
+	if requested := domain.SplitScopes(req.Scope); len(requested) > 0 {
+		if !containsAll(stored.Scopes, requested) {
+			return nil, oauthError(OAuthInvalidScope, "requested scope exceeds the original grant")
+		}
+		scopes = unionScopes(nil, requested)
+	}
+
+	// Mark as used; losing this race means another request rotated it first
+	if err := s.refreshTokenRepo.MarkUsed(ctx, stored.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, s.handleRefreshTokenReuse(ctx, stored)
+		}
+		s.log.Error().Err(err).Msg("Failed to mark refresh token as used")
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, "the user no longer exists")
+		}
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to get user for refresh")
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, client, user, stored.FamilyID, grantedScopes(scopes, client, user.Role))
+}
+
+// clientCredentials handles the client credentials grant
+func (s *oauthService) clientCredentials(ctx context.Context, client *domain.OAuthClient, req *domain.OAuthTokenRequest) (*domain.TokenResponse, error) {
+	if !client.IsConfidential() {
+		return nil, oauthError(OAuthUnauthorizedClient, "public clients cannot use the client_credentials grant")
+	}
+
+	// The scopes were copied from the owner at registration, so check them against the owner's role now
+	if client.CreatedBy == nil {
+		return nil, oauthError(OAuthUnauthorizedClient, "the client has no owner")
+	}
+	owner, err := s.userRepo.GetByID(ctx, *client.CreatedBy)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, oauthError(OAuthUnauthorizedClient, "the owner of the client no longer exists")
+		}
+		s.log.Error().Err(err).Str("client_id", client.ID.String()).Msg("Failed to get OAuth client owner")
+		return nil, err
+	}
+
+	scopes := clientOwnScopes(client.Scopes, owner.Role)
+	if requested := domain.SplitScopes(req.Scope); len(requested) > 0 {
+		if !containsAll(scopes, requested) {
+			return nil, oauthError(OAuthInvalidScope, "requested scope is not available to the client itself")
+		}
+		scopes = unionScopes(nil, requested)
+	}
+	if len(scopes) == 0 {
+		return nil, oauthError(OAuthInvalidScope, "no scope is available to the client itself")
+	}
+
+	accessToken, err := s.tokens.GenerateForClient(client.ID.String(), nil, scopes)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate token")
+		return nil, err
+	}
+
+	s.log.Info().Str("client_id", client.ID.String()).Msg("OAuth client credentials token issued")
+	return &domain.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   s.tokens.GetExpireTime(),
+		Scope:       domain.JoinScopes(scopes),
+	}, nil
+}
+
+// issueTokens generates an access token and a refresh token issued to a client for a user
+func (s *oauthService) issueTokens(ctx context.Context, client *domain.OAuthClient, user *domain.User, familyID uuid.UUID, scopes []string) (*domain.TokenResponse, error) {
+	if len(scopes) == 0 {
+		return nil, oauthError(OAuthInvalidScope, "no requested scope is still permitted")
+	}
+
+	accessToken, err := s.tokens.GenerateForClient(client.ID.String(), user, scopes)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate token")
+		return nil, err
+	}
+
+	refreshToken, refreshTokenHash, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate refresh token")
+		return nil, err
+	}
+
+	clientID := client.ID
+	err = s.refreshTokenRepo.Create(ctx, &domain.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		ClientID:  &clientID,
+		TokenHash: refreshTokenHash,
+		Scopes:    scopes,
+		ExpiresAt: s.now().Add(s.cfg.RefreshTokenTTL),
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Str("client_id", client.ID.String()).Msg("Failed to store refresh token")
+		return nil, err
+	}
+
+	return &domain.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    s.tokens.GetExpireTime(),
+		Scope:        domain.JoinScopes(scopes),
+	}, nil
+}
+
+// handleRefreshTokenReuse revokes the family of a refresh token that was presented again
+func (s *oauthService) handleRefreshTokenReuse(ctx context.Context, stored *domain.RefreshToken) error {
+	s.log.Warn().
+		Str("user_id", stored.UserID.String()).
+		Str("family_id", stored.FamilyID.String()).
+		Msg("OAuth refresh token reuse detected, revoking token family")
+
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		s.log.Error().Err(err).Str("family_id", stored.FamilyID.String()).Msg("Failed to revoke refresh token family")
+		return err
+	}
+
+	return oauthError(OAuthInvalidGrant, "refresh token has already been used")
+}
+
+// authenticateClient returns the client the credentials belong to. Confidential clients
+// must present their secret; public clients only identify themselves.
+func (s *oauthService) authenticateClient(ctx context.Context, creds domain.OAuthClientCredentials) (*domain.OAuthClient, error) {
+	client, err := s.getClient(ctx, creds.ID)
+	if err != nil {
+		if errors.Is(err, ErrOAuthClientNotFound) {
+			return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+		return nil, err
+	}
+
+	if client.IsConfidential() {
+		if creds.Secret == "" || subtle.ConstantTimeCompare([]byte(hashToken(creds.Secret)), []byte(*client.SecretHash)) != 1 {
+			return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+		}
+	} else if creds.Secret != "" {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+
+	return client, nil
+}
+
+// getClient returns the client with the given ID, or ErrOAuthClientNotFound
+func (s *oauthService) getClient(ctx context.Context, id string) (*domain.OAuthClient, error) {
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrOAuthClientNotFound
+	}
+
+	client, err := s.clientRepo.GetByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrOAuthClientNotFound
+		}
+		s.log.Error().Err(err).Str("client_id", id).Msg("Failed to get OAuth client")
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// activeAccessToken returns the claims of an access token that is valid and not revoked,
+// or nil. Tokens of deleted clients are no longer active.
+func (s *oauthService) activeAccessToken(ctx context.Context, token string) (*jwt.Claims, error) {
+	claims, err := s.verifier.Validate(token)
+	if err != nil {
+		return nil, nil
+	}
+
+	revoked, err := s.revocations.IsRevoked(ctx, claims)
+	if err != nil || revoked {
+		return nil, err
+	}
+
+	if claims.ClientID != "" {
+		if _, err := s.getClient(ctx, claims.ClientID); err != nil {
+			if errors.Is(err, ErrOAuthClientNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// clientUserScopes returns the scopes a client may be granted by a user of the given role.
+// Requesting no scopes asks for every scope of the client the role grants.
+func clientUserScopes(client *domain.OAuthClient, role domain.Role, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		scopes := grantedScopes(client.Scopes, client, role)
+		if len(scopes) == 0 {
+			return nil, ErrInvalidScope
+		}
+		return scopes, nil
+	}
+
+	for _, scope := range requested {
+		perm := domain.Permission(scope)
+		if !domain.IsValidPermission(perm) || !role.Grants(perm) || !containsAll(client.Scopes, []string{scope}) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	return unionScopes(nil, requested), nil
+}
+
+// clientOwnScopes returns the scopes a client acting for itself may get: those it was
+// registered with that a regular user has and the role of its owner still grants
+func clientOwnScopes(scopes []string, ownerRole domain.Role) []string {
+	own := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		perm := domain.Permission(scope)
+		if domain.RoleUser.Grants(perm) && ownerRole.Grants(perm) {
+			own = append(own, scope)
+		}
+	}
+	return own
+}
+
+// grantedScopes narrows scopes down to what the client and the user's role still allow
+func grantedScopes(scopes []string, client *domain.OAuthClient, role domain.Role) []string {
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if role.Grants(domain.Permission(scope)) && containsAll(client.Scopes, []string{scope}) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
+
+// containsAll reports whether every one of want is in have
+func containsAll(have, want []string) bool {
+	set := make(map[string]bool, len(have))
+	for _, s := range have {
+		set[s] = true
+	}
+	for _, s := range want {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// unionScopes returns the sorted, deduplicated scopes of a and b
+func unionScopes(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	scopes := make([]string, 0, len(a)+len(b))
+	for _, scope := range append(append([]string{}, a...), b...) {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// authorizeRedirect returns the redirect back to the client with the given parameters and state
+func authorizeRedirect(redirectURI, state string, params url.Values) *domain.OAuthAuthorizeResponse {
+	u, _ := url.Parse(redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return &domain.OAuthAuthorizeResponse{RedirectTo: u.String()}
+}
+
+// isValidRedirectURI reports whether a redirect URI can be registered: it must be
+// absolute, as required by RFC 6749 section 3.1.2, and have no fragment. Only
+// https, http to a loopback host (RFC 8252 section 7.3) and the given custom
+// schemes are allowed, so that codes are never handed to scripts or data URIs.
+func isValidRedirectURI(uri string, customSchemes []string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return isLoopbackHost(u.Hostname())
+	case "":
+		return false
+	}
+
+	for _, scheme := range customSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return u.Host != "" || u.Opaque != "" || u.Path != ""
+		}
+	}
+	return false
+}
+
+// isLoopbackHost reports whether host names the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,774 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/jwt/jwttest"
+	"go-echo-starter/pkg/logger"
+)
+
+// MockOAuthClientRepository is a mock implementation of repository.OAuthClientRepository
+type MockOAuthClientRepository struct {
+	mock.Mock
+}
+
+func (m *MockOAuthClientRepository) Create(ctx context.Context, client *domain.OAuthClient) error {
+	args := m.Called(ctx, client)
+	return args.Error(0)
+}
+
+func (m *MockOAuthClientRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.OAuthClient, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthClientRepository) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthClientRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockOAuthCodeRepository is a mock implementation of repository.OAuthCodeRepository
+type MockOAuthCodeRepository struct {
+	mock.Mock
+}
+
+func (m *MockOAuthCodeRepository) Create(ctx context.Context, code *domain.OAuthAuthorizationCode) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockOAuthCodeRepository) Consume(ctx context.Context, hash string) (*domain.OAuthAuthorizationCode, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OAuthAuthorizationCode), args.Error(1)
+}
+
+func (m *MockOAuthCodeRepository) DeleteExpired(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+// MockOAuthConsentRepository is a mock implementation of repository.OAuthConsentRepository
+type MockOAuthConsentRepository struct {
+	mock.Mock
+}
+
+func (m *MockOAuthConsentRepository) Get(ctx context.Context, userID, clientID uuid.UUID) (*domain.OAuthConsent, error) {
+	args := m.Called(ctx, userID, clientID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OAuthConsent), args.Error(1)
+}
+
+func (m *MockOAuthConsentRepository) Upsert(ctx context.Context, consent *domain.OAuthConsent) error {
+	args := m.Called(ctx, consent)
+	return args.Error(0)
+}
+
+func (m *MockOAuthConsentRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*domain.OAuthConsent, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.OAuthConsent), args.Error(1)
+}
+
+func (m *MockOAuthConsentRepository) Delete(ctx context.Context, userID, clientID uuid.UUID) error {
+	args := m.Called(ctx, userID, clientID)
+	return args.Error(0)
+}
+
+// oauthServiceMocks holds the mocked dependencies of an OAuth service under test
+type oauthServiceMocks struct {
+	clients       *MockOAuthClientRepository
+	codes         *MockOAuthCodeRepository
+	consents      *MockOAuthConsentRepository
+	users         *MockUserRepository
+	refreshTokens *MockRefreshTokenRepository
+	revocations   *MockTokenRevocationService
+	tokens        *jwttest.Fake
+}
+
+// newTestOAuthService creates an OAuth service backed by fresh mocks whose clock is frozen at testNow
+func newTestOAuthService() (OAuthService, *oauthServiceMocks) {
+	m := &oauthServiceMocks{
+		clients:       new(MockOAuthClientRepository),
+		codes:         new(MockOAuthCodeRepository),
+		consents:      new(MockOAuthConsentRepository),
+		users:         new(MockUserRepository),
+		refreshTokens: new(MockRefreshTokenRepository),
+		revocations:   new(MockTokenRevocationService),
+		tokens:        jwttest.New(),
+	}
+	m.tokens.Now = func() time.Time { return testNow }
+	svc := NewOAuthService(m.clients, m.codes, m.consents, m.users, m.refreshTokens, m.revocations, m.tokens, m.tokens, testAuthConfig, logger.New("debug", true))
+	svc.(*oauthService).now = func() time.Time { return testNow }
+	return svc, m
+}
+
+// PKCE verifier and challenge from RFC 7636 Appendix B
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+// testOAuthClient returns a client with the given secret, or a public one if it is empty
+func testOAuthClient(secret string) *domain.OAuthClient {
+	client := &domain.OAuthClient{
+		ID:           uuid.New(),
+		Name:         "Test App",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+		Scopes:       []string{"users:read", "users:write"},
+	}
+	if secret != "" {
+		hash := hashToken(secret)
+		client.SecretHash = &hash
+	}
+	return client
+}
+
+// testAuthorizeRequest returns a valid authorization request for the client
+func testAuthorizeRequest(client *domain.OAuthClient) *domain.OAuthAuthorizeRequest {
+	return &domain.OAuthAuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.ID.String(),
+		Scope:               "users:read",
+		State:               "xyz",
+		CodeChallenge:       testChallenge,
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// redirectQuery returns the query of the redirect in an authorize response
+func redirectQuery(t *testing.T, resp *domain.OAuthAuthorizeResponse) url.Values {
+	t.Helper()
+	u, err := url.Parse(resp.RedirectTo)
+	assert.NoError(t, err)
+	return u.Query()
+}
+
+// oauthErrorCode returns the OAuth error code of err, or "" if it has none
+func oauthErrorCode(err error) string {
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return ""
+}
+
+func TestOAuthService_RegisterClient(t *testing.T) {
+	admin := &domain.AuthUser{ID: uuid.New(), Role: domain.RoleAdmin, Scopes: []string{"oauth:manage", "users:read"}}
+
+	t.Run("confidential client stores only the secret hash", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+
+		var stored *domain.OAuthClient
+		m.clients.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*domain.OAuthClient)
+		}).Return(nil)
+
+		res, err := svc.RegisterClient(context.Background(), admin, &domain.CreateOAuthClientRequest{Name: "Backend"})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.ClientSecret)
+		assert.Equal(t, hashToken(res.ClientSecret), *stored.SecretHash)
+		assert.Equal(t, []string{"oauth:manage", "users:read"}, stored.Scopes)
+		assert.Equal(t, admin.ID, *stored.CreatedBy)
+	})
+
+	t.Run("public client needs a redirect URI", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+
+		_, err := svc.RegisterClient(context.Background(), admin, &domain.CreateOAuthClientRequest{Name: "Mobile", Public: true})
+
+		assert.True(t, errors.Is(err, ErrInvalidRedirectURI))
+		m.clients.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("script redirect URI", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+
+		_, err := svc.RegisterClient(context.Background(), admin, &domain.CreateOAuthClientRequest{
+			Name:         "Web",
+			RedirectURIs: []string{"https://app.example.com/callback", "javascript:alert(1)"},
+		})
+
+		assert.True(t, errors.Is(err, ErrInvalidRedirectURI))
+		m.clients.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("redirect URI with a fragment", func(t *testing.T) {
+		svc, _ := newTestOAuthService()
+
+		_, err := svc.RegisterClient(context.Background(), admin, &domain.CreateOAuthClientRequest{
+			Name:         "Web",
+			RedirectURIs: []string{"https://app.example.com/callback#token"},
+		})
+
+		assert.True(t, errors.Is(err, ErrInvalidRedirectURI))
+	})
+}
+
+func TestIsValidRedirectURI(t *testing.T) {
+	customSchemes := []string{"com.example.app"}
+
+	cases := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"https://app.example.com:8443/callback?source=oauth", true},
+		{"http://localhost:3000/callback", true},
+		{"http://127.0.0.1:49152/callback", true},
+		{"http://[::1]:49152/callback", true},
+		{"com.example.app:/oauth/callback", true},
+		{"COM.EXAMPLE.APP:/oauth/callback", true},
+
+		{"javascript:alert(document.cookie)", false},
+		{"JavaScript://app.example.com/%0aalert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"vbscript:msgbox(1)", false},
+		{"file:///etc/passwd", false},
+		{"ftp://app.example.com/callback", false},
+		{"http://app.example.com/callback", false},
+		{"http://localhost.example.com/callback", false},
+		{"https:/callback", false},
+		{"/callback", false},
+		{"//app.example.com/callback", false},
+		{"com.other.app:/oauth/callback", false},
+		{"com.example.app:", false},
+		{"https://app.example.com/callback#token", false},
+		{"https://app.example.com/%zz", false},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.valid, isValidRedirectURI(tc.uri, customSchemes), tc.uri)
+	}
+}
+
+func TestOAuthService_Authorize(t *testing.T) {
+	user := &domain.AuthUser{ID: uuid.New(), Role: domain.RoleUser}
+
+	t.Run("asks for consent", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.consents.On("Get", mock.Anything, user.ID, client.ID).Return(nil, repository.ErrNotFound)
+
+		res, err := svc.Authorize(context.Background(), user, testAuthorizeRequest(client))
+
+		assert.NoError(t, err)
+		assert.True(t, res.ConsentRequired)
+		assert.Equal(t, []string{"users:read"}, res.Scopes)
+		assert.Empty(t, res.RedirectTo)
+	})
+
+	t.Run("issues a code when consent was given", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.consents.On("Get", mock.Anything, user.ID, client.ID).Return(&domain.OAuthConsent{Scopes: []string{"users:read", "users:write"}}, nil)
+		m.codes.On("DeleteExpired", mock.Anything).Return(nil)
+		var stored *domain.OAuthAuthorizationCode
+		m.codes.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*domain.OAuthAuthorizationCode)
+		}).Return(nil)
+
+		res, err := svc.Authorize(context.Background(), user, testAuthorizeRequest(client))
+
+		assert.NoError(t, err)
+		query := redirectQuery(t, res)
+		assert.Equal(t, "xyz", query.Get("state"))
+		assert.Equal(t, hashToken(query.Get("code")), stored.CodeHash)
+		assert.Equal(t, testChallenge, stored.CodeChallenge)
+		assert.Equal(t, testNow.Add(time.Minute), stored.ExpiresAt)
+	})
+
+	t.Run("unknown client is not redirected to", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(nil, repository.ErrNotFound)
+
+		res, err := svc.Authorize(context.Background(), user, testAuthorizeRequest(client))
+
+		assert.Nil(t, res)
+		assert.Equal(t, OAuthInvalidRequest, oauthErrorCode(err))
+	})
+
+	t.Run("unregistered redirect URI is not redirected to", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		req := testAuthorizeRequest(client)
+		req.RedirectURI = "https://evil.example.com/callback"
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		res, err := svc.Authorize(context.Background(), user, req)
+
+		assert.Nil(t, res)
+		assert.Equal(t, OAuthInvalidRequest, oauthErrorCode(err))
+	})
+
+	t.Run("missing PKCE is reported to the client", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		req := testAuthorizeRequest(client)
+		req.CodeChallengeMethod = "plain"
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		res, err := svc.Authorize(context.Background(), user, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, OAuthInvalidRequest, redirectQuery(t, res).Get("error"))
+	})
+
+	t.Run("scope the user's role does not grant", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		client.Scopes = append(client.Scopes, "users:manage")
+		req := testAuthorizeRequest(client)
+		req.Scope = "users:manage"
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		res, err := svc.Authorize(context.Background(), user, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, OAuthInvalidScope, redirectQuery(t, res).Get("error"))
+	})
+}
+
+func TestOAuthService_Consent(t *testing.T) {
+	user := &domain.AuthUser{ID: uuid.New(), Role: domain.RoleUser}
+
+	t.Run("denied", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		res, err := svc.Consent(context.Background(), user, &domain.OAuthConsentRequest{OAuthAuthorizeRequest: *testAuthorizeRequest(client)})
+
+		assert.NoError(t, err)
+		assert.Equal(t, OAuthAccessDenied, redirectQuery(t, res).Get("error"))
+		m.consents.AssertNotCalled(t, "Upsert", mock.Anything, mock.Anything)
+	})
+
+	t.Run("approved scopes are added to earlier ones", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		req := &domain.OAuthConsentRequest{OAuthAuthorizeRequest: *testAuthorizeRequest(client), Approve: true}
+		req.Scope = "users:write"
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.consents.On("Get", mock.Anything, user.ID, client.ID).Return(&domain.OAuthConsent{Scopes: []string{"users:read"}}, nil)
+		m.consents.On("Upsert", mock.Anything, mock.MatchedBy(func(c *domain.OAuthConsent) bool {
+			return assert.ObjectsAreEqual([]string{"users:read", "users:write"}, c.Scopes)
+		})).Return(nil)
+		m.codes.On("DeleteExpired", mock.Anything).Return(nil)
+		m.codes.On("Create", mock.Anything, mock.MatchedBy(func(code *domain.OAuthAuthorizationCode) bool {
+			return assert.ObjectsAreEqual([]string{"users:write"}, code.Scopes)
+		})).Return(nil)
+
+		res, err := svc.Consent(context.Background(), user, req)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, redirectQuery(t, res).Get("code"))
+		m.consents.AssertExpectations(t)
+	})
+}
+
+func TestOAuthService_Token_AuthorizationCode(t *testing.T) {
+	user := &domain.User{ID: uuid.New(), Role: domain.RoleUser}
+
+	newCode := func(client *domain.OAuthClient) *domain.OAuthAuthorizationCode {
+		return &domain.OAuthAuthorizationCode{
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			Scopes:        []string{"users:read"},
+			CodeChallenge: testChallenge,
+			ExpiresAt:     testNow.Add(time.Minute),
+		}
+	}
+
+	t.Run("public client with PKCE", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.codes.On("Consume", mock.Anything, hashToken("the-code")).Return(newCode(client), nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.MatchedBy(func(rt *domain.RefreshToken) bool {
+			return *rt.ClientID == client.ID && rt.UserID == user.ID
+		})).Return(nil)
+
+		res, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeAuthorizationCode,
+			Code:         "the-code",
+			CodeVerifier: testVerifier,
+		})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.RefreshToken)
+		assert.Equal(t, "users:read", res.Scope)
+		claims, _ := m.tokens.Claims(res.AccessToken)
+		assert.Equal(t, client.ID.String(), claims.ClientID)
+		assert.Equal(t, user.ID, claims.UserID)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.codes.On("Consume", mock.Anything, hashToken("the-code")).Return(newCode(client), nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeAuthorizationCode,
+			Code:         "the-code",
+			CodeVerifier: "another-verifier-that-is-long-enough-to-be-a-real-one",
+		})
+
+		assert.Equal(t, OAuthInvalidGrant, oauthErrorCode(err))
+		assert.Equal(t, 0, m.tokens.Issued())
+	})
+
+	t.Run("redirect URI differs from the authorization request", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		code := newCode(client)
+		code.RedirectURI = "https://app.example.com/callback"
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.codes.On("Consume", mock.Anything, hashToken("the-code")).Return(code, nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeAuthorizationCode,
+			Code:         "the-code",
+			CodeVerifier: testVerifier,
+		})
+
+		assert.Equal(t, OAuthInvalidGrant, oauthErrorCode(err))
+	})
+
+	t.Run("code issued to another client", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.codes.On("Consume", mock.Anything, hashToken("the-code")).Return(newCode(testOAuthClient("")), nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeAuthorizationCode,
+			Code:         "the-code",
+			CodeVerifier: testVerifier,
+		})
+
+		assert.Equal(t, OAuthInvalidGrant, oauthErrorCode(err))
+	})
+
+	t.Run("confidential client with a wrong secret", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("s3cret")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "wrong"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeAuthorizationCode,
+		})
+
+		assert.Equal(t, OAuthInvalidClient, oauthErrorCode(err))
+		m.codes.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything)
+	})
+}
+
+func TestOAuthService_Token_RefreshToken(t *testing.T) {
+	user := &domain.User{ID: uuid.New(), Role: domain.RoleUser}
+
+	t.Run("rotates within the family", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		stored := &domain.RefreshToken{ID: uuid.New(), UserID: user.ID, FamilyID: uuid.New(), ClientID: &client.ID, Scopes: []string{"users:read"}, ExpiresAt: testNow.Add(time.Hour)}
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+		m.refreshTokens.On("MarkUsed", mock.Anything, stored.ID).Return(nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.MatchedBy(func(rt *domain.RefreshToken) bool {
+			return rt.FamilyID == stored.FamilyID && *rt.ClientID == client.ID
+		})).Return(nil)
+
+		res, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			RefreshToken: "old-token",
+		})
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, "old-token", res.RefreshToken)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("first-party token", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		stored := &domain.RefreshToken{ID: uuid.New(), UserID: user.ID, FamilyID: uuid.New(), ExpiresAt: testNow.Add(time.Hour)}
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			RefreshToken: "old-token",
+		})
+
+		assert.Equal(t, OAuthInvalidGrant, oauthErrorCode(err))
+		m.refreshTokens.AssertNotCalled(t, "MarkUsed", mock.Anything, mock.Anything)
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		usedAt := testNow.Add(-time.Minute)
+		stored := &domain.RefreshToken{ID: uuid.New(), UserID: user.ID, FamilyID: uuid.New(), ClientID: &client.ID, ExpiresAt: testNow.Add(time.Hour), UsedAt: &usedAt}
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+		m.refreshTokens.On("RevokeFamily", mock.Anything, stored.FamilyID).Return(nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType:    domain.GrantTypeRefreshToken,
+			RefreshToken: "old-token",
+		})
+
+		assert.Equal(t, OAuthInvalidGrant, oauthErrorCode(err))
+		m.refreshTokens.AssertExpectations(t)
+	})
+}
+
+func TestOAuthService_Token_ClientCredentials(t *testing.T) {
+	owner := &domain.User{ID: uuid.New(), Role: domain.RoleAdmin}
+	ownedClient := func(scopes ...string) *domain.OAuthClient {
+		client := testOAuthClient("s3cret")
+		client.CreatedBy = &owner.ID
+		if len(scopes) > 0 {
+			client.Scopes = scopes
+		}
+		return client
+	}
+
+	t.Run("confidential client gets an access token for itself", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := ownedClient()
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.users.On("GetByID", mock.Anything, owner.ID).Return(owner, nil)
+
+		res, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+			Scope:     "users:read",
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, res.RefreshToken)
+		assert.Equal(t, "users:read", res.Scope)
+		claims, _ := m.tokens.Claims(res.AccessToken)
+		assert.False(t, claims.HasUser())
+		assert.Equal(t, client.ID.String(), claims.Subject)
+	})
+
+	t.Run("admin scopes are never granted to the client itself", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := ownedClient("oauth:manage", "users:manage", "users:read")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.users.On("GetByID", mock.Anything, owner.ID).Return(owner, nil)
+
+		res, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "users:read", res.Scope)
+
+		_, err = svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+			Scope:     "users:manage",
+		})
+		assert.Equal(t, OAuthInvalidScope, oauthErrorCode(err))
+	})
+
+	t.Run("owner no longer has the scopes", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := ownedClient("users:read")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.users.On("GetByID", mock.Anything, owner.ID).Return(&domain.User{ID: owner.ID, Role: domain.Role("guest")}, nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+		})
+
+		assert.Equal(t, OAuthInvalidScope, oauthErrorCode(err))
+	})
+
+	t.Run("owner deleted", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := ownedClient()
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.users.On("GetByID", mock.Anything, owner.ID).Return(nil, repository.ErrNotFound)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+		})
+
+		assert.Equal(t, OAuthUnauthorizedClient, oauthErrorCode(err))
+	})
+
+	t.Run("scope not registered for the client", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := ownedClient()
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.users.On("GetByID", mock.Anything, owner.ID).Return(owner, nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+			Scope:     "users:manage",
+		})
+
+		assert.Equal(t, OAuthInvalidScope, oauthErrorCode(err))
+	})
+
+	t.Run("public client", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		_, err := svc.Token(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenRequest{
+			GrantType: domain.GrantTypeClientCredentials,
+		})
+
+		assert.Equal(t, OAuthUnauthorizedClient, oauthErrorCode(err))
+	})
+}
+
+func TestOAuthService_Introspect(t *testing.T) {
+	t.Run("active access token", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("s3cret")
+		token, _ := m.tokens.GenerateForClient(client.ID.String(), &domain.User{ID: uuid.New()}, []string{"users:read"})
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken(token)).Return(nil, repository.ErrNotFound)
+		m.revocations.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil)
+
+		res, err := svc.Introspect(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenActionRequest{Token: token})
+
+		assert.NoError(t, err)
+		assert.True(t, res.Active)
+		assert.Equal(t, "users:read", res.Scope)
+		assert.Equal(t, client.ID.String(), res.ClientID)
+		assert.Equal(t, testNow.Add(jwttest.DefaultExpireTime).Unix(), res.ExpiresAt)
+	})
+
+	t.Run("refresh token of another client is inactive", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("s3cret")
+		otherID := uuid.New()
+		stored := &domain.RefreshToken{UserID: uuid.New(), ClientID: &otherID, ExpiresAt: testNow.Add(time.Hour)}
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("refresh")).Return(stored, nil)
+
+		res, err := svc.Introspect(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String(), Secret: "s3cret"}, &domain.OAuthTokenActionRequest{Token: "refresh"})
+
+		assert.NoError(t, err)
+		assert.False(t, res.Active)
+	})
+
+	t.Run("public client", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+
+		_, err := svc.Introspect(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenActionRequest{Token: "token"})
+
+		assert.Equal(t, OAuthUnauthorizedClient, oauthErrorCode(err))
+	})
+}
+
+func TestOAuthService_Revoke(t *testing.T) {
+	t.Run("refresh token family of the client", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		stored := &domain.RefreshToken{UserID: uuid.New(), FamilyID: uuid.New(), ClientID: &client.ID}
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken("refresh")).Return(stored, nil)
+		m.refreshTokens.On("RevokeFamily", mock.Anything, stored.FamilyID).Return(nil)
+
+		err := svc.Revoke(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenActionRequest{Token: "refresh"})
+
+		assert.NoError(t, err)
+		m.refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("access token of another client is ignored", func(t *testing.T) {
+		svc, m := newTestOAuthService()
+		client := testOAuthClient("")
+		token, _ := m.tokens.GenerateForClient(uuid.NewString(), &domain.User{ID: uuid.New()}, []string{"users:read"})
+
+		m.clients.On("GetByID", mock.Anything, client.ID).Return(client, nil)
+		m.refreshTokens.On("GetByHash", mock.Anything, hashToken(token)).Return(nil, repository.ErrNotFound)
+
+		err := svc.Revoke(context.Background(), domain.OAuthClientCredentials{ID: client.ID.String()}, &domain.OAuthTokenActionRequest{Token: token})
+
+		assert.NoError(t, err)
+		m.revocations.AssertNotCalled(t, "Revoke", mock.Anything, mock.Anything)
+	})
+}
+
+func TestOAuthService_RevokeConsent(t *testing.T) {
+	svc, m := newTestOAuthService()
+	userID, clientID := uuid.New(), uuid.New()
+
+	m.consents.On("Delete", mock.Anything, userID, clientID).Return(nil)
+	m.refreshTokens.On("RevokeForClient", mock.Anything, userID, clientID).Return(nil)
+
+	assert.NoError(t, svc.RevokeConsent(context.Background(), userID, clientID))
+	m.refreshTokens.AssertExpectations(t)
+
+	m.consents.On("Delete", mock.Anything, userID, uuid.Nil).Return(repository.ErrNotFound)
+	assert.True(t, errors.Is(svc.RevokeConsent(context.Background(), userID, uuid.Nil), ErrOAuthConsentNotFound))
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/mailer"
+	"go-echo-starter/pkg/oidc"
+)
+
+// Social login errors
+var (
+	ErrUnknownOIDCProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCLoginFailed      = errors.New("login with identity provider failed")
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not confirm a verified email address")
+)
+
+// OIDCAuthorize starts a social login, returning the provider URL to send the user to.
+// The state, nonce and PKCE verifier are kept until the provider redirects back.
+func (s *authService) OIDCAuthorize(ctx context.Context, providerName string) (string, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+
+	state, stateHash, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate oidc state")
+		return "", err
+	}
+	nonce, _, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate oidc nonce")
+		return "", err
+	}
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate pkce verifier")
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		s.log.Error().Err(err).Str("provider", providerName).Msg("Failed to build oidc authorization url")
+		return "", err
+	}
+
+	// Abandoned logins are cleaned up as new ones start
+	if err := s.oidcStateRepo.DeleteExpired(ctx); err != nil {
+		s.log.Warn().Err(err).Msg("Failed to delete expired oidc login states")
+	}
+
+	err = s.oidcStateRepo.Create(ctx, &domain.OIDCLoginState{
+		StateHash:    stateHash,
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    s.now().Add(s.cfg.OIDCStateTTL),
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("provider", providerName).Msg("Failed to store oidc login state")
+		return "", err
+	}
+
+	return authURL, nil
+}
+
+// OIDCCallback completes a social login started by OIDCAuthorize.
+// The user is found by the provider account, or else linked by a verified email
+// address to an existing user or a new one. Users with two-factor authentication
+// enabled get an MFA token, as with a password login.
+func (s *authService) OIDCCallback(ctx context.Context, providerName string, req *domain.OIDCCallbackRequest) (*domain.TokenResponse, error) {
+	provider, ok := s.oidcProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	// The state is burned whatever the outcome, so a callback cannot be replayed
+	state, err := s.oidcStateRepo.Consume(ctx, hashToken(req.State))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		s.log.Error().Err(err).Msg("Failed to consume oidc login state")
+		return nil, err
+	}
+	if state.Provider != providerName || !s.now().Before(state.ExpiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	if req.Error != "" || req.Code == "" {
+		s.log.Info().Str("provider", providerName).Str("error", req.Error).Str("description", req.ErrorDescription).Msg("Identity provider refused login")
+		return nil, ErrOIDCLoginFailed
+	}
+
+	providerToken, err := provider.Exchange(ctx, req.Code, state.CodeVerifier)
+	if err != nil {
+		s.log.Warn().Err(err).Str("provider", providerName).Msg("Failed to exchange oidc authorization code")
+		return nil, ErrOIDCLoginFailed
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, providerToken.IDToken, state.Nonce)
+	if err != nil {
+		s.log.Warn().Err(err).Str("provider", providerName).Msg("Rejected oidc id token")
+		return nil, ErrOIDCLoginFailed
+	}
+
+	user, err := s.oidcUser(ctx, providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsTwoFactorEnabled() {
+		return s.issueMFAToken(ctx, user)
+	}
+
+	token, err := s.issueTokens(ctx, user, uuid.New(), domain.ScopeStrings(domain.PermissionsForRole(user.Role)))
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Str("provider", providerName).Msg("User logged in with identity provider")
+
+	return token, nil
+}
+
+// oidcUser returns the user a provider account belongs to, linking it first if needed
+func (s *authService) oidcUser(ctx context.Context, providerName string, claims *oidc.IDTokenClaims) (*domain.User, error) {
+	identity, err := s.identityRepo.GetByProviderSubject(ctx, providerName, claims.Subject)
+	if err == nil {
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			// The identity stays linked to a deleted user, which a restore brings back
+			if errors.Is(err, repository.ErrNotFound) {
+				s.log.Warn().Str("user_id", identity.UserID.String()).Str("provider", providerName).Msg("Identity belongs to a deleted user")
+				return nil, ErrOIDCLoginFailed
+			}
+			s.log.Error().Err(err).Str("user_id", identity.UserID.String()).Msg("Failed to get user of identity")
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		s.log.Error().Err(err).Str("provider", providerName).Msg("Failed to get identity")
+		return nil, err
+	}
+
+	// Accounts are only ever linked by an address the provider vouches for
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if user, err = s.claimUnverifiedUser(ctx, user, "your "+providerName+" account"); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		if user, err = s.createOIDCUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	default:
+		s.log.Error().Err(err).Msg("Failed to get user by email")
+		return nil, err
+	}
+
+	email := claims.Email
+	err = s.identityRepo.Create(ctx, &domain.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    &email,
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Str("provider", providerName).Msg("Failed to link identity")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Str("provider", providerName).Msg("Identity linked to user")
+	return user, nil
+}
+
+// claimUnverifiedUser prepares an existing user for a login that proved ownership
+// of its email, through a provider account or a login link. If the email was never verified, the
+// account may have been registered by someone else in advance, so its password
+// is replaced and its sessions are revoked before the email is marked verified.
+// This happens whether or not verification is required, and the email owner is
+// told about it; via says how the email was proved, for that notice.
+func (s *authService) claimUnverifiedUser(ctx context.Context, user *domain.User, via string) (*domain.User, error) {
+	if user.IsEmailVerified() {
+		return user, nil
+	}
+
+	password, err := s.unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, password); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to replace password of unverified user")
+		return nil, err
+	}
+	if err := s.revokeAllTokens(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to mark email as verified")
+		return nil, err
+	}
+
+	s.log.Warn().Str("user_id", user.ID.String()).Msg("Unverified user claimed by email owner")
+
+	msg := &mailer.Message{
+		To:      user.Email,
+		Subject: "Your account was secured",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYou just signed in with %s, which confirmed this email address for the first time. Since nobody had confirmed it before, the account could have been registered by someone else, so its password was removed and every other session was signed out.\n\nTo log in with a password again, set a new one at:\n\n%s\n",
+			user.Name, via, s.cfg.PasswordResetURL,
+		),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send account claim notice")
+	}
+
+	// Reload the user to pick up the bumped token version
+	reloaded, err := s.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to get user after claiming")
+		return nil, err
+	}
+	return reloaded, nil
+}
+
+// createOIDCUser creates a user for a provider account. The user has no usable
+// password until they set one through the password reset flow.
+func (s *authService) createOIDCUser(ctx context.Context, claims *oidc.IDTokenClaims) (*domain.User, error) {
+	password, err := s.unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &domain.User{
+		Name:     name,
+		Email:    claims.Email,
+		Password: password,
+		Role:     domain.RoleUser,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+		}
+		s.log.Error().Err(err).Msg("Failed to create user")
+		return nil, err
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to mark email as verified")
+		return nil, err
+	}
+	now := s.now()
+	user.EmailVerifiedAt = &now
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("User registered with identity provider")
+	return user, nil
+}
+
+// unusablePassword returns the hash of a random password nobody knows
+func (s *authService) unusablePassword() (string, error) {
+	password, _, err := generateOpaqueToken()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate password")
+		return "", err
+	}
+	return s.hashPassword(password)
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/mailer"
+	"go-echo-starter/pkg/oidc"
+	"go-echo-starter/pkg/oidc/oidctest"
+)
+
+// MockUserIdentityRepository is a mock implementation of repository.UserIdentityRepository
+type MockUserIdentityRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserIdentityRepository) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+func (m *MockUserIdentityRepository) GetByProviderSubject(ctx context.Context, provider, subject string) (*domain.UserIdentity, error) {
+	args := m.Called(ctx, provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserIdentity), args.Error(1)
+}
+
+// MockOIDCStateRepository is a mock implementation of repository.OIDCStateRepository
+type MockOIDCStateRepository struct {
+	mock.Mock
+}
+
+func (m *MockOIDCStateRepository) Create(ctx context.Context, state *domain.OIDCLoginState) error {
+	args := m.Called(ctx, state)
+	return args.Error(0)
+}
+
+func (m *MockOIDCStateRepository) Consume(ctx context.Context, hash string) (*domain.OIDCLoginState, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OIDCLoginState), args.Error(1)
+}
+
+func (m *MockOIDCStateRepository) DeleteExpired(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+const testProvider = "test"
+
+var testIdentity = oidctest.Identity{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Doe"}
+
+// newTestOIDCAuthService creates an auth service signing in through a local stand-in provider
+func newTestOIDCAuthService(t *testing.T, identity oidctest.Identity) (AuthService, *authServiceMocks, *oidctest.Server) {
+	server := oidctest.NewServer(identity)
+	t.Cleanup(server.Close)
+
+	svc, m := newTestAuthServiceAt(testNow)
+	svc.(*authService).oidcProviders = map[string]*oidc.Provider{
+		testProvider: oidc.New(server.Config(testProvider, "http://localhost:8080/api/v1/auth/oidc/test/callback"), nil),
+	}
+	return svc, m, server
+}
+
+// startOIDCLogin starts a login and signs in at the provider, returning the
+// stored login state and the callback the provider redirected to
+func startOIDCLogin(t *testing.T, svc AuthService, m *authServiceMocks, server *oidctest.Server) (*domain.OIDCLoginState, *domain.OIDCCallbackRequest) {
+	var stored *domain.OIDCLoginState
+	m.oidcStates.On("DeleteExpired", mock.Anything).Return(nil)
+	m.oidcStates.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(*domain.OIDCLoginState)
+	}).Return(nil)
+
+	authURL, err := svc.OIDCAuthorize(context.Background(), testProvider)
+	assert.NoError(t, err)
+
+	query, err := server.Authorize(authURL)
+	assert.NoError(t, err)
+
+	return stored, &domain.OIDCCallbackRequest{
+		Code:  query.Get("code"),
+		State: query.Get("state"),
+		Error: query.Get("error"),
+	}
+}
+
+func TestAuthService_OIDCAuthorize(t *testing.T) {
+	svc, m, server := newTestOIDCAuthService(t, testIdentity)
+
+	stored, callback := startOIDCLogin(t, svc, m, server)
+
+	assert.Equal(t, hashToken(callback.State), stored.StateHash)
+	assert.Equal(t, testProvider, stored.Provider)
+	assert.Equal(t, testNow.Add(testAuthConfig.OIDCStateTTL), stored.ExpiresAt)
+	assert.NotEmpty(t, callback.Code)
+
+	_, err := svc.OIDCAuthorize(context.Background(), "unknown")
+	assert.True(t, errors.Is(err, ErrUnknownOIDCProvider))
+}
+
+func TestAuthService_OIDCCallback(t *testing.T) {
+	t.Run("creates a verified user on first login", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		userID := uuid.New()
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		m.identities.On("GetByProviderSubject", mock.Anything, testProvider, "sub-1").Return(nil, repository.ErrNotFound)
+		m.users.On("GetByEmail", mock.Anything, "jane@example.com").Return(nil, repository.ErrNotFound)
+		m.users.On("Create", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+			return u.Name == "Jane Doe" && u.Email == "jane@example.com" && u.Password != ""
+		})).Run(func(args mock.Arguments) {
+			args.Get(1).(*domain.User).ID = userID
+		}).Return(nil)
+		m.users.On("MarkEmailVerified", mock.Anything, userID).Return(nil)
+		m.identities.On("Create", mock.Anything, mock.MatchedBy(func(i *domain.UserIdentity) bool {
+			return i.UserID == userID && i.Provider == testProvider && i.Subject == "sub-1"
+		})).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.AccessToken)
+		assert.NotEmpty(t, res.RefreshToken)
+		claims, _ := m.tokens.Claims(res.AccessToken)
+		assert.Equal(t, userID, claims.UserID)
+		m.users.AssertExpectations(t)
+		m.identities.AssertExpectations(t)
+	})
+
+	t.Run("signs in the linked user", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		user := &domain.User{ID: uuid.New(), Email: "old@example.com", Role: domain.RoleUser}
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		m.identities.On("GetByProviderSubject", mock.Anything, testProvider, "sub-1").Return(&domain.UserIdentity{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.AccessToken)
+		m.users.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+		m.identities.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("claims an unverified user with the same email", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		user := &domain.User{ID: uuid.New(), Email: "jane@example.com", Role: domain.RoleUser}
+		claimed := &domain.User{ID: user.ID, Email: user.Email, Role: domain.RoleUser, TokenVersion: 1}
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		m.identities.On("GetByProviderSubject", mock.Anything, testProvider, "sub-1").Return(nil, repository.ErrNotFound)
+		m.users.On("GetByEmail", mock.Anything, "jane@example.com").Return(user, nil)
+		m.users.On("UpdatePassword", mock.Anything, user.ID, mock.Anything).Return(nil)
+		m.revocations.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.refreshTokens.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.apiKeys.On("RevokeAllForUser", mock.Anything, user.ID).Return(nil)
+		m.users.On("MarkEmailVerified", mock.Anything, user.ID).Return(nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(claimed, nil)
+		m.mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg *mailer.Message) bool {
+			return msg.To == user.Email && strings.Contains(msg.Body, "your "+testProvider+" account")
+		})).Return(nil)
+		m.identities.On("Create", mock.Anything, mock.Anything).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.NoError(t, err)
+		claims, _ := m.tokens.Claims(res.AccessToken)
+		assert.Equal(t, 1, claims.TokenVersion)
+		m.users.AssertExpectations(t)
+		m.revocations.AssertExpectations(t)
+		m.mailer.AssertExpectations(t)
+	})
+
+	t.Run("identity of a deleted user", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		userID := uuid.New()
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		m.identities.On("GetByProviderSubject", mock.Anything, testProvider, "sub-1").Return(&domain.UserIdentity{UserID: userID}, nil)
+		m.users.On("GetByID", mock.Anything, userID).Return(nil, repository.ErrNotFound)
+
+		res, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrOIDCLoginFailed))
+		m.users.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unverified provider email", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, oidctest.Identity{Subject: "sub-2", Email: "jane@example.com"})
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		m.identities.On("GetByProviderSubject", mock.Anything, testProvider, "sub-2").Return(nil, repository.ErrNotFound)
+
+		_, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.True(t, errors.Is(err, ErrOIDCEmailNotVerified))
+		m.users.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("two-factor user gets an mfa token", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		enabledAt := testNow.Add(-time.Hour)
+		user := &domain.User{ID: uuid.New(), Role: domain.RoleUser, TOTPEnabledAt: &enabledAt}
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		m.identities.On("GetByProviderSubject", mock.Anything, testProvider, "sub-1").Return(&domain.UserIdentity{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.userTokens.On("Create", mock.Anything, mock.MatchedBy(func(ut *domain.UserToken) bool {
+			return ut.Purpose == domain.TokenPurposeMFAPending
+		})).Return(nil)
+
+		res, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.NoError(t, err)
+		assert.True(t, res.MFARequired)
+		assert.Empty(t, res.AccessToken)
+	})
+
+	t.Run("provider reports an error", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(stored, nil)
+		callback.Code, callback.Error = "", "access_denied"
+
+		_, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.True(t, errors.Is(err, ErrOIDCLoginFailed))
+	})
+
+	t.Run("code with the wrong verifier", func(t *testing.T) {
+		svc, m, server := newTestOIDCAuthService(t, testIdentity)
+		stored, callback := startOIDCLogin(t, svc, m, server)
+
+		tampered := *stored
+		tampered.CodeVerifier = "another-verifier"
+		m.oidcStates.On("Consume", mock.Anything, stored.StateHash).Return(&tampered, nil)
+
+		_, err := svc.OIDCCallback(context.Background(), testProvider, callback)
+
+		assert.True(t, errors.Is(err, ErrOIDCLoginFailed))
+		m.identities.AssertNotCalled(t, "GetByProviderSubject", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	invalidStates := []struct {
+		name  string
+		state *domain.OIDCLoginState
+		err   error
+	}{
+		{"unknown state", nil, repository.ErrNotFound},
+		{"expired state", &domain.OIDCLoginState{Provider: testProvider, ExpiresAt: testNow}, nil},
+		{"state of another provider", &domain.OIDCLoginState{Provider: "other", ExpiresAt: testNow.Add(time.Minute)}, nil},
+	}
+	for _, tc := range invalidStates {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, m, _ := newTestOIDCAuthService(t, testIdentity)
+
+			m.oidcStates.On("Consume", mock.Anything, hashToken("state")).Return(tc.state, tc.err)
+
+			_, err := svc.OIDCCallback(context.Background(), testProvider, &domain.OIDCCallbackRequest{Code: "code", State: "state"})
+
+			assert.True(t, errors.Is(err, ErrInvalidOIDCState))
+		})
+	}
+
+	t.Run("unknown provider", func(t *testing.T) {
+		svc, m, _ := newTestOIDCAuthService(t, testIdentity)
+
+		_, err := svc.OIDCCallback(context.Background(), "unknown", &domain.OIDCCallbackRequest{Code: "code", State: "state"})
+
+		assert.True(t, errors.Is(err, ErrUnknownOIDCProvider))
+		m.oidcStates.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything)
+	})
+}
@@ -12,7 +12,13 @@ import (
 type UserService interface {
 	Create(ctx context.Context, req *domain.CreateUserRequest) (*domain.UserResponse, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.UserResponse, error)
-	GetAll(ctx context.Context) ([]*domain.UserResponse, error)
+	GetAll(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.UserResponse, int, error)
+	GetAllByCursor(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.UserResponse, *domain.CursorPage, error)
+	Search(ctx context.Context, req *domain.SearchUsersRequest) ([]*domain.UserSearchResponse, error)
 	Update(ctx context.Context, id uuid.UUID, req *domain.UpdateUserRequest) (*domain.UserResponse, error)
+	Patch(ctx context.Context, id uuid.UUID, apply domain.UserPatchFunc) (*domain.UserResponse, error)
+	UpdateRole(ctx context.Context, id uuid.UUID, req *domain.UpdateRoleRequest) (*domain.UserResponse, error)
+	Unlock(ctx context.Context, id uuid.UUID) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	Restore(ctx context.Context, id uuid.UUID) (*domain.UserResponse, error)
 }
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/pkg/jwt"
+)
+
+// ErrSessionNotFound is returned for sessions that do not exist, belong to another user or have ended
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions lists the active sessions of the token's user, flagging the one the token belongs to
+func (s *authService) ListSessions(ctx context.Context, claims *jwt.Claims) ([]*domain.Session, error) {
+	sessions, err := s.refreshTokenRepo.ListSessions(ctx, claims.UserID)
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", claims.UserID.String()).Msg("Failed to list sessions")
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID.String() == claims.SessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs a user out of one session. Its refresh token stops working
+// and so do the access tokens issued in it.
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := s.revocations.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	s.log.Info().Str("user_id", userID.String()).Str("session_id", sessionID.String()).Msg("Session revoked")
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/pkg/jwt"
+)
+
+func TestAuthService_IssueTokensRecordsSession(t *testing.T) {
+	svc, m := newTestAuthService()
+
+	user := &domain.User{ID: uuid.New(), Email: "test@example.com"}
+	stored := &domain.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	ctx := domain.WithClientInfo(context.Background(), domain.ClientInfo{IP: "203.0.113.7", UserAgent: "Firefox"})
+
+	m.refreshTokens.On("GetByHash", mock.Anything, hashToken("old-token")).Return(stored, nil)
+	m.refreshTokens.On("MarkUsed", mock.Anything, stored.ID).Return(nil)
+	m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+	m.refreshTokens.On("Create", mock.Anything, mock.MatchedBy(func(rt *domain.RefreshToken) bool {
+		return rt.FamilyID == stored.FamilyID && rt.IPAddress == "203.0.113.7" && rt.UserAgent == "Firefox"
+	})).Return(nil)
+
+	res, err := svc.Refresh(ctx, &domain.RefreshTokenRequest{RefreshToken: "old-token"})
+
+	assert.NoError(t, err)
+	claims, _ := m.tokens.Claims(res.AccessToken)
+	assert.Equal(t, stored.FamilyID.String(), claims.SessionID)
+	m.refreshTokens.AssertExpectations(t)
+}
+
+func TestAuthService_ListSessions(t *testing.T) {
+	svc, m := newTestAuthService()
+
+	userID := uuid.New()
+	current := &domain.Session{ID: uuid.New(), UserAgent: "Firefox"}
+	other := &domain.Session{ID: uuid.New(), UserAgent: "curl"}
+	m.refreshTokens.On("ListSessions", mock.Anything, userID).Return([]*domain.Session{other, current}, nil)
+
+	sessions, err := svc.ListSessions(context.Background(), &jwt.Claims{UserID: userID, SessionID: current.ID.String()})
+
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+}
+
+func TestAuthService_RevokeSession(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		userID, sessionID := uuid.New(), uuid.New()
+		m.revocations.On("RevokeSession", mock.Anything, userID, sessionID).Return(nil)
+
+		err := svc.RevokeSession(context.Background(), userID, sessionID)
+
+		assert.NoError(t, err)
+		m.revocations.AssertExpectations(t)
+	})
+
+	t.Run("session of another user", func(t *testing.T) {
+		svc, m := newTestAuthService()
+
+		m.revocations.On("RevokeSession", mock.Anything, mock.Anything, mock.Anything).Return(ErrSessionNotFound)
+
+		err := svc.RevokeSession(context.Background(), uuid.New(), uuid.New())
+
+		assert.True(t, errors.Is(err, ErrSessionNotFound))
+	})
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/logger"
+)
+
+// sessionLastSeenInterval limits how often the last-seen time of a session is written
+const sessionLastSeenInterval = time.Minute
+
+// SessionTracker defines the interface for recording when sessions are used
+type SessionTracker interface {
+	Seen(ctx context.Context, sessionID uuid.UUID)
+}
+
+// sessionTracker records the last use of a session at most once per
+// sessionLastSeenInterval on each instance, remembering when it last did in memory.
+type sessionTracker struct {
+	refreshTokenRepo repository.RefreshTokenRepository
+	log              *logger.Logger
+	now              func() time.Time
+
+	mu        sync.Mutex
+	seen      map[uuid.UUID]time.Time
+	lastPrune time.Time
+}
+
+// NewSessionTracker creates a new session tracker
+func NewSessionTracker(refreshTokenRepo repository.RefreshTokenRepository, log *logger.Logger) SessionTracker {
+	return &sessionTracker{
+		refreshTokenRepo: refreshTokenRepo,
+		log:              log,
+		now:              time.Now,
+		seen:             make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Seen records that an access token of the session was accepted.
+// Failures are only logged, since they must not fail the request.
+func (t *sessionTracker) Seen(ctx context.Context, sessionID uuid.UUID) {
+	now := t.now()
+
+	t.mu.Lock()
+	if now.Sub(t.seen[sessionID]) < sessionLastSeenInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.seen[sessionID] = now
+
+	// Forget sessions that could be recorded again anyway, so ended ones do not pile up
+	if now.Sub(t.lastPrune) >= sessionLastSeenInterval {
+		for id, at := range t.seen {
+			if now.Sub(at) >= sessionLastSeenInterval {
+				delete(t.seen, id)
+			}
+		}
+		t.lastPrune = now
+	}
+	t.mu.Unlock()
+
+	if err := t.refreshTokenRepo.TouchSession(ctx, sessionID, now); err != nil {
+		t.log.Warn().Err(err).Str("session_id", sessionID.String()).Msg("Failed to record session use")
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/pkg/logger"
+)
+
+func TestSessionTracker_Seen(t *testing.T) {
+	log := logger.New("debug", true)
+
+	newTracker := func() (*sessionTracker, *MockRefreshTokenRepository, *time.Time) {
+		repo := new(MockRefreshTokenRepository)
+		tracker := NewSessionTracker(repo, log).(*sessionTracker)
+		now := testNow
+		tracker.now = func() time.Time { return now }
+		return tracker, repo, &now
+	}
+
+	t.Run("records a session at most once per interval", func(t *testing.T) {
+		tracker, repo, now := newTracker()
+		sessionID := uuid.New()
+
+		repo.On("TouchSession", mock.Anything, sessionID, mock.Anything).Return(nil)
+
+		tracker.Seen(context.Background(), sessionID)
+		*now = now.Add(30 * time.Second)
+		tracker.Seen(context.Background(), sessionID)
+		repo.AssertNumberOfCalls(t, "TouchSession", 1)
+
+		*now = now.Add(30 * time.Second)
+		tracker.Seen(context.Background(), sessionID)
+		repo.AssertNumberOfCalls(t, "TouchSession", 2)
+		repo.AssertCalled(t, "TouchSession", mock.Anything, sessionID, *now)
+	})
+
+	t.Run("sessions are throttled separately", func(t *testing.T) {
+		tracker, repo, _ := newTracker()
+		first, second := uuid.New(), uuid.New()
+
+		repo.On("TouchSession", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		tracker.Seen(context.Background(), first)
+		tracker.Seen(context.Background(), second)
+
+		repo.AssertCalled(t, "TouchSession", mock.Anything, first, mock.Anything)
+		repo.AssertCalled(t, "TouchSession", mock.Anything, second, mock.Anything)
+	})
+
+	t.Run("forgets sessions once they may be recorded again", func(t *testing.T) {
+		tracker, repo, now := newTracker()
+
+		repo.On("TouchSession", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		tracker.Seen(context.Background(), uuid.New())
+		*now = now.Add(2 * sessionLastSeenInterval)
+		tracker.Seen(context.Background(), uuid.New())
+
+		assert.Len(t, tracker.seen, 1)
+	})
+
+	t.Run("failure does not fail the request", func(t *testing.T) {
+		tracker, repo, _ := newTracker()
+
+		repo.On("TouchSession", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("db down"))
+
+		tracker.Seen(context.Background(), uuid.New())
+
+		repo.AssertExpectations(t)
+	})
+}
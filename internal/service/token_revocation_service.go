@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/jwt"
+	"go-echo-starter/pkg/logger"
+)
+
+// TokenRevocationService defines the interface for access token revocation
+type TokenRevocationService interface {
+	Revoke(ctx context.Context, claims *jwt.Claims) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	MarkSessionRevoked(sessionID uuid.UUID)
+	IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error)
+}
+
+// cachedTokenVersion is a user's token version along with when it was fetched
+type cachedTokenVersion struct {
+	version   int
+	fetchedAt time.Time
+}
+
+// tokenRevocationService keeps revocations in memory so that checking a token
+// does not hit the database on every request. The cache is refreshed from the
+// database every RevocationSyncPeriod to pick up revocations made by other
+// instances; revocations made by this instance are visible immediately.
+// Revoked sessions are only kept for as long as access tokens live, since no
+// token is issued to a session after it was revoked.
+type tokenRevocationService struct {
+	repo           repository.TokenRevocationRepository
+	syncPeriod     time.Duration
+	accessTokenTTL time.Duration
+	log            *logger.Logger
+
+	mu              sync.RWMutex
+	revokedTokens   map[string]time.Time
+	revokedSessions map[string]struct{}
+	versions        map[uuid.UUID]cachedTokenVersion
+	lastSync        time.Time
+}
+
+// NewTokenRevocationService creates a new token revocation service
+func NewTokenRevocationService(repo repository.TokenRevocationRepository, cfg *config.AuthConfig, accessTokenTTL time.Duration, log *logger.Logger) TokenRevocationService {
+	return &tokenRevocationService{
+		repo:            repo,
+		syncPeriod:      cfg.RevocationSyncPeriod,
+		accessTokenTTL:  accessTokenTTL,
+		log:             log,
+		revokedTokens:   make(map[string]time.Time),
+		revokedSessions: make(map[string]struct{}),
+		versions:        make(map[uuid.UUID]cachedTokenVersion),
+	}
+}
+
+// Revoke revokes a single access token
+func (s *tokenRevocationService) Revoke(ctx context.Context, claims *jwt.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return ErrInvalidInput
+	}
+
+	err := s.repo.RevokeToken(ctx, &domain.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", claims.UserID.String()).Msg("Failed to revoke token")
+		return err
+	}
+
+	s.mu.Lock()
+	s.revokedTokens[claims.ID] = claims.ExpiresAt.Time
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeAllForUser revokes every access token issued to a user so far
+func (s *tokenRevocationService) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	version, err := s.repo.IncrementTokenVersion(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to revoke user tokens")
+		return err
+	}
+
+	s.mu.Lock()
+	s.versions[userID] = cachedTokenVersion{version: version, fetchedAt: time.Now()}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeSession revokes one of a user's sessions: its refresh tokens and every
+// access token issued in it
+func (s *tokenRevocationService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := s.repo.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrSessionNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Str("session_id", sessionID.String()).Msg("Failed to revoke session")
+		return err
+	}
+
+	s.MarkSessionRevoked(sessionID)
+	return nil
+}
+
+// MarkSessionRevoked refuses the access tokens of a session whose refresh tokens
+// were revoked elsewhere, right away rather than after the next sync
+func (s *tokenRevocationService) MarkSessionRevoked(sessionID uuid.UUID) {
+	s.mu.Lock()
+	s.revokedSessions[sessionID.String()] = struct{}{}
+	s.mu.Unlock()
+}
+
+// IsRevoked reports whether an access token has been revoked
+func (s *tokenRevocationService) IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	if err := s.syncIfStale(ctx); err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	_, tokenRevoked := s.revokedTokens[claims.ID]
+	_, sessionRevoked := s.revokedSessions[claims.SessionID]
+	s.mu.RUnlock()
+	if tokenRevoked || sessionRevoked {
+		return true, nil
+	}
+
+	// Tokens of OAuth clients acting for themselves have no user to version
+	if !claims.HasUser() {
+		return false, nil
+	}
+
+	version, err := s.tokenVersion(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return claims.TokenVersion < version, nil
+}
+
+// syncIfStale reloads revoked tokens from the database once the cache is older than the sync period
+func (s *tokenRevocationService) syncIfStale(ctx context.Context) error {
+	s.mu.RLock()
+	fresh := time.Since(s.lastSync) < s.syncPeriod
+	s.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request may have synced while we waited for the lock
+	if time.Since(s.lastSync) < s.syncPeriod {
+		return nil
+	}
+
+	if err := s.repo.DeleteExpired(ctx); err != nil {
+		s.log.Warn().Err(err).Msg("Failed to delete expired token revocations")
+	}
+
+	tokens, err := s.repo.GetActiveRevokedTokens(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to load revoked tokens")
+		return err
+	}
+
+	revokedTokens := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		revokedTokens[token.JTI] = token.ExpiresAt
+	}
+
+	sessions, err := s.repo.GetRevokedSessions(ctx, time.Now().Add(-s.accessTokenTTL))
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to load revoked sessions")
+		return err
+	}
+
+	revokedSessions := make(map[string]struct{}, len(sessions))
+	for _, id := range sessions {
+		revokedSessions[id.String()] = struct{}{}
+	}
+
+	// Evict stale token versions so the cache does not grow unbounded
+	for userID, cached := range s.versions {
+		if time.Since(cached.fetchedAt) >= s.syncPeriod {
+			delete(s.versions, userID)
+		}
+	}
+
+	s.revokedTokens = revokedTokens
+	s.revokedSessions = revokedSessions
+	s.lastSync = time.Now()
+
+	return nil
+}
+
+// tokenVersion returns the current token version of a user, using the cache when possible
+func (s *tokenRevocationService) tokenVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	s.mu.RLock()
+	cached, ok := s.versions[userID]
+	s.mu.RUnlock()
+	if ok && time.Since(cached.fetchedAt) < s.syncPeriod {
+		return cached.version, nil
+	}
+
+	version, err := s.repo.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.versions[userID] = cachedTokenVersion{version: version, fetchedAt: time.Now()}
+	s.mu.Unlock()
+
+	return version, nil
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/jwt"
+	"go-echo-starter/pkg/logger"
+)
+
+// MockTokenRevocationRepository is a mock implementation of repository.TokenRevocationRepository
+type MockTokenRevocationRepository struct {
+	mock.Mock
+}
+
+func (m *MockTokenRevocationRepository) RevokeToken(ctx context.Context, token *domain.RevokedToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockTokenRevocationRepository) GetActiveRevokedTokens(ctx context.Context) ([]*domain.RevokedToken, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.RevokedToken), args.Error(1)
+}
+
+func (m *MockTokenRevocationRepository) DeleteExpired(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockTokenRevocationRepository) GetTokenVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTokenRevocationRepository) IncrementTokenVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTokenRevocationRepository) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRevocationRepository) GetRevokedSessions(ctx context.Context, since time.Time) ([]uuid.UUID, error) {
+	args := m.Called(ctx, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func newTestClaims(userID uuid.UUID, version int) *jwt.Claims {
+	return &jwt.Claims{
+		UserID:       userID,
+		TokenVersion: version,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestTokenRevocationService_IsRevoked(t *testing.T) {
+	log := logger.New("debug", true)
+	cfg := &config.AuthConfig{RevocationSyncPeriod: time.Minute}
+
+	t.Run("valid token is cached", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil).Once()
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil).Once()
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil).Once()
+		repo.On("GetTokenVersion", mock.Anything, claims.UserID).Return(0, nil).Once()
+
+		for i := 0; i < 3; i++ {
+			revoked, err := svc.IsRevoked(context.Background(), claims)
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+		}
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil)
+		repo.On("GetTokenVersion", mock.Anything, claims.UserID).Return(0, nil)
+		repo.On("RevokeToken", mock.Anything, mock.MatchedBy(func(rt *domain.RevokedToken) bool {
+			return rt.JTI == claims.ID
+		})).Return(nil)
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		assert.NoError(t, svc.Revoke(context.Background(), claims))
+
+		revoked, err = svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("tokens issued before revoke all", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil)
+		repo.On("IncrementTokenVersion", mock.Anything, claims.UserID).Return(1, nil)
+
+		assert.NoError(t, svc.RevokeAllForUser(context.Background(), claims.UserID))
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = svc.IsRevoked(context.Background(), newTestClaims(claims.UserID, 1))
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("tokens of a revoked session", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+		sessionID := uuid.New()
+		claims.SessionID = sessionID.String()
+		other := newTestClaims(claims.UserID, 0)
+		other.SessionID = uuid.NewString()
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil)
+		repo.On("GetTokenVersion", mock.Anything, claims.UserID).Return(0, nil)
+		repo.On("RevokeSession", mock.Anything, claims.UserID, sessionID).Return(nil)
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		assert.NoError(t, svc.RevokeSession(context.Background(), claims.UserID, sessionID))
+
+		revoked, err = svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = svc.IsRevoked(context.Background(), other)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("session whose refresh token family was revoked", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+		sessionID := uuid.New()
+		claims.SessionID = sessionID.String()
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil)
+		repo.On("GetTokenVersion", mock.Anything, claims.UserID).Return(0, nil)
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		svc.MarkSessionRevoked(sessionID)
+
+		revoked, err = svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("session revoked by another instance", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+		sessionID := uuid.New()
+		claims.SessionID = sessionID.String()
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.MatchedBy(func(since time.Time) bool {
+			return time.Since(since) >= 15*time.Minute
+		})).Return([]uuid.UUID{sessionID}, nil)
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+
+		repo.On("RevokeSession", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrNotFound)
+
+		err := svc.RevokeSession(context.Background(), uuid.New(), uuid.New())
+		assert.True(t, errors.Is(err, ErrSessionNotFound))
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.New(), 0)
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil)
+		repo.On("GetTokenVersion", mock.Anything, claims.UserID).Return(0, repository.ErrNotFound)
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("client token without a user", func(t *testing.T) {
+		repo := new(MockTokenRevocationRepository)
+		svc := NewTokenRevocationService(repo, cfg, 15*time.Minute, log)
+		claims := newTestClaims(uuid.Nil, 0)
+		claims.ClientID = uuid.NewString()
+
+		repo.On("DeleteExpired", mock.Anything).Return(nil)
+		repo.On("GetActiveRevokedTokens", mock.Anything).Return([]*domain.RevokedToken{}, nil)
+		repo.On("GetRevokedSessions", mock.Anything, mock.Anything).Return([]uuid.UUID{}, nil)
+
+		revoked, err := svc.IsRevoked(context.Background(), claims)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+		repo.AssertNotCalled(t, "GetTokenVersion", mock.Anything, mock.Anything)
+	})
+}
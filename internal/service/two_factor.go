@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/totp"
+)
+
+// Two-factor authentication errors
+var (
+	ErrInvalidMFAToken         = errors.New("invalid or expired mfa token")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotSetUp       = errors.New("two-factor authentication has not been set up")
+)
+
+const (
+	// totpSkew is the number of time steps a code may be off by, to allow for clock drift
+	totpSkew = 1
+	// recoveryCodeCount is the number of recovery codes handed out on enrollment
+	recoveryCodeCount = 10
+	// recoveryCodeBytes is the entropy of a single recovery code
+	recoveryCodeBytes = 5
+)
+
+// SetupTwoFactor generates a new TOTP secret for the user.
+// The secret is not used for login until it has been confirmed via EnableTwoFactor.
+func (s *authService) SetupTwoFactor(ctx context.Context, userID uuid.UUID) (*domain.TwoFactorSetupResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to get user for two-factor setup")
+		return nil, err
+	}
+
+	if user.IsTwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate totp secret")
+		return nil, err
+	}
+
+	if err := s.twoFactorRepo.SetPendingSecret(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTwoFactorAlreadyEnabled
+		}
+		s.log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to store totp secret")
+		return nil, err
+	}
+
+	return &domain.TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(s.cfg.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor confirms the pending TOTP secret with a code and returns fresh recovery codes
+func (s *authService) EnableTwoFactor(ctx context.Context, userID uuid.UUID, req *domain.TwoFactorCodeRequest) (*domain.TwoFactorEnableResponse, error) {
+	cfg, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.IsEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if cfg.Secret == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	step, ok := totp.Validate(*cfg.Secret, req.Code, s.now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate recovery codes")
+		return nil, err
+	}
+
+	if err := s.twoFactorRepo.Enable(ctx, userID, step, hashes); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTwoFactorNotSetUp
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to enable two-factor authentication")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", userID.String()).Msg("Two-factor authentication enabled")
+
+	return &domain.TwoFactorEnableResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTwoFactor removes the user's TOTP enrollment after checking a TOTP or recovery code
+func (s *authService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, req *domain.TwoFactorCodeRequest) error {
+	cfg, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.IsEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := s.checkSecondFactor(ctx, userID, cfg, req.Code); err != nil {
+		return err
+	}
+
+	if err := s.twoFactorRepo.Disable(ctx, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to disable two-factor authentication")
+		return err
+	}
+
+	s.log.Info().Str("user_id", userID.String()).Msg("Two-factor authentication disabled")
+	return nil
+}
+
+// VerifyTwoFactor exchanges an MFA token and a TOTP or recovery code for a token pair.
+// The MFA token is burned on every attempt, so a wrong code requires logging in again.
+func (s *authService) VerifyTwoFactor(ctx context.Context, req *domain.TwoFactorVerifyRequest) (*domain.TokenResponse, error) {
+	stored, err := s.userTokenRepo.Consume(ctx, domain.TokenPurposeMFAPending, hashToken(req.MFAToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		s.log.Error().Err(err).Msg("Failed to consume mfa token")
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		s.log.Error().Err(err).Str("user_id", stored.UserID.String()).Msg("Failed to get user for two-factor login")
+		return nil, err
+	}
+
+	client := domain.ClientInfoFromContext(ctx)
+	if err := s.loginThrottle.Check(ctx, user.Email, client.IP); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.getTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Two-factor authentication was disabled since the password step
+	if !cfg.IsEnabled() {
+		return nil, ErrInvalidMFAToken
+	}
+
+	if err := s.checkSecondFactor(ctx, user.ID, cfg, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			s.log.Warn().Str("user_id", user.ID.String()).Msg("Invalid two-factor code on login")
+			if err := s.loginThrottle.RecordFailure(ctx, user.Email, client.IP); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.loginThrottle.RecordSuccess(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	scopes, err := grantScopes(user.Role, req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.issueTokens(ctx, user, uuid.New(), scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("User logged in successfully with two-factor authentication")
+
+	return token, nil
+}
+
+// issueMFAToken returns a response asking the client to complete the second login step
+func (s *authService) issueMFAToken(ctx context.Context, user *domain.User) (*domain.TokenResponse, error) {
+	token, err := s.createUserToken(ctx, user.ID, domain.TokenPurposeMFAPending, s.cfg.MFATokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", user.ID.String()).Msg("Password accepted, awaiting second factor")
+
+	return &domain.TokenResponse{
+		ExpiresIn:   int64(s.cfg.MFATokenTTL.Seconds()),
+		MFARequired: true,
+		MFAToken:    token,
+	}, nil
+}
+
+// getTOTP gets the TOTP enrollment of a user
+func (s *authService) getTOTP(ctx context.Context, userID uuid.UUID) (*domain.TOTPConfig, error) {
+	cfg, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to get totp configuration")
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code.
+// Each TOTP time step and each recovery code can only be used once.
+func (s *authService) checkSecondFactor(ctx context.Context, userID uuid.UUID, cfg *domain.TOTPConfig, code string) error {
+	code = strings.TrimSpace(code)
+
+	var err error
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(*cfg.Secret, code, s.now(), totpSkew)
+		if !ok || step <= cfg.LastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		err = s.twoFactorRepo.UseStep(ctx, userID, step)
+	} else {
+		err = s.twoFactorRepo.ConsumeRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidTwoFactorCode
+		}
+		s.log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to record second factor use")
+		return err
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns new recovery codes together with their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := hex.EncodeToString(b)
+		codes[i] = raw[:len(raw)/2] + "-" + raw[len(raw)/2:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips separators and case so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
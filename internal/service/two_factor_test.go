@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/totp"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestAuthServiceAt creates an auth service backed by fresh mocks whose clock is frozen at now
+func newTestAuthServiceAt(now time.Time) (AuthService, *authServiceMocks) {
+	svc, m := newTestAuthService()
+	svc.(*authService).now = func() time.Time { return now }
+	return svc, m
+}
+
+// enabledTOTP returns an enabled TOTP enrollment using the test secret
+func enabledTOTP(lastStep int64) *domain.TOTPConfig {
+	secret := testTOTPSecret
+	enabledAt := testNow.Add(-time.Hour)
+	return &domain.TOTPConfig{Secret: &secret, EnabledAt: &enabledAt, LastStep: lastStep}
+}
+
+func mustCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totp.Code(testTOTPSecret, at)
+	assert.NoError(t, err)
+	return code
+}
+
+func TestAuthService_Login_TwoFactor(t *testing.T) {
+	svc, m := newTestAuthServiceAt(testNow)
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	enabledAt := testNow
+	user := &domain.User{ID: uuid.New(), Email: "test@example.com", Password: string(hashedPassword), TOTPEnabledAt: &enabledAt}
+
+	m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+	m.users.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+	m.userTokens.On("Create", mock.Anything, mock.MatchedBy(func(ut *domain.UserToken) bool {
+		return ut.UserID == user.ID && ut.Purpose == domain.TokenPurposeMFAPending && ut.ExpiresAt.Equal(testNow.Add(5*time.Minute))
+	})).Return(nil)
+
+	res, err := svc.Login(context.Background(), &domain.LoginRequest{Email: user.Email, Password: "password123"})
+
+	assert.NoError(t, err)
+	assert.True(t, res.MFARequired)
+	assert.NotEmpty(t, res.MFAToken)
+	assert.Empty(t, res.AccessToken)
+	assert.Empty(t, res.RefreshToken)
+	m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	m.loginThrottle.AssertNotCalled(t, "RecordSuccess", mock.Anything, mock.Anything)
+	m.userTokens.AssertExpectations(t)
+}
+
+func TestAuthService_SetupTwoFactor(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		user := &domain.User{ID: uuid.New(), Email: "admin@example.com"}
+
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.twoFactor.On("SetPendingSecret", mock.Anything, user.ID, mock.AnythingOfType("string")).Return(nil)
+
+		res, err := svc.SetupTwoFactor(context.Background(), user.ID)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.Secret)
+		assert.True(t, strings.HasPrefix(res.OTPAuthURI, "otpauth://totp/"))
+		assert.Contains(t, res.OTPAuthURI, "secret="+res.Secret)
+		m.twoFactor.AssertExpectations(t)
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		enabledAt := testNow
+		user := &domain.User{ID: uuid.New(), TOTPEnabledAt: &enabledAt}
+
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := svc.SetupTwoFactor(context.Background(), user.ID)
+
+		assert.ErrorIs(t, err, ErrTwoFactorAlreadyEnabled)
+		m.twoFactor.AssertNotCalled(t, "SetPendingSecret", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_EnableTwoFactor(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		userID := uuid.New()
+		secret := testTOTPSecret
+
+		m.twoFactor.On("GetTOTP", mock.Anything, userID).Return(&domain.TOTPConfig{Secret: &secret}, nil)
+		m.twoFactor.On("Enable", mock.Anything, userID, totp.Step(testNow), mock.MatchedBy(func(hashes []string) bool {
+			return len(hashes) == recoveryCodeCount
+		})).Return(nil)
+
+		res, err := svc.EnableTwoFactor(context.Background(), userID, &domain.TwoFactorCodeRequest{Code: mustCode(t, testNow)})
+
+		assert.NoError(t, err)
+		assert.Len(t, res.RecoveryCodes, recoveryCodeCount)
+		m.twoFactor.AssertExpectations(t)
+	})
+
+	t.Run("code from previous step within skew", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		userID := uuid.New()
+		secret := testTOTPSecret
+		previous := testNow.Add(-totp.Period)
+
+		m.twoFactor.On("GetTOTP", mock.Anything, userID).Return(&domain.TOTPConfig{Secret: &secret}, nil)
+		m.twoFactor.On("Enable", mock.Anything, userID, totp.Step(previous), mock.Anything).Return(nil)
+
+		_, err := svc.EnableTwoFactor(context.Background(), userID, &domain.TwoFactorCodeRequest{Code: mustCode(t, previous)})
+
+		assert.NoError(t, err)
+		m.twoFactor.AssertExpectations(t)
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		userID := uuid.New()
+		secret := testTOTPSecret
+
+		m.twoFactor.On("GetTOTP", mock.Anything, userID).Return(&domain.TOTPConfig{Secret: &secret}, nil)
+
+		_, err := svc.EnableTwoFactor(context.Background(), userID, &domain.TwoFactorCodeRequest{Code: mustCode(t, testNow.Add(5*time.Minute))})
+
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+		m.twoFactor.AssertNotCalled(t, "Enable", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("not set up", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		userID := uuid.New()
+
+		m.twoFactor.On("GetTOTP", mock.Anything, userID).Return(&domain.TOTPConfig{}, nil)
+
+		_, err := svc.EnableTwoFactor(context.Background(), userID, &domain.TwoFactorCodeRequest{Code: "123456"})
+
+		assert.ErrorIs(t, err, ErrTwoFactorNotSetUp)
+	})
+}
+
+func TestAuthService_DisableTwoFactor(t *testing.T) {
+	t.Run("with recovery code", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		userID := uuid.New()
+
+		m.twoFactor.On("GetTOTP", mock.Anything, userID).Return(enabledTOTP(0), nil)
+		m.twoFactor.On("ConsumeRecoveryCode", mock.Anything, userID, hashToken("abcde12345")).Return(nil)
+		m.twoFactor.On("Disable", mock.Anything, userID).Return(nil)
+
+		err := svc.DisableTwoFactor(context.Background(), userID, &domain.TwoFactorCodeRequest{Code: "ABCDE-12345"})
+
+		assert.NoError(t, err)
+		m.twoFactor.AssertExpectations(t)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		userID := uuid.New()
+
+		m.twoFactor.On("GetTOTP", mock.Anything, userID).Return(&domain.TOTPConfig{}, nil)
+
+		err := svc.DisableTwoFactor(context.Background(), userID, &domain.TwoFactorCodeRequest{Code: "123456"})
+
+		assert.ErrorIs(t, err, ErrTwoFactorNotEnabled)
+	})
+}
+
+func TestAuthService_VerifyTwoFactor(t *testing.T) {
+	mfaToken := "mfa-token"
+	newUser := func() *domain.User {
+		enabledAt := testNow
+		return &domain.User{ID: uuid.New(), Email: "admin@example.com", Role: domain.RoleAdmin, TOTPEnabledAt: &enabledAt}
+	}
+
+	t.Run("success with totp code", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		user := newUser()
+
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMFAPending, hashToken(mfaToken)).
+			Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.twoFactor.On("GetTOTP", mock.Anything, user.ID).Return(enabledTOTP(0), nil)
+		m.twoFactor.On("UseStep", mock.Anything, user.ID, totp.Step(testNow)).Return(nil)
+		m.loginThrottle.On("RecordSuccess", mock.Anything, user.Email).Return(nil)
+		m.refreshTokens.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		res, err := svc.VerifyTwoFactor(context.Background(), &domain.TwoFactorVerifyRequest{
+			MFAToken: mfaToken,
+			Code:     mustCode(t, testNow),
+			Scopes:   []string{"users:read"},
+		})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.AccessToken)
+		assert.NotEmpty(t, res.RefreshToken)
+		assert.Equal(t, "users:read", res.Scope)
+		m.twoFactor.AssertExpectations(t)
+	})
+
+	t.Run("replayed totp code", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		user := newUser()
+
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMFAPending, hashToken(mfaToken)).
+			Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.twoFactor.On("GetTOTP", mock.Anything, user.ID).Return(enabledTOTP(totp.Step(testNow)), nil)
+		m.loginThrottle.On("RecordFailure", mock.Anything, user.Email, "").Return(nil)
+
+		_, err := svc.VerifyTwoFactor(context.Background(), &domain.TwoFactorVerifyRequest{MFAToken: mfaToken, Code: mustCode(t, testNow)})
+
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+		m.twoFactor.AssertNotCalled(t, "UseStep", mock.Anything, mock.Anything, mock.Anything)
+		m.refreshTokens.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("expired totp code", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		user := newUser()
+
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMFAPending, hashToken(mfaToken)).
+			Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.twoFactor.On("GetTOTP", mock.Anything, user.ID).Return(enabledTOTP(0), nil)
+		m.loginThrottle.On("RecordFailure", mock.Anything, user.Email, "").Return(nil)
+
+		_, err := svc.VerifyTwoFactor(context.Background(), &domain.TwoFactorVerifyRequest{
+			MFAToken: mfaToken,
+			Code:     mustCode(t, testNow.Add(-2*time.Minute)),
+		})
+
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("used recovery code", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+		user := newUser()
+
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMFAPending, hashToken(mfaToken)).
+			Return(&domain.UserToken{UserID: user.ID}, nil)
+		m.users.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		m.loginThrottle.On("Check", mock.Anything, user.Email, "").Return(nil)
+		m.twoFactor.On("GetTOTP", mock.Anything, user.ID).Return(enabledTOTP(0), nil)
+		m.twoFactor.On("ConsumeRecoveryCode", mock.Anything, user.ID, hashToken("abcde12345")).Return(repository.ErrNotFound)
+		m.loginThrottle.On("RecordFailure", mock.Anything, user.Email, "").Return(nil)
+
+		_, err := svc.VerifyTwoFactor(context.Background(), &domain.TwoFactorVerifyRequest{MFAToken: mfaToken, Code: "abcde-12345"})
+
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("invalid mfa token", func(t *testing.T) {
+		svc, m := newTestAuthServiceAt(testNow)
+
+		m.userTokens.On("Consume", mock.Anything, domain.TokenPurposeMFAPending, hashToken(mfaToken)).
+			Return(nil, repository.ErrNotFound)
+
+		_, err := svc.VerifyTwoFactor(context.Background(), &domain.TwoFactorVerifyRequest{MFAToken: mfaToken, Code: "123456"})
+
+		assert.ErrorIs(t, err, ErrInvalidMFAToken)
+	})
+}
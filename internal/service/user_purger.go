@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/repository"
+	"go-echo-starter/pkg/logger"
+)
+
+// UserPurger defines the interface for permanently deleting users once their retention period is over
+type UserPurger interface {
+	Run(ctx context.Context)
+	Purge(ctx context.Context) (int64, error)
+}
+
+// userPurger hard-deletes users that have been soft-deleted for longer than
+// the retention period. Purging is idempotent, so every instance may run it.
+type userPurger struct {
+	userRepo  repository.UserRepository
+	retention time.Duration
+	interval  time.Duration
+	log       *logger.Logger
+	now       func() time.Time
+}
+
+// NewUserPurger creates a new user purger
+func NewUserPurger(userRepo repository.UserRepository, cfg *config.UserConfig, log *logger.Logger) UserPurger {
+	return &userPurger{
+		userRepo:  userRepo,
+		retention: cfg.DeletedRetention,
+		interval:  cfg.PurgeInterval,
+		log:       log,
+		now:       time.Now,
+	}
+}
+
+// Run purges deleted users right away and then every interval until ctx is done.
+// It returns immediately when no retention period is configured.
+func (p *userPurger) Run(ctx context.Context) {
+	if p.retention <= 0 || p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		// Failures are logged by Purge and retried on the next tick
+		p.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge permanently deletes the users deleted longer than the retention period ago
+func (p *userPurger) Purge(ctx context.Context) (int64, error) {
+	purged, err := p.userRepo.PurgeDeleted(ctx, p.now().Add(-p.retention))
+	if err != nil {
+		p.log.Error().Err(err).Msg("Failed to purge deleted users")
+		return 0, err
+	}
+
+	if purged > 0 {
+		p.log.Info().Int64("count", purged).Msg("Deleted users purged")
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/pkg/logger"
+)
+
+func TestUserPurger_Purge(t *testing.T) {
+	log := logger.New("debug", true)
+	cfg := &config.UserConfig{DeletedRetention: 30 * 24 * time.Hour, PurgeInterval: time.Hour}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("purges users deleted before the retention period", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		p := NewUserPurger(repo, cfg, log).(*userPurger)
+		p.now = func() time.Time { return now }
+
+		repo.On("PurgeDeleted", mock.Anything, now.Add(-30*24*time.Hour)).Return(int64(2), nil)
+
+		purged, err := p.Purge(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		p := NewUserPurger(repo, cfg, log)
+
+		repo.On("PurgeDeleted", mock.Anything, mock.Anything).Return(int64(0), errors.New("db down"))
+
+		_, err := p.Purge(context.Background())
+
+		assert.Error(t, err)
+	})
+}
+
+func TestUserPurger_Run(t *testing.T) {
+	log := logger.New("debug", true)
+
+	t.Run("purges until cancelled", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		p := NewUserPurger(repo, &config.UserConfig{DeletedRetention: time.Hour, PurgeInterval: time.Hour}, log)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		repo.On("PurgeDeleted", mock.Anything, mock.Anything).Return(int64(0), nil).Run(func(mock.Arguments) { cancel() })
+
+		p.Run(ctx)
+
+		repo.AssertNumberOfCalls(t, "PurgeDeleted", 1)
+	})
+
+	t.Run("disabled without retention", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		p := NewUserPurger(repo, &config.UserConfig{PurgeInterval: time.Hour}, log)
+
+		p.Run(context.Background())
+
+		repo.AssertNotCalled(t, "PurgeDeleted", mock.Anything, mock.Anything)
+	})
+}
@@ -13,21 +13,36 @@ import (
 
 // Common errors
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrEmailExists  = errors.New("email already exists")
-	ErrInvalidInput = errors.New("invalid input")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrEmailExists   = errors.New("email already exists")
+	ErrInvalidInput  = errors.New("invalid input")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrUserModified  = errors.New("user modified concurrently")
 )
 
+// maxPatchAttempts is how many times a patch is applied when the user keeps
+// being modified concurrently
+const maxPatchAttempts = 3
+
 type userService struct {
-	userRepo repository.UserRepository
-	log      *logger.Logger
+	userRepo         repository.UserRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	loginThrottle    LoginThrottleService
+	log              *logger.Logger
 }
 
 // NewUserService creates a new user service
-func NewUserService(userRepo repository.UserRepository, log *logger.Logger) UserService {
+func NewUserService(
+	userRepo repository.UserRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	loginThrottle LoginThrottleService,
+	log *logger.Logger,
+) UserService {
 	return &userService{
-		userRepo: userRepo,
-		log:      log,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		loginThrottle:    loginThrottle,
+		log:              log,
 	}
 }
 
@@ -36,6 +51,10 @@ func (s *userService) Create(ctx context.Context, req *domain.CreateUserRequest)
 	user := &domain.User{
 		Name:  req.Name,
 		Email: req.Email,
+		Role:  req.Role,
+	}
+	if user.Role == "" {
+		user.Role = domain.RoleUser
 	}
 
 	err := s.userRepo.Create(ctx, user)
@@ -66,12 +85,12 @@ func (s *userService) GetByID(ctx context.Context, id uuid.UUID) (*domain.UserRe
 	return user.ToResponse(), nil
 }
 
-// GetAll gets all users
-func (s *userService) GetAll(ctx context.Context) ([]*domain.UserResponse, error) {
-	users, err := s.userRepo.GetAll(ctx)
+// GetAll gets a page of users, along with the total number of users matching the filters
+func (s *userService) GetAll(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.UserResponse, int, error) {
+	users, total, err := s.userRepo.GetAll(ctx, req)
 	if err != nil {
 		s.log.Error().Err(err).Msg("Failed to get users")
-		return nil, err
+		return nil, 0, err
 	}
 
 	responses := make([]*domain.UserResponse, len(users))
@@ -79,43 +98,144 @@ func (s *userService) GetAll(ctx context.Context) ([]*domain.UserResponse, error
 		responses[i] = user.ToResponse()
 	}
 
+	return responses, total, nil
+}
+
+// GetAllByCursor gets the page of users at the cursor of req, along with the cursors to the neighbouring pages
+func (s *userService) GetAllByCursor(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.UserResponse, *domain.CursorPage, error) {
+	users, page, err := s.userRepo.GetAllByCursor(ctx, req)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return nil, nil, ErrInvalidCursor
+		}
+		s.log.Error().Err(err).Msg("Failed to get users")
+		return nil, nil, err
+	}
+
+	responses := make([]*domain.UserResponse, len(users))
+	for i, user := range users {
+		responses[i] = user.ToResponse()
+	}
+
+	return responses, page, nil
+}
+
+// Search gets the users best matching a search, best match first
+func (s *userService) Search(ctx context.Context, req *domain.SearchUsersRequest) ([]*domain.UserSearchResponse, error) {
+	results, err := s.userRepo.Search(ctx, req)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to search users")
+		return nil, err
+	}
+
+	responses := make([]*domain.UserSearchResponse, len(results))
+	for i, result := range results {
+		responses[i] = result.ToResponse()
+	}
+
 	return responses, nil
 }
 
-// Update updates a user
+// Update updates a user, leaving empty fields of req unchanged
 func (s *userService) Update(ctx context.Context, id uuid.UUID, req *domain.UpdateUserRequest) (*domain.UserResponse, error) {
-	// Get existing user
-	user, err := s.userRepo.GetByID(ctx, id)
+	return s.Patch(ctx, id, func(*domain.UserDocument) (*domain.UserPatch, error) {
+		return req.Patch(), nil
+	})
+}
+
+// Patch changes a user as apply computes from its current document. The changes
+// are only saved if the user is unchanged since apply saw it; otherwise apply runs
+// again on the new state, so it never overwrites changes it did not see.
+// Errors returned by apply are returned as is.
+func (s *userService) Patch(ctx context.Context, id uuid.UUID, apply domain.UserPatchFunc) (*domain.UserResponse, error) {
+	for attempt := 1; ; attempt++ {
+		user, err := s.userRepo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrUserNotFound
+			}
+			s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to get user for update")
+			return nil, err
+		}
+
+		patch, err := apply(user.Document())
+		if err != nil {
+			return nil, err
+		}
+
+		if patch.Name != nil {
+			user.Name = *patch.Name
+		}
+		if patch.Email != nil {
+			user.Email = *patch.Email
+		}
+
+		err = s.userRepo.Update(ctx, user)
+		if err != nil {
+			if errors.Is(err, repository.ErrModified) {
+				if attempt < maxPatchAttempts {
+					continue
+				}
+				s.log.Warn().Str("user_id", id.String()).Msg("User kept changing during update")
+				return nil, ErrUserModified
+			}
+			if errors.Is(err, repository.ErrDuplicateEmail) {
+				return nil, ErrEmailExists
+			}
+			s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to update user")
+			return nil, err
+		}
+
+		s.log.Info().Str("user_id", id.String()).Msg("User updated successfully")
+		return user.ToResponse(), nil
+	}
+}
+
+// UpdateRole changes the role of a user
+func (s *userService) UpdateRole(ctx context.Context, id uuid.UUID, req *domain.UpdateRoleRequest) (*domain.UserResponse, error) {
+	err := s.userRepo.UpdateRole(ctx, id, req.Role)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, ErrUserNotFound
 		}
-		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to get user for update")
+		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to update user role")
 		return nil, err
 	}
 
-	// Update fields if provided
-	if req.Name != "" {
-		user.Name = req.Name
-	}
-	if req.Email != "" {
-		user.Email = req.Email
-	}
-
-	err = s.userRepo.Update(ctx, user)
+	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
-		if errors.Is(err, repository.ErrDuplicateEmail) {
-			return nil, ErrEmailExists
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
 		}
-		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to update user")
+		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to get user after role update")
 		return nil, err
 	}
 
-	s.log.Info().Str("user_id", id.String()).Msg("User updated successfully")
+	s.log.Info().Str("user_id", id.String()).Str("role", string(req.Role)).Msg("User role updated successfully")
 	return user.ToResponse(), nil
 }
 
-// Delete deletes a user
+// Unlock lifts a login lockout of a user
+func (s *userService) Unlock(ctx context.Context, id uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to get user for unlock")
+		return err
+	}
+
+	if err := s.loginThrottle.Unlock(ctx, user.Email); err != nil {
+		return err
+	}
+
+	s.log.Info().Str("user_id", id.String()).Msg("User unlocked successfully")
+	return nil
+}
+
+// Delete deletes a user.
+// Their sessions are revoked as well, so a restored user has to log in again.
 func (s *userService) Delete(ctx context.Context, id uuid.UUID) error {
 	err := s.userRepo.Delete(ctx, id)
 	if err != nil {
@@ -126,6 +246,35 @@ func (s *userService) Delete(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, id); err != nil {
+		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to revoke refresh tokens")
+		return err
+	}
+
 	s.log.Info().Str("user_id", id.String()).Msg("User deleted successfully")
 	return nil
 }
+
+// Restore restores a deleted user
+func (s *userService) Restore(ctx context.Context, id uuid.UUID) (*domain.UserResponse, error) {
+	err := s.userRepo.Restore(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return nil, ErrEmailExists
+		}
+		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to restore user")
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		s.log.Error().Err(err).Str("user_id", id.String()).Msg("Failed to get restored user")
+		return nil, err
+	}
+
+	s.log.Info().Str("user_id", id.String()).Msg("User restored successfully")
+	return user.ToResponse(), nil
+}
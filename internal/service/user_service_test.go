@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"go-echo-starter/internal/domain"
 	"go-echo-starter/internal/repository"
@@ -40,12 +41,28 @@ func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*dom
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
-func (m *MockUserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
-	args := m.Called(ctx)
+func (m *MockUserRepository) GetAll(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.User, int, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]*domain.User), args.Int(1), args.Error(2)
+}
+
+func (m *MockUserRepository) GetAllByCursor(ctx context.Context, req *domain.ListUsersRequest) ([]*domain.User, *domain.CursorPage, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).([]*domain.User), args.Get(1).(*domain.CursorPage), args.Error(2)
+}
+
+func (m *MockUserRepository) Search(ctx context.Context, req *domain.SearchUsersRequest) ([]*domain.UserSearchResult, error) {
+	args := m.Called(ctx, req)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]*domain.User), args.Error(1)
+	return args.Get(0).([]*domain.UserSearchResult), args.Error(1)
 }
 
 func (m *MockUserRepository) Update(ctx context.Context, user *domain.User) error {
@@ -53,17 +70,42 @@ func (m *MockUserRepository) Update(ctx context.Context, user *domain.User) erro
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role domain.Role) error {
+	args := m.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, password string) error {
+	args := m.Called(ctx, id, password)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
 func (m *MockUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func TestUserService_Create(t *testing.T) {
 	log := logger.New("debug", true)
 
 	t.Run("success", func(t *testing.T) {
 		repo := new(MockUserRepository)
-		svc := NewUserService(repo, log)
+		svc := NewUserService(repo, nil, nil, log)
 
 		req := &domain.CreateUserRequest{
 			Name:  "Test User",
@@ -71,7 +113,7 @@ func TestUserService_Create(t *testing.T) {
 		}
 
 		repo.On("Create", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
-			return u.Name == req.Name && u.Email == req.Email
+			return u.Name == req.Name && u.Email == req.Email && u.Role == domain.RoleUser
 		})).Return(nil)
 
 		res, err := svc.Create(context.Background(), req)
@@ -85,7 +127,7 @@ func TestUserService_Create(t *testing.T) {
 
 	t.Run("duplicate email", func(t *testing.T) {
 		repo := new(MockUserRepository)
-		svc := NewUserService(repo, log)
+		svc := NewUserService(repo, nil, nil, log)
 
 		req := &domain.CreateUserRequest{
 			Name:  "Test User",
@@ -102,3 +144,215 @@ func TestUserService_Create(t *testing.T) {
 		repo.AssertExpectations(t)
 	})
 }
+
+// patchWith returns a patch function making the given changes
+func patchWith(patch *domain.UserPatch) domain.UserPatchFunc {
+	return func(*domain.UserDocument) (*domain.UserPatch, error) {
+		return patch, nil
+	}
+}
+
+func TestUserService_Patch(t *testing.T) {
+	log := logger.New("debug", true)
+
+	t.Run("leaves unset fields unchanged", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		name := "Jane Doe"
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id, Name: "John Doe", Email: "john@example.com"}, nil)
+		repo.On("Update", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+			return u.Name == "Jane Doe" && u.Email == "john@example.com"
+		})).Return(nil)
+
+		res, err := svc.Patch(context.Background(), id, patchWith(&domain.UserPatch{Name: &name}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Jane Doe", res.Name)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("reapplied when the user changed since it was read", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id, Name: "John Doe", Email: "john@example.com"}, nil).Once()
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id, Name: "John Doe", Email: "johnny@example.com"}, nil).Once()
+		repo.On("Update", mock.Anything, mock.Anything).Return(repository.ErrModified).Once()
+		repo.On("Update", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+			return u.Name == "Jane Doe" && u.Email == "johnny@example.com"
+		})).Return(nil).Once()
+
+		var seen []string
+		res, err := svc.Patch(context.Background(), id, func(current *domain.UserDocument) (*domain.UserPatch, error) {
+			seen = append(seen, current.Email)
+			name := "Jane Doe"
+			return &domain.UserPatch{Name: &name}, nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "johnny@example.com", res.Email)
+		assert.Equal(t, []string{"john@example.com", "johnny@example.com"}, seen)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("user keeps changing", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id}, nil)
+		repo.On("Update", mock.Anything, mock.Anything).Return(repository.ErrModified)
+
+		res, err := svc.Patch(context.Background(), id, patchWith(&domain.UserPatch{}))
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrUserModified))
+		repo.AssertNumberOfCalls(t, "Update", maxPatchAttempts)
+	})
+
+	t.Run("patch rejected", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		rejected := errors.New("rejected")
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id}, nil)
+
+		res, err := svc.Patch(context.Background(), id, func(*domain.UserDocument) (*domain.UserPatch, error) {
+			return nil, rejected
+		})
+
+		assert.Nil(t, res)
+		assert.Equal(t, rejected, err)
+		repo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+
+	t.Run("duplicate email", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		email := "taken@example.com"
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id}, nil)
+		repo.On("Update", mock.Anything, mock.Anything).Return(repository.ErrDuplicateEmail)
+
+		res, err := svc.Patch(context.Background(), id, patchWith(&domain.UserPatch{Email: &email}))
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrEmailExists))
+	})
+}
+
+func TestUserService_UpdateRole(t *testing.T) {
+	log := logger.New("debug", true)
+
+	t.Run("success", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		repo.On("UpdateRole", mock.Anything, id, domain.RoleAdmin).Return(nil)
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id, Role: domain.RoleAdmin}, nil)
+
+		res, err := svc.UpdateRole(context.Background(), id, &domain.UpdateRoleRequest{Role: domain.RoleAdmin})
+
+		assert.NoError(t, err)
+		assert.Equal(t, domain.RoleAdmin, res.Role)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		repo.On("UpdateRole", mock.Anything, id, domain.RoleAdmin).Return(repository.ErrNotFound)
+
+		res, err := svc.UpdateRole(context.Background(), id, &domain.UpdateRoleRequest{Role: domain.RoleAdmin})
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestUserService_Delete(t *testing.T) {
+	log := logger.New("debug", true)
+
+	t.Run("revokes the sessions of the user", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		refreshTokens := new(MockRefreshTokenRepository)
+		svc := NewUserService(repo, refreshTokens, nil, log)
+
+		id := uuid.New()
+		repo.On("Delete", mock.Anything, id).Return(nil)
+		refreshTokens.On("RevokeAllForUser", mock.Anything, id).Return(nil)
+
+		err := svc.Delete(context.Background(), id)
+
+		assert.NoError(t, err)
+		repo.AssertExpectations(t)
+		refreshTokens.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		refreshTokens := new(MockRefreshTokenRepository)
+		svc := NewUserService(repo, refreshTokens, nil, log)
+
+		repo.On("Delete", mock.Anything, mock.Anything).Return(repository.ErrNotFound)
+
+		err := svc.Delete(context.Background(), uuid.New())
+
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		refreshTokens.AssertNotCalled(t, "RevokeAllForUser", mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserService_Restore(t *testing.T) {
+	log := logger.New("debug", true)
+
+	t.Run("success", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		id := uuid.New()
+		repo.On("Restore", mock.Anything, id).Return(nil)
+		repo.On("GetByID", mock.Anything, id).Return(&domain.User{ID: id}, nil)
+
+		res, err := svc.Restore(context.Background(), id)
+
+		assert.NoError(t, err)
+		assert.Equal(t, id, res.ID)
+		assert.Nil(t, res.DeletedAt)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("not deleted", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		repo.On("Restore", mock.Anything, mock.Anything).Return(repository.ErrNotFound)
+
+		res, err := svc.Restore(context.Background(), uuid.New())
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("email taken since", func(t *testing.T) {
+		repo := new(MockUserRepository)
+		svc := NewUserService(repo, nil, nil, log)
+
+		repo.On("Restore", mock.Anything, mock.Anything).Return(repository.ErrDuplicateEmail)
+
+		res, err := svc.Restore(context.Background(), uuid.New())
+
+		assert.Nil(t, res)
+		assert.True(t, errors.Is(err, ErrEmailExists))
+		repo.AssertNotCalled(t, "GetByID", mock.Anything, mock.Anything)
+	})
+}
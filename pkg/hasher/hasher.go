@@ -0,0 +1,90 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-echo-starter/internal/config"
+)
+
+// Supported algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var (
+	// ErrPasswordTooLong is returned when a password exceeds what the algorithm can hash
+	ErrPasswordTooLong = errors.New("password is too long")
+	// ErrUnknownHash is returned when an encoded hash was not produced by a supported algorithm
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// PasswordHasher hashes and verifies passwords.
+// Hashes are self-describing PHC-style strings, so hashes of different
+// algorithms and parameters can coexist in the same column.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether the encoded hash uses an outdated algorithm or weaker parameters
+	NeedsRehash(encoded string) bool
+}
+
+// algorithm is a single hashing scheme within a Hasher
+type algorithm interface {
+	PasswordHasher
+	// owns reports whether the encoded hash was produced by this algorithm
+	owns(encoded string) bool
+}
+
+// Hasher hashes new passwords with its configured algorithm and verifies
+// hashes produced by any supported algorithm
+type Hasher struct {
+	current    algorithm
+	algorithms []algorithm
+}
+
+// New creates a hasher for the configured algorithm
+func New(cfg *config.PasswordConfig) (*Hasher, error) {
+	bcryptHasher := NewBcrypt(cfg.BcryptCost)
+	argon2Hasher := NewArgon2id(cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+
+	h := &Hasher{algorithms: []algorithm{bcryptHasher, argon2Hasher}}
+	switch strings.ToLower(cfg.Algorithm) {
+	case AlgorithmBcrypt:
+		h.current = bcryptHasher
+	case AlgorithmArgon2id:
+		h.current = argon2Hasher
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", cfg.Algorithm)
+	}
+
+	return h, nil
+}
+
+// Hash hashes a password with the configured algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify checks a password against a hash produced by any supported algorithm
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	for _, a := range h.algorithms {
+		if a.owns(encoded) {
+			return a.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether a hash was produced by another algorithm
+// or with weaker parameters than the configured ones
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	if !h.current.owns(encoded) {
+		return true
+	}
+	return h.current.NeedsRehash(encoded)
+}
@@ -0,0 +1,86 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"go-echo-starter/internal/config"
+)
+
+var testArgon2Config = &config.PasswordConfig{
+	Algorithm:         AlgorithmArgon2id,
+	BcryptCost:        bcrypt.MinCost,
+	Argon2Memory:      1024,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+}
+
+func TestArgon2id(t *testing.T) {
+	h := NewArgon2id(1024, 1, 1)
+
+	encoded, err := h.Hash("correct horse battery staple")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, err := h.Verify("correct horse battery staple", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify("wrong", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	other, _ := h.Hash("correct horse battery staple")
+	assert.NotEqual(t, encoded, other, "salt must be random")
+
+	_, err = h.Verify("x", "$argon2id$v=19$m=1024$broken")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestBcrypt_RejectsLongPasswords(t *testing.T) {
+	_, err := NewBcrypt(bcrypt.MinCost).Hash(strings.Repeat("a", 73))
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+}
+
+func TestHasher_VerifiesAnyAlgorithm(t *testing.T) {
+	h, err := New(testArgon2Config)
+	assert.NoError(t, err)
+
+	bcryptHash, _ := NewBcrypt(bcrypt.MinCost).Hash("password123")
+	argon2Hash, _ := h.Hash("password123")
+
+	for _, encoded := range []string{bcryptHash, argon2Hash} {
+		ok, err := h.Verify("password123", encoded)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	_, err = h.Verify("password123", "plaintext")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	h, _ := New(testArgon2Config)
+
+	bcryptHash, _ := NewBcrypt(bcrypt.MinCost).Hash("password123")
+	weakArgon2, _ := NewArgon2id(512, 1, 1).Hash("password123")
+	current, _ := h.Hash("password123")
+	stronger, _ := NewArgon2id(2048, 2, 1).Hash("password123")
+
+	assert.True(t, h.NeedsRehash(bcryptHash), "other algorithm")
+	assert.True(t, h.NeedsRehash(weakArgon2), "weaker parameters")
+	assert.False(t, h.NeedsRehash(current))
+	assert.False(t, h.NeedsRehash(stronger))
+
+	b, _ := New(&config.PasswordConfig{Algorithm: AlgorithmBcrypt, BcryptCost: 5})
+	assert.True(t, b.NeedsRehash(bcryptHash), "lower cost")
+	assert.True(t, b.NeedsRehash(current), "other algorithm")
+}
+
+func TestNew_UnknownAlgorithm(t *testing.T) {
+	_, err := New(&config.PasswordConfig{Algorithm: "md5"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// RFC 7396 Appendix A test cases
+	cases := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range cases {
+		patched, err := MergePatch([]byte(tc.doc), []byte(tc.patch))
+		assert.NoError(t, err, tc.patch)
+		assert.JSONEq(t, tc.expected, string(patched), tc.patch)
+	}
+
+	t.Run("malformed patch", func(t *testing.T) {
+		_, err := MergePatch([]byte(`{}`), []byte(`{"a":`))
+		assert.True(t, errors.Is(err, ErrInvalidPatch))
+	})
+}
+
+func TestApply(t *testing.T) {
+	// Examples from RFC 6902 Appendix A
+	cases := []struct {
+		name, doc, patch, expected string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append to array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":{"bar":1},"baz":{"bar":1}}`},
+		{"test then replace", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"replace","path":"/baz","value":null}]`, `{"baz":null}`},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`, `{"m~n":3}`},
+		{"replace document", `{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			patched, err := Apply([]byte(tc.doc), []byte(tc.patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.expected, string(patched))
+		})
+	}
+
+	t.Run("failed test", func(t *testing.T) {
+		_, err := Apply([]byte(`{"baz":"qux","foo":["a",2,"c"]}`), []byte(`[{"op":"test","path":"/baz","value":"bar"}]`))
+		assert.True(t, errors.Is(err, ErrTestFailed))
+	})
+
+	t.Run("invalid patches", func(t *testing.T) {
+		for _, patch := range []string{
+			`{"op":"add","path":"/a","value":1}`,
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			`[{"op":"remove","path":"/missing"}]`,
+			`[{"op":"add","path":"/foo"}]`,
+			`[{"op":"add","path":"foo","value":1}]`,
+			`[{"op":"add","path":"/list/5","value":1}]`,
+			`[{"op":"add","path":"/list/01","value":1}]`,
+			`[{"op":"move","from":"/foo","path":"/foo/bar"}]`,
+			`[{"op":"frobnicate","path":"/foo"}]`,
+		} {
+			_, err := Apply([]byte(`{"foo":{},"list":[1]}`), []byte(patch))
+			assert.True(t, errors.Is(err, ErrInvalidPatch), patch)
+		}
+	})
+
+	t.Run("failed patch leaves nothing half applied", func(t *testing.T) {
+		doc := []byte(`{"a":1}`)
+
+		_, err := Apply(doc, []byte(`[{"op":"replace","path":"/a","value":2},{"op":"remove","path":"/b"}]`))
+
+		assert.Error(t, err)
+		assert.Equal(t, `{"a":1}`, string(doc))
+	})
+}
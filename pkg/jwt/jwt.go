@@ -2,6 +2,7 @@ package jwt
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,66 +12,201 @@ import (
 	"go-echo-starter/internal/domain"
 )
 
-// Common errors
+// Common errors.
+// The reasons a token is rejected all wrap ErrInvalidToken, except for ErrExpiredToken.
 var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token has expired")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrExpiredToken     = errors.New("token has expired")
+	ErrInvalidSignature = fmt.Errorf("%w: signature is invalid", ErrInvalidToken)
+	ErrUnknownKey       = fmt.Errorf("%w: signing key is unknown", ErrInvalidToken)
+	ErrInvalidIssuer    = fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	ErrInvalidAudience  = fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	ErrInvalidSubject   = fmt.Errorf("%w: subject does not match the user", ErrInvalidToken)
+	ErrMissingClaim     = fmt.Errorf("%w: required claim is missing", ErrInvalidToken)
+	ErrTokenNotYetValid = fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
 )
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Name   string    `json:"name"`
-	Email  string    `json:"email"`
+	UserID       uuid.UUID   `json:"user_id"`
+	Name         string      `json:"name"`
+	Email        string      `json:"email"`
+	Role         domain.Role `json:"role"`
+	Scopes       []string    `json:"scopes"`
+	TokenVersion int         `json:"ver"`
+	ClientID     string      `json:"client_id,omitempty"`
+	SessionID    string      `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWT handles JWT operations
+// HasUser returns false for tokens an OAuth client was issued on its own behalf,
+// which carry no user
+func (c *Claims) HasUser() bool {
+	return c.UserID != uuid.Nil
+}
+
+// TokenIssuer issues access tokens for users and OAuth clients
+type TokenIssuer interface {
+	Generate(user *domain.User, sessionID uuid.UUID, scopes []string) (string, error)
+	GenerateForClient(clientID string, user *domain.User, scopes []string) (string, error)
+	GetExpireTime() int64
+}
+
+// TokenVerifier verifies access tokens and returns their claims.
+// Implementations report rejected tokens with ErrInvalidToken, ErrExpiredToken
+// or one of the errors wrapping ErrInvalidToken.
+type TokenVerifier interface {
+	Validate(token string) (*Claims, error)
+}
+
+// KeySetProvider is implemented by token issuers whose tokens can be verified
+// with published public keys
+type KeySetProvider interface {
+	JWKS() JWKS
+}
+
+var (
+	_ TokenIssuer    = (*JWT)(nil)
+	_ TokenVerifier  = (*JWT)(nil)
+	_ KeySetProvider = (*JWT)(nil)
+)
+
+// JWT handles JWT operations.
+// Tokens are signed with a single signing key and carry its ID in the kid header;
+// they are verified with whichever configured key the kid names, so previous keys
+// can stay valid for verification while a new key takes over signing.
 type JWT struct {
-	secretKey  []byte
+	signing    *key
+	keys       map[string]*key
+	jwks       JWKS
+	issuer     string
+	audience   []string
+	parser     *jwt.Parser
 	expireTime time.Duration
 }
 
-// New creates a new JWT instance
-func New(cfg *config.JWTConfig) *JWT {
-	return &JWT{
-		secretKey:  []byte(cfg.Secret),
+// New creates a new JWT instance.
+// HS256 signs with the shared secret; RS256, ES256 and EdDSA sign with the PEM private key
+// in the signing key file. Keys in the verification key files are only used to verify tokens.
+func New(cfg *config.JWTConfig) (*JWT, error) {
+	var signing *key
+	switch cfg.Algorithm {
+	case AlgorithmHS256, "":
+		signing = newHMACKey(cfg.SigningKeyID, cfg.Secret)
+	case AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA:
+		if cfg.SigningKeyFile == "" {
+			return nil, fmt.Errorf("a signing key file is required for %s", cfg.Algorithm)
+		}
+		k, err := loadKeyFile(cfg.SigningKeyFile, cfg.SigningKeyID)
+		if err != nil {
+			return nil, err
+		}
+		if k.private == nil {
+			return nil, fmt.Errorf("%s: signing key file must contain a private key", cfg.SigningKeyFile)
+		}
+		if k.method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("%s: %s key cannot be used for %s", cfg.SigningKeyFile, k.method.Alg(), cfg.Algorithm)
+		}
+		signing = k
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, cfg.Algorithm)
+	}
+
+	j := &JWT{
+		signing:    signing,
+		keys:       map[string]*key{signing.id: signing},
+		jwks:       JWKS{Keys: []JWK{}},
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		parser:     newParser(cfg),
 		expireTime: cfg.ExpireTime,
 	}
+	if signing.jwk != nil {
+		j.jwks.Keys = append(j.jwks.Keys, *signing.jwk)
+	}
+
+	for _, path := range cfg.VerificationKeyFiles {
+		k, err := loadKeyFile(path, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := j.keys[k.id]; exists {
+			return nil, fmt.Errorf("%s: duplicate key ID %q", path, k.id)
+		}
+		j.keys[k.id] = k
+		j.jwks.Keys = append(j.jwks.Keys, *k.jwk)
+	}
+
+	return j, nil
 }
 
-// Generate generates a new JWT token for a user
-func (j *JWT) Generate(user *domain.User) (string, error) {
+// Generate generates a new JWT token for a user with the given granted scopes,
+// carrying the ID of the session it belongs to in the sid claim
+func (j *JWT) Generate(user *domain.User, sessionID uuid.UUID, scopes []string) (string, error) {
+	claims := j.newClaims("", user, scopes)
+	claims.SessionID = sessionID.String()
+	return j.sign(claims)
+}
+
+// GenerateForClient generates a new JWT token issued to an OAuth client, carrying
+// its ID in the client_id claim. The token acts for the user, or for the client
+// itself when user is nil, in which case the client ID is the subject.
+func (j *JWT) GenerateForClient(clientID string, user *domain.User, scopes []string) (string, error) {
+	return j.sign(j.newClaims(clientID, user, scopes))
+}
+
+// newClaims creates the claims of a new token
+func (j *JWT) newClaims(clientID string, user *domain.User, scopes []string) *Claims {
 	now := time.Now()
 	claims := &Claims{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email,
+		Scopes:   scopes,
+		ClientID: clientID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.issuer,
+			Subject:   clientID,
+			Audience:  j.audience,
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(now.Add(j.expireTime)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
+	if user != nil {
+		claims.UserID = user.ID
+		claims.Name = user.Name
+		claims.Email = user.Email
+		claims.Role = user.Role
+		claims.TokenVersion = user.TokenVersion
+		claims.Subject = user.ID.String()
+	}
+	return claims
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+// sign signs claims with the signing key
+func (j *JWT) sign(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(j.signing.method, claims)
+	if j.signing.id != "" {
+		token.Header["kid"] = j.signing.id
+	}
+	return token.SignedString(j.signing.private)
 }
 
-// Validate validates a JWT token and returns the claims
+// Validate validates a JWT token and returns the claims.
+// Besides the signature and lifetime, the issuer and audience must match the configured ones
+// and the subject must be the user ID, or the client ID for tokens without a user.
+// Every failure maps to one of the package errors.
 func (j *JWT) Validate(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
+	token, err := j.parser.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := j.keys[kid]
+		// The key decides the algorithm, so a token cannot pick a weaker one
+		if !ok || token.Method.Alg() != k.method.Alg() {
+			return nil, ErrUnknownKey
 		}
-		return j.secretKey, nil
+		return k.public, nil
 	})
-
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
+		return nil, validationError(err)
 	}
 
 	claims, ok := token.Claims.(*Claims)
@@ -78,10 +214,62 @@ func (j *JWT) Validate(tokenString string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
+	subject := claims.UserID.String()
+	if !claims.HasUser() {
+		subject = claims.ClientID
+	}
+	if subject == "" || claims.Subject != subject {
+		return nil, ErrInvalidSubject
+	}
+
 	return claims, nil
 }
 
+// JWKS returns the public keys tokens may be signed with, for publishing to other services.
+// It is empty for HS256, whose shared secret must never be published.
+func (j *JWT) JWKS() JWKS {
+	return j.jwks
+}
+
 // GetExpireTime returns the token expiration time in seconds
 func (j *JWT) GetExpireTime() int64 {
 	return int64(j.expireTime.Seconds())
 }
+
+// newParser creates a parser enforcing the configured issuer, audience and clock skew leeway
+func newParser(cfg *config.JWTConfig) *jwt.Parser {
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if len(cfg.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.Audience...))
+	}
+	return jwt.NewParser(opts...)
+}
+
+// validationError maps a parser error to the package error describing why the token was rejected
+func validationError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		return ErrUnknownKey
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ErrInvalidSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrExpiredToken
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ErrMissingClaim
+	default:
+		return ErrInvalidToken
+	}
+}
@@ -0,0 +1,262 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/internal/domain"
+)
+
+var testUser = &domain.User{ID: uuid.New(), Name: "Test User", Email: "test@example.com", Role: domain.RoleUser}
+
+// writePrivateKey writes a private key as a PKCS #8 PEM file and returns its path
+func writePrivateKey(t *testing.T, priv crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.NoError(t, err)
+	return writePEM(t, "PRIVATE KEY", der)
+}
+
+// writePublicKey writes a public key as a PKIX PEM file and returns its path
+func writePublicKey(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	assert.NoError(t, err)
+	return writePEM(t, "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func TestJWT_SignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		algorithm string
+		key       crypto.Signer
+		kty       string
+	}{
+		{AlgorithmRS256, rsaKey, "RSA"},
+		{AlgorithmES256, ecKey, "EC"},
+		{AlgorithmEdDSA, edKey, "OKP"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			j, err := New(&config.JWTConfig{
+				Algorithm:      tc.algorithm,
+				SigningKeyFile: writePrivateKey(t, tc.key),
+				ExpireTime:     time.Minute,
+			})
+			assert.NoError(t, err)
+
+			sessionID := uuid.New()
+			token, err := j.Generate(testUser, sessionID, []string{"users:read"})
+			assert.NoError(t, err)
+
+			claims, err := j.Validate(token)
+			assert.NoError(t, err)
+			assert.Equal(t, testUser.ID, claims.UserID)
+			assert.Equal(t, sessionID.String(), claims.SessionID)
+
+			jwks := j.JWKS()
+			if !assert.Len(t, jwks.Keys, 1) {
+				return
+			}
+			assert.Equal(t, tc.kty, jwks.Keys[0].Kty)
+			assert.Equal(t, tc.algorithm, jwks.Keys[0].Alg)
+
+			pub, err := jwks.Keys[0].PublicKey()
+			assert.NoError(t, err)
+			assert.True(t, tc.key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(pub), "JWK round trip")
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			assert.NoError(t, err)
+			assert.Equal(t, jwks.Keys[0].Kid, parsed.Header["kid"])
+		})
+	}
+}
+
+func TestJWT_KeyRotation(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	before, err := New(&config.JWTConfig{Algorithm: AlgorithmEdDSA, SigningKeyFile: writePrivateKey(t, oldKey), ExpireTime: time.Minute})
+	assert.NoError(t, err)
+	oldToken, _ := before.Generate(testUser, uuid.Nil, nil)
+
+	after, err := New(&config.JWTConfig{
+		Algorithm:            AlgorithmEdDSA,
+		SigningKeyFile:       writePrivateKey(t, newKey),
+		VerificationKeyFiles: []string{writePublicKey(t, oldKey.Public())},
+		ExpireTime:           time.Minute,
+	})
+	assert.NoError(t, err)
+	newToken, _ := after.Generate(testUser, uuid.Nil, nil)
+
+	_, err = after.Validate(oldToken)
+	assert.NoError(t, err, "tokens of the previous key stay valid")
+	_, err = after.Validate(newToken)
+	assert.NoError(t, err)
+	_, err = before.Validate(newToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "unknown kid")
+
+	assert.Len(t, after.JWKS().Keys, 2)
+}
+
+func TestJWT_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	j, err := New(&config.JWTConfig{Algorithm: AlgorithmRS256, SigningKeyFile: writePrivateKey(t, rsaKey), ExpireTime: time.Minute})
+	assert.NoError(t, err)
+	kid := j.JWKS().Keys[0].Kid
+
+	// An HS256 token "signed" with the published public key must not verify
+	publicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: testUser.ID})
+	forged.Header["kid"] = kid
+	token, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+	_, err = j.Validate(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWT_HS256(t *testing.T) {
+	j, err := New(&config.JWTConfig{Secret: "test-secret", ExpireTime: time.Minute})
+	assert.NoError(t, err)
+
+	token, _ := j.Generate(testUser, uuid.Nil, nil)
+	_, err = j.Validate(token)
+	assert.NoError(t, err)
+	assert.Empty(t, j.JWKS().Keys, "shared secrets are never published")
+}
+
+func TestJWT_GenerateForClient(t *testing.T) {
+	j, err := New(&config.JWTConfig{Secret: "test-secret", ExpireTime: time.Minute})
+	assert.NoError(t, err)
+
+	token, _ := j.GenerateForClient("client-1", testUser, []string{"users:read"})
+	claims, err := j.Validate(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "client-1", claims.ClientID)
+	assert.Equal(t, testUser.ID.String(), claims.Subject)
+	assert.True(t, claims.HasUser())
+
+	token, _ = j.GenerateForClient("client-1", nil, []string{"users:read"})
+	claims, err = j.Validate(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "client-1", claims.Subject)
+	assert.False(t, claims.HasUser())
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	_, err := New(&config.JWTConfig{Algorithm: "none"})
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	_, err = New(&config.JWTConfig{Algorithm: AlgorithmRS256})
+	assert.Error(t, err, "missing key file")
+
+	_, err = New(&config.JWTConfig{Algorithm: AlgorithmRS256, SigningKeyFile: writePrivateKey(t, ecKey)})
+	assert.Error(t, err, "key does not match the algorithm")
+
+	_, err = New(&config.JWTConfig{Algorithm: AlgorithmES256, SigningKeyFile: writePublicKey(t, ecKey.Public())})
+	assert.Error(t, err, "public key cannot sign")
+}
+
+func TestJWT_Validate_Errors(t *testing.T) {
+	cfg := &config.JWTConfig{
+		Secret:     "test-secret",
+		Issuer:     "go-echo-starter",
+		Audience:   []string{"go-echo-starter"},
+		Leeway:     30 * time.Second,
+		ExpireTime: time.Minute,
+	}
+	j, err := New(cfg)
+	assert.NoError(t, err)
+
+	// sign signs the claims of a valid token after applying the modification
+	sign := func(modify func(c *Claims)) string {
+		now := time.Now()
+		claims := &Claims{
+			UserID: testUser.ID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    cfg.Issuer,
+				Subject:   testUser.ID.String(),
+				Audience:  cfg.Audience,
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+		}
+		modify(claims)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.Secret))
+		assert.NoError(t, err)
+		return token
+	}
+
+	generated, _ := j.Generate(testUser, uuid.Nil, nil)
+	claims, err := j.Validate(generated)
+	assert.NoError(t, err)
+	assert.Equal(t, testUser.ID.String(), claims.Subject)
+	assert.Equal(t, "go-echo-starter", claims.Issuer)
+
+	_, err = j.Validate(sign(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second)) }))
+	assert.NoError(t, err, "expired within the leeway")
+
+	cases := []struct {
+		name   string
+		modify func(c *Claims)
+		want   error
+	}{
+		{"expired", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }, ErrExpiredToken},
+		{"not valid yet", func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }, ErrTokenNotYetValid},
+		{"wrong issuer", func(c *Claims) { c.Issuer = "other-service" }, ErrInvalidIssuer},
+		{"wrong audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-service"} }, ErrInvalidAudience},
+		{"missing audience", func(c *Claims) { c.Audience = nil }, ErrMissingClaim},
+		{"missing expiry", func(c *Claims) { c.ExpiresAt = nil }, ErrMissingClaim},
+		{"wrong subject", func(c *Claims) { c.Subject = uuid.NewString() }, ErrInvalidSubject},
+		{"neither user nor client", func(c *Claims) { c.UserID, c.Subject = uuid.Nil, "" }, ErrInvalidSubject},
+		{"client token with user subject", func(c *Claims) { c.UserID, c.ClientID = uuid.Nil, "client-1" }, ErrInvalidSubject},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := j.Validate(sign(tc.modify))
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	t.Run("bad signature", func(t *testing.T) {
+		other, _ := New(&config.JWTConfig{Secret: "other-secret", Issuer: cfg.Issuer, Audience: cfg.Audience, ExpireTime: time.Minute})
+		token, _ := other.Generate(testUser, uuid.Nil, nil)
+
+		_, err := j.Validate(token)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
@@ -0,0 +1,132 @@
+// Package jwttest provides a deterministic fake token issuer and verifier for tests.
+package jwttest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"go-echo-starter/internal/domain"
+	"go-echo-starter/pkg/jwt"
+)
+
+// DefaultExpireTime is the lifetime of tokens issued by a new Fake
+const DefaultExpireTime = 15 * time.Minute
+
+// Fake issues opaque tokens "test-token-1", "test-token-2", ... and remembers the
+// claims of each, so it verifies exactly the tokens it issued. Token IDs are
+// "jti-1", "jti-2", ... to match. It is safe for concurrent use.
+type Fake struct {
+	// ExpireTime is the lifetime of issued tokens
+	ExpireTime time.Duration
+	// Now is the clock tokens are issued and checked against
+	Now func() time.Time
+	// GenerateErr, when set, is returned by Generate instead of issuing a token
+	GenerateErr error
+
+	mu     sync.Mutex
+	issued int
+	claims map[string]*jwt.Claims
+}
+
+var (
+	_ jwt.TokenIssuer   = (*Fake)(nil)
+	_ jwt.TokenVerifier = (*Fake)(nil)
+)
+
+// New creates a fake issuing tokens valid for DefaultExpireTime
+func New() *Fake {
+	return &Fake{
+		ExpireTime: DefaultExpireTime,
+		Now:        time.Now,
+		claims:     make(map[string]*jwt.Claims),
+	}
+}
+
+// Generate issues the next token for the user with the given session and scopes
+func (f *Fake) Generate(user *domain.User, sessionID uuid.UUID, scopes []string) (string, error) {
+	return f.generate("", sessionID.String(), user, scopes)
+}
+
+// GenerateForClient issues the next token for an OAuth client, acting for the
+// user or, if user is nil, for the client itself
+func (f *Fake) GenerateForClient(clientID string, user *domain.User, scopes []string) (string, error) {
+	return f.generate(clientID, "", user, scopes)
+}
+
+func (f *Fake) generate(clientID, sessionID string, user *domain.User, scopes []string) (string, error) {
+	if f.GenerateErr != nil {
+		return "", f.GenerateErr
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.issued++
+	now := f.Now()
+	token := fmt.Sprintf("test-token-%d", f.issued)
+	claims := &jwt.Claims{
+		Scopes:    scopes,
+		ClientID:  clientID,
+		SessionID: sessionID,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			ID:        fmt.Sprintf("jti-%d", f.issued),
+			Subject:   clientID,
+			ExpiresAt: gojwt.NewNumericDate(now.Add(f.ExpireTime)),
+			IssuedAt:  gojwt.NewNumericDate(now),
+			NotBefore: gojwt.NewNumericDate(now),
+		},
+	}
+	if user != nil {
+		claims.UserID = user.ID
+		claims.Name = user.Name
+		claims.Email = user.Email
+		claims.Role = user.Role
+		claims.TokenVersion = user.TokenVersion
+		claims.Subject = user.ID.String()
+	}
+	f.claims[token] = claims
+
+	return token, nil
+}
+
+// Validate returns the claims of an issued token, jwt.ErrExpiredToken once it has
+// expired and jwt.ErrInvalidToken for tokens it did not issue
+func (f *Fake) Validate(token string) (*jwt.Claims, error) {
+	claims, ok := f.Claims(token)
+	if !ok {
+		return nil, jwt.ErrInvalidToken
+	}
+	if !f.Now().Before(claims.ExpiresAt.Time) {
+		return nil, jwt.ErrExpiredToken
+	}
+	return claims, nil
+}
+
+// Claims returns a copy of the claims a token was issued with, regardless of expiry
+func (f *Fake) Claims(token string) (*jwt.Claims, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	claims, ok := f.claims[token]
+	if !ok {
+		return nil, false
+	}
+	c := *claims
+	return &c, true
+}
+
+// Issued returns the number of tokens issued so far
+func (f *Fake) Issued() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issued
+}
+
+// GetExpireTime returns the token lifetime in seconds
+func (f *Fake) GetExpireTime() int64 {
+	return int64(f.ExpireTime.Seconds())
+}
@@ -0,0 +1,204 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key errors
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnsupportedKey       = errors.New("unsupported key type")
+)
+
+// key is a key tokens are signed or verified with
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// private is the private key or HMAC secret; nil for verification-only keys
+	private interface{}
+	// public is the public key or HMAC secret
+	public interface{}
+	// jwk is the public key in JWK format; nil for HMAC secrets
+	jwk *JWK
+}
+
+// newHMACKey creates a key for an HS256 shared secret
+func newHMACKey(id, secret string) *key {
+	return &key{id: id, method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+}
+
+// loadKeyFile loads a PEM encoded private key, public key or certificate.
+// The key ID defaults to the RFC 7638 thumbprint of the public key.
+func loadKeyFile(path, id string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	private, public, err := parsePEMBlock(block)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	k, err := newAsymmetricKey(id, private, public)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// parsePEMBlock parses a private key, public key or certificate.
+// The private key is nil unless the block holds one.
+func parsePEMBlock(block *pem.Block) (crypto.Signer, crypto.PublicKey, error) {
+	var parsed interface{}
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			parsed = cert.PublicKey
+		}
+	default:
+		return nil, nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		return signer, signer.Public(), nil
+	}
+	return nil, parsed, nil
+}
+
+// newAsymmetricKey creates a key for a public key and, for signing keys, its private key
+func newAsymmetricKey(id string, private crypto.Signer, public crypto.PublicKey) (*key, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = thumbprint(jwk)
+	}
+	jwk.Kid = id
+
+	return &key{id: id, method: jwt.GetSigningMethod(jwk.Alg), private: private, public: public, jwk: jwk}, nil
+}
+
+// publicJWK converts a public key to a JWK without a key ID
+func publicJWK(public crypto.PublicKey) (*JWK, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: AlgorithmRS256,
+			N:   encodeSegment(pub.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: only P-256 EC keys are supported", ErrUnsupportedKey)
+		}
+		ecdhKey, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		return &JWK{
+			Kty: "EC",
+			Use: "sig",
+			Alg: AlgorithmES256,
+			Crv: "P-256",
+			X:   encodeSegment(point[1 : 1+size]),
+			Y:   encodeSegment(point[1+size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: AlgorithmEdDSA,
+			Crv: "Ed25519",
+			X:   encodeSegment(pub),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint: the SHA-256 hash of the
+// required members of the key, serialized in lexicographic order
+func thumbprint(jwk *JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	// Marshalling plain strings cannot fail
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return encodeSegment(sum[:])
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
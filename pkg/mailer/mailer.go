@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/pkg/logger"
+)
+
+// Message represents an email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends email messages
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New creates the sender selected by the mail configuration
+func New(cfg *config.MailConfig, log *logger.Logger) (Sender, error) {
+	switch cfg.Driver {
+	case "log":
+		return NewLogSender(log), nil
+	case "file":
+		return NewFileSender(cfg.FileDir, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// LogSender writes messages to the application log instead of sending them.
+// It is meant for local development.
+type LogSender struct {
+	log *logger.Logger
+}
+
+// NewLogSender creates a new log sender
+func NewLogSender(log *logger.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+// Send logs the message
+func (s *LogSender) Send(ctx context.Context, msg *Message) error {
+	s.log.Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("Email sent")
+	return nil
+}
+
+// FileSender writes each message as an .eml file into a directory.
+// It is meant for local development and testing.
+type FileSender struct {
+	dir  string
+	from string
+}
+
+// NewFileSender creates a new file sender, creating the directory if needed
+func NewFileSender(dir, from string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileSender{dir: dir, from: from}, nil
+}
+
+// Send writes the message to a file
+func (s *FileSender) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), sanitizeFilename(msg.To))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return os.WriteFile(filepath.Join(s.dir, name), []byte(b.String()), 0o644)
+}
+
+// sanitizeFilename replaces characters that are unsafe in file names
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,8 @@
+package oidc
+
+import "time"
+
+// SetNow replaces the clock of a provider
+func SetNow(p *Provider, now func() time.Time) {
+	p.now = now
+}
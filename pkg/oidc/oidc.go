@@ -0,0 +1,380 @@
+// Package oidc implements the relying party side of the OpenID Connect
+// authorization code flow with PKCE against any provider supporting discovery.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"go-echo-starter/internal/config"
+	"go-echo-starter/pkg/jwt"
+)
+
+// Common errors
+var (
+	ErrDiscovery      = errors.New("oidc discovery failed")
+	ErrExchange       = errors.New("oidc code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid oidc id token")
+	ErrNonceMismatch  = fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	ErrUnknownKey     = fmt.Errorf("%w: signing key is unknown", ErrInvalidIDToken)
+)
+
+const (
+	// DefaultTimeout bounds every request made to a provider
+	DefaultTimeout = 10 * time.Second
+	// maxResponseBytes bounds the size of provider responses that are read
+	maxResponseBytes = 1 << 20
+	// clockSkew is the leeway allowed on ID token timestamps
+	clockSkew = time.Minute
+	// keyRefreshInterval is how long the key set is trusted to be complete
+	// after it was fetched, so unknown key IDs cannot make us refetch it on every token
+	keyRefreshInterval = time.Minute
+	// verifierBytes is the randomness in a PKCE code verifier
+	verifierBytes = 32
+)
+
+// idTokenAlgorithms are the ID token signing algorithms accepted from providers
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "EdDSA"}
+
+// Metadata is the subset of a provider's discovery document that is used
+type Metadata struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Token is a successful token endpoint response
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+}
+
+// IDTokenClaims are the ID token claims used to identify a user
+type IDTokenClaims struct {
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Name            string `json:"name"`
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	gojwt.RegisteredClaims
+}
+
+// Provider is a client of a single OpenID Connect provider.
+// Discovery and signing keys are fetched on first use and cached; keys are
+// fetched again when an ID token names one that is not cached, at most once
+// per keyRefreshInterval.
+type Provider struct {
+	cfg    config.OIDCProviderConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]signingKey
+	// keysFetchedAt is when the key set was last requested
+	keysFetchedAt time.Time
+}
+
+// signingKey is a provider's public key and the algorithm it is restricted to, if any
+type signingKey struct {
+	alg    string
+	public crypto.PublicKey
+}
+
+// New creates a provider client. A nil HTTP client uses one with DefaultTimeout.
+func New(cfg config.OIDCProviderConfig, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// NewProviders creates a client for every configured provider, keyed by name
+func NewProviders(cfg *config.OIDCConfig) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		providers[p.Name] = New(p, nil)
+	}
+	return providers
+}
+
+// Name returns the configured name of the provider
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL to send the user to for signing in.
+// The state and nonce are echoed back in the callback and the ID token respectively;
+// the code verifier has to be presented again when exchanging the code.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange exchanges an authorization code for tokens
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	// client_secret_basic is the default unless the provider only supports client_secret_post
+	post := !slices.Contains(md.TokenEndpointAuthMethods, "client_secret_basic") &&
+		slices.Contains(md.TokenEndpointAuthMethods, "client_secret_post")
+	if post {
+		form.Set("client_id", p.cfg.ClientID)
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !post {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return nil, fmt.Errorf("%w: %s: %s", ErrExchange, oauthErr.Error, oauthErr.Description)
+		}
+		return nil, fmt.Errorf("%w: token endpoint returned %s", ErrExchange, resp.Status)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrExchange)
+	}
+
+	return &token, nil
+}
+
+// VerifyIDToken verifies the signature, issuer, audience, lifetime and nonce
+// of an ID token and returns its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDTokenClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := gojwt.NewParser(
+		gojwt.WithValidMethods(idTokenAlgorithms),
+		gojwt.WithIssuer(md.Issuer),
+		gojwt.WithAudience(p.cfg.ClientID),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+		gojwt.WithLeeway(clockSkew),
+		gojwt.WithTimeFunc(p.now),
+	)
+
+	claims := &IDTokenClaims{}
+	_, err = parser.ParseWithClaims(raw, claims, func(token *gojwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.alg != "" && key.alg != token.Method.Alg() {
+			return nil, ErrUnknownKey
+		}
+		return key.public, nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidIDToken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: subject is missing", ErrInvalidIDToken)
+	}
+	// With several audiences the token must have been issued to this client
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: wrong authorized party", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	return claims, nil
+}
+
+// discover returns the provider metadata, fetching it on first use
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md Metadata
+	if err := p.getJSON(ctx, p.cfg.DiscoveryURL, &md); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if md.Issuer == "" || md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: metadata is missing a required endpoint", ErrDiscovery)
+	}
+
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// signingKey returns the provider key with the given ID, fetching the key set
+// again if it is not known yet and was not fetched within keyRefreshInterval.
+// An empty ID matches the only key of a single-key set.
+func (p *Provider) signingKey(ctx context.Context, kid string) (signingKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	now := p.now()
+	if now.Sub(p.keysFetchedAt) < keyRefreshInterval {
+		return signingKey{}, ErrUnknownKey
+	}
+	p.keysFetchedAt = now
+
+	var set jwt.JWKS
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return signingKey{}, fmt.Errorf("%w: fetching keys: %v", ErrUnknownKey, err)
+	}
+
+	keys := make(map[string]signingKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = signingKey{alg: k.Alg, public: public}
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return signingKey{}, ErrUnknownKey
+}
+
+// lookupKey finds a cached key. The caller must hold the lock.
+func (p *Provider) lookupKey(kid string) (signingKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// getJSON fetches a JSON document
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", endpoint, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// GenerateVerifier returns a random PKCE code verifier (RFC 7636)
+func GenerateVerifier() (string, error) {
+	b := make([]byte, verifierBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 PKCE code challenge of a code verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
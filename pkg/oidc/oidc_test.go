@@ -0,0 +1,135 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-echo-starter/pkg/oidc"
+	"go-echo-starter/pkg/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/api/v1/auth/oidc/test/callback"
+
+var identity = oidctest.Identity{Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane"}
+
+// authorize runs the authorization step and returns the callback query
+func authorize(t *testing.T, server *oidctest.Server, p *oidc.Provider, state, nonce, verifier string) url.Values {
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	assert.NoError(t, err)
+
+	callback, err := server.Authorize(authURL)
+	assert.NoError(t, err)
+	return callback
+}
+
+func TestProvider_CodeFlow(t *testing.T) {
+	server := oidctest.NewServer(identity)
+	defer server.Close()
+	p := oidc.New(server.Config("test", redirectURL), nil)
+	ctx := context.Background()
+
+	verifier, err := oidc.GenerateVerifier()
+	assert.NoError(t, err)
+
+	callback := authorize(t, server, p, "state-1", "nonce-1", verifier)
+	assert.Equal(t, "state-1", callback.Get("state"))
+
+	token, err := p.Exchange(ctx, callback.Get("code"), verifier)
+	assert.NoError(t, err)
+
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "jane@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+
+	// Codes are single-use
+	_, err = p.Exchange(ctx, callback.Get("code"), verifier)
+	assert.True(t, errors.Is(err, oidc.ErrExchange))
+}
+
+func TestProvider_Exchange_WrongVerifier(t *testing.T) {
+	server := oidctest.NewServer(identity)
+	defer server.Close()
+	p := oidc.New(server.Config("test", redirectURL), nil)
+
+	callback := authorize(t, server, p, "state", "nonce", "verifier-one")
+
+	_, err := p.Exchange(context.Background(), callback.Get("code"), "verifier-two")
+
+	assert.True(t, errors.Is(err, oidc.ErrExchange))
+	assert.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestProvider_VerifyIDToken_Errors(t *testing.T) {
+	server := oidctest.NewServer(identity)
+	defer server.Close()
+	other := oidctest.NewServer(identity)
+	defer other.Close()
+	p := oidc.New(server.Config("test", redirectURL), nil)
+	ctx := context.Background()
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		token, _ := server.IDToken(identity, "nonce", time.Now())
+		_, err := p.VerifyIDToken(ctx, token, "other-nonce")
+		assert.True(t, errors.Is(err, oidc.ErrNonceMismatch))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, _ := server.IDToken(identity, "nonce", time.Now().Add(-2*time.Hour))
+		_, err := p.VerifyIDToken(ctx, token, "nonce")
+		assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+	})
+
+	t.Run("signed by another provider", func(t *testing.T) {
+		token, _ := other.IDToken(identity, "nonce", time.Now())
+		_, err := p.VerifyIDToken(ctx, token, "nonce")
+		assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		token, _ := server.IDToken(identity, "nonce", time.Now())
+		_, err := p.VerifyIDToken(ctx, token+"x", "nonce")
+		assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+	})
+}
+
+func TestProvider_VerifyIDToken_KeyRefresh(t *testing.T) {
+	server := oidctest.NewServer(identity)
+	defer server.Close()
+	p := oidc.New(server.Config("test", redirectURL), nil)
+	ctx := context.Background()
+
+	now := time.Now()
+	oidc.SetNow(p, func() time.Time { return now })
+
+	token, _ := server.IDToken(identity, "nonce", now)
+	_, err := p.VerifyIDToken(ctx, token, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, server.KeyFetches())
+
+	// Tokens naming a key that is not in the fresh set do not refetch it
+	server.RotateKey()
+	token, _ = server.IDToken(identity, "nonce", now)
+	for i := 0; i < 5; i++ {
+		_, err = p.VerifyIDToken(ctx, token, "nonce")
+		assert.True(t, errors.Is(err, oidc.ErrUnknownKey))
+	}
+	assert.Equal(t, 1, server.KeyFetches())
+
+	// A rotated key is picked up once the set may be refetched
+	now = now.Add(2 * time.Minute)
+	_, err = p.VerifyIDToken(ctx, token, "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, server.KeyFetches())
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636 Appendix B
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
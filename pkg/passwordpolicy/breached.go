@@ -0,0 +1,69 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hashPrefixLength is the number of hex characters of the SHA-1 hash used to pick a range file
+const hashPrefixLength = 5
+
+// BreachChecker reports whether a password is known to have been leaked
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// BreachedList looks passwords up in a local copy of a breached-password corpus,
+// laid out like the Have I Been Pwned range API: the directory holds one file per
+// 5-character uppercase SHA-1 prefix (e.g. "5BAA6" or "5BAA6.txt"), each listing
+// the remaining 35 characters of the leaked hashes as "SUFFIX:COUNT" lines.
+// Only the range file of the password's own prefix is ever read.
+type BreachedList struct {
+	dir string
+}
+
+// NewBreachedList creates a breached-password lookup over the given directory
+func NewBreachedList(dir string) *BreachedList {
+	return &BreachedList{dir: dir}
+}
+
+// IsBreached reports whether the password's hash is in the list
+func (l *BreachedList) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+
+	f, err := l.openRange(prefix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// openRange opens the range file of a hash prefix
+func (l *BreachedList) openRange(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(l.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(l.dir, prefix+".txt"))
+	}
+	return f, err
+}
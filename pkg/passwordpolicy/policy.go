@@ -0,0 +1,143 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go-echo-starter/internal/config"
+)
+
+// Rules reported in violations
+const (
+	RuleMinLength = "min_length"
+	RuleUppercase = "uppercase"
+	RuleLowercase = "lowercase"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleUserInfo  = "user_info"
+	RuleStrength  = "strength"
+	RuleBreached  = "breached"
+)
+
+// minUserInfoLength is the shortest piece of user info that a password may not contain
+const minUserInfoLength = 3
+
+// Violation describes a single password policy rule that a password breaks
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy checks passwords against the configured rules
+type Policy struct {
+	cfg      *config.PasswordConfig
+	breaches BreachChecker
+}
+
+// New creates a password policy.
+// The breached-password check is only enabled if a breached list directory is configured.
+func New(cfg *config.PasswordConfig) *Policy {
+	p := &Policy{cfg: cfg}
+	if cfg.BreachedListDir != "" {
+		p.breaches = NewBreachedList(cfg.BreachedListDir)
+	}
+	return p
+}
+
+// Check returns every rule the password breaks. userInputs are values the password
+// must not be built from, such as the user's email address and name.
+func (p *Policy) Check(password string, userInputs ...string) ([]Violation, error) {
+	var violations []Violation
+
+	if len([]rune(password)) < p.cfg.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("password must be at least %d characters", p.cfg.MinLength),
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.cfg.RequireUppercase && !hasUpper {
+		violations = append(violations, Violation{Rule: RuleUppercase, Message: "password must contain an uppercase letter"})
+	}
+	if p.cfg.RequireLowercase && !hasLower {
+		violations = append(violations, Violation{Rule: RuleLowercase, Message: "password must contain a lowercase letter"})
+	}
+	if p.cfg.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{Rule: RuleDigit, Message: "password must contain a digit"})
+	}
+	if p.cfg.RequireSymbol && !hasSymbol {
+		violations = append(violations, Violation{Rule: RuleSymbol, Message: "password must contain a symbol"})
+	}
+
+	inputs := userInfoTokens(userInputs)
+	if p.cfg.ForbidUserInfo && containsAny(strings.ToLower(password), inputs) {
+		violations = append(violations, Violation{Rule: RuleUserInfo, Message: "password must not contain your name or email address"})
+	}
+
+	if p.cfg.MinStrength > 0 && Strength(password, inputs...) < p.cfg.MinStrength {
+		violations = append(violations, Violation{Rule: RuleStrength, Message: "password is too easy to guess"})
+	}
+
+	if p.breaches != nil {
+		breached, err := p.breaches.IsBreached(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, Violation{Rule: RuleBreached, Message: "password has appeared in a data breach"})
+		}
+	}
+
+	return violations, nil
+}
+
+// userInfoTokens splits user inputs into the lowercase pieces a password may not contain:
+// each input itself, the local part of email addresses and the words of names
+func userInfoTokens(userInputs []string) []string {
+	var tokens []string
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+		tokens = append(tokens, input)
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			tokens = append(tokens, local)
+		}
+		tokens = append(tokens, strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+
+	filtered := tokens[:0]
+	for _, t := range tokens {
+		if len(t) >= minUserInfoLength {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package passwordpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-echo-starter/internal/config"
+)
+
+// rules returns the rules of the violations
+func rules(violations []Violation) []string {
+	out := make([]string, 0, len(violations))
+	for _, v := range violations {
+		out = append(out, v.Rule)
+	}
+	return out
+}
+
+func TestStrength(t *testing.T) {
+	cases := []struct {
+		password string
+		max      int
+		min      int
+	}{
+		{"password123", 0, 0},
+		{"P@ssw0rd!", 0, 0},
+		{"aaaaaaaaaa", 0, 0},
+		{"qwerty123", 0, 0},
+		{"abcdef123456", 1, 0},
+		{"j0hnsm1th", 1, 0},
+		{"correct horse battery staple", 4, 4},
+		{"x7#kQ9!mZ2", 4, 4},
+	}
+
+	for _, tc := range cases {
+		score := Strength(tc.password, "john", "smith")
+		assert.GreaterOrEqual(t, score, tc.min, tc.password)
+		assert.LessOrEqual(t, score, tc.max, tc.password)
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	t.Run("character classes and length", func(t *testing.T) {
+		p := New(&config.PasswordConfig{
+			MinLength:        12,
+			RequireUppercase: true,
+			RequireLowercase: true,
+			RequireDigit:     true,
+			RequireSymbol:    true,
+		})
+
+		violations, err := p.Check("lowercase")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{RuleMinLength, RuleUppercase, RuleDigit, RuleSymbol}, rules(violations))
+	})
+
+	t.Run("user info", func(t *testing.T) {
+		p := New(&config.PasswordConfig{ForbidUserInfo: true})
+
+		violations, _ := p.Check("xX-Jane.Doe-Xx", "jane.doe@example.com", "Jane Doe")
+		assert.Equal(t, []string{RuleUserInfo}, rules(violations))
+
+		violations, _ = p.Check("unrelated-passphrase", "jane.doe@example.com", "Jane Doe")
+		assert.Empty(t, violations)
+	})
+
+	t.Run("strength", func(t *testing.T) {
+		p := New(&config.PasswordConfig{MinStrength: 3})
+
+		violations, _ := p.Check("Summer2024!")
+		assert.Equal(t, []string{RuleStrength}, rules(violations))
+
+		violations, _ = p.Check("correct horse battery staple")
+		assert.Empty(t, violations)
+	})
+
+	t.Run("breached", func(t *testing.T) {
+		dir := t.TempDir()
+		// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+		err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n"), 0o644)
+		assert.NoError(t, err)
+
+		p := New(&config.PasswordConfig{BreachedListDir: dir})
+
+		violations, err := p.Check("password")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{RuleBreached}, rules(violations))
+
+		violations, err = p.Check("not in the list")
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+}
@@ -0,0 +1,213 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// minPatternLength is the shortest run treated as a pattern rather than as random characters
+const minPatternLength = 3
+
+// Score thresholds in log10 guesses, as used by zxcvbn
+var scoreThresholds = []float64{3, 6, 8, 10}
+
+// keyboardRows are adjacent keys attackers try in order
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// leetSubstitutions lists the letters that common substitutions stand for
+var leetSubstitutions = map[rune]string{
+	'4': "a", '@': "a", '8': "b", '(': "c", '3': "e", '6': "g", '1': "il", '!': "i",
+	'0': "o", '$': "s", '5': "s", '7': "t", '+': "t", '2': "z",
+}
+
+// Strength estimates how hard a password is to guess on a scale from 0 (trivial)
+// to 4 (very strong), in the spirit of zxcvbn. The password is split greedily into
+// dictionary words, user inputs, keyboard walks, sequences, repeats and years,
+// each costing a handful of guesses, while the remaining characters are counted
+// as random picks from the character classes the password uses.
+func Strength(password string, userInputs ...string) int {
+	guesses := log10Guesses(password, userInputs)
+	for score, threshold := range scoreThresholds {
+		if guesses < threshold {
+			return score
+		}
+	}
+	return len(scoreThresholds)
+}
+
+// log10Guesses estimates the base-10 logarithm of the guesses needed to find the password
+func log10Guesses(password string, userInputs []string) float64 {
+	original := []rune(password)
+	lower := []rune(strings.ToLower(password))
+
+	randomCost := math.Log10(float64(charsetSize(original)))
+	dictionary := dictionaryRanks(userInputs)
+
+	var total float64
+	for i := 0; i < len(lower); {
+		if n, cost := matchPattern(lower, i, dictionary); n > 0 {
+			if hasUpper(original[i : i+n]) {
+				cost += math.Log10(2)
+			}
+			total += cost
+			i += n
+			continue
+		}
+		total += randomCost
+		i++
+	}
+
+	return total
+}
+
+// matchPattern finds the longest guessable pattern starting at i and returns its
+// length and cost in log10 guesses, or a zero length if there is none
+func matchPattern(lower []rune, i int, dictionary map[string]int) (int, float64) {
+	bestLen, bestCost := 0, 0.0
+	consider := func(n int, cost float64) {
+		if n >= minPatternLength && n > bestLen {
+			bestLen, bestCost = n, cost
+		}
+	}
+
+	// Dictionary words and user inputs, possibly in leetspeak
+	for word, rank := range dictionary {
+		if matchesWord(lower[i:], word) {
+			consider(len([]rune(word)), math.Log10(float64(rank+2)))
+		}
+	}
+
+	// Repeated characters like "aaaa"
+	n := 1
+	for i+n < len(lower) && lower[i+n] == lower[i] {
+		n++
+	}
+	consider(n, math.Log10(float64(charsetSize(lower[i:i+1])*n)))
+
+	// Sequences like "abcd" or "9876"
+	if i+1 < len(lower) {
+		delta := lower[i+1] - lower[i]
+		if delta == 1 || delta == -1 {
+			n = 2
+			for i+n < len(lower) && lower[i+n]-lower[i+n-1] == delta {
+				n++
+			}
+			consider(n, math.Log10(float64(charsetSize(lower[i:i+1])*n)))
+		}
+	}
+
+	// Keyboard walks like "qwerty" or "lkjh"
+	for _, row := range keyboardRows {
+		for _, walk := range []string{row, reverse(row)} {
+			n = 0
+			for n < len(walk) && i+n < len(lower) && strings.Contains(walk, string(lower[i:i+n+1])) {
+				n++
+			}
+			consider(n, math.Log10(float64(len(walk)*n)))
+		}
+	}
+
+	// Recent years like "1987" or "2024"
+	if i+4 <= len(lower) {
+		year := string(lower[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) && isDigits(year) {
+			consider(4, math.Log10(120))
+		}
+	}
+
+	return bestLen, bestCost
+}
+
+// matchesWord reports whether s starts with word, allowing leetspeak substitutions
+func matchesWord(s []rune, word string) bool {
+	i := 0
+	for _, w := range word {
+		if i >= len(s) {
+			return false
+		}
+		if s[i] != w && !strings.ContainsRune(leetSubstitutions[s[i]], w) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// dictionaryRanks maps common passwords and user inputs to their rank.
+// User inputs rank first since an attacker targeting the account tries them first.
+func dictionaryRanks(userInputs []string) map[string]int {
+	ranks := make(map[string]int, len(commonPasswords)+len(userInputs))
+	for rank, word := range commonPasswords {
+		ranks[word] = rank + len(userInputs)
+	}
+	for rank, input := range userInputs {
+		if len([]rune(input)) >= minPatternLength {
+			ranks[strings.ToLower(input)] = rank
+		}
+	}
+	return ranks
+}
+
+// charsetSize returns the number of characters in the classes the runes use
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return max(size, 1)
+}
+
+func hasUpper(runes []rune) bool {
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,98 @@
+package response
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Pagination describes the page of a listing a response carries
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// Links holds links to the current, next and previous pages of a listing.
+// They are relative to the host and keep the query of the request.
+type Links struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// NewPagination describes a page of perPage items out of total
+func NewPagination(page, perPage, total int) *Pagination {
+	totalPages := 0
+	if perPage > 0 {
+		totalPages = (total + perPage - 1) / perPage
+	}
+	return &Pagination{Page: page, PerPage: perPage, Total: total, TotalPages: totalPages}
+}
+
+// Paginated returns a successful response carrying one page of a listing,
+// with links to the neighbouring pages
+func Paginated(c echo.Context, message string, data interface{}, page *Pagination) error {
+	links := &Links{Self: pageLink(c.Request().URL, page.Page, page.PerPage)}
+	if page.Page < page.TotalPages {
+		links.Next = pageLink(c.Request().URL, page.Page+1, page.PerPage)
+	}
+	if page.Page > 1 {
+		links.Prev = pageLink(c.Request().URL, min(page.Page-1, max(page.TotalPages, 1)), page.PerPage)
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+		Meta:    page,
+		Links:   links,
+	})
+}
+
+// pageLink returns the request URL pointing at the given page
+func pageLink(u *url.URL, page, perPage int) string {
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+	return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+}
+
+// CursorPagination describes the page of a cursor-paginated listing a response carries
+type CursorPagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// CursorPaginated returns a successful response carrying one page of a
+// cursor-paginated listing, with links to the neighbouring pages
+func CursorPaginated(c echo.Context, message string, data interface{}, page *CursorPagination) error {
+	u := c.Request().URL
+	links := &Links{Self: (&url.URL{Path: u.Path, RawQuery: u.RawQuery}).String()}
+	if page.NextCursor != "" {
+		links.Next = cursorLink(u, page.NextCursor, page.Limit)
+	}
+	if page.PrevCursor != "" {
+		links.Prev = cursorLink(u, page.PrevCursor, page.Limit)
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+		Meta:    page,
+		Links:   links,
+	})
+}
+
+// cursorLink returns the request URL pointing at the page of the given cursor
+func cursorLink(u *url.URL, cursor string, limit int) string {
+	query := u.Query()
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+	return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+}
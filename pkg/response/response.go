@@ -10,6 +10,15 @@ type Response struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 	Errors  interface{} `json:"errors,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Links   *Links      `json:"links,omitempty"`
+}
+
+// FieldError describes why the value of a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 // Success returns a successful response
@@ -53,6 +53,8 @@ func formatFieldError(e validator.FieldError) string {
 		return fmt.Sprintf("%s must be at most %s characters", field, e.Param())
 	case "oneof":
 		return fmt.Sprintf("%s must be one of: %s", field, e.Param())
+	case "nefield":
+		return fmt.Sprintf("%s must be different from %s", field, strings.ToLower(e.Param()))
 	default:
 		return fmt.Sprintf("%s is invalid", field)
 	}